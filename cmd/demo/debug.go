@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"lexicon/src/ast"
+	"lexicon/src/debugger"
+	"lexicon/src/evaluator"
+	"strconv"
+	"strings"
+)
+
+const DEBUG_PROMPT = "(sdb) "
+
+// terminal is the line-oriented front end of --debug-interactive, it reads
+// commands whenever the program pauses
+type terminal struct {
+	in     *bufio.Scanner
+	out    io.Writer
+	source []string
+	dbg    *debugger.Debugger
+}
+
+// runs program on the evaluator, pausing before the first statement for
+// commands read from in
+func debugProgram(program *ast.Program, env *evaluator.Environment, source string, in io.Reader, out io.Writer) evaluator.Object {
+	t := &terminal{in: bufio.NewScanner(in), out: out, source: strings.Split(source, "\n")}
+	t.dbg = debugger.New(t.pause)
+	t.dbg.StopOnEntry = true
+	t.dbg.Attach(env)
+
+	fmt.Fprintln(out, "Sprout debugger, type 'help' for commands")
+	return evaluator.Eval(program, env)
+}
+
+// shows where the program stopped and reads commands until one resumes it
+func (t *terminal) pause(stop *debugger.Stop) debugger.Action {
+	fmt.Fprintf(t.out, "Paused at line %d in %s (%s)\n", stop.Line(), stop.Frames[0].Name, stop.Reason)
+	t.list(stop.Line(), 0)
+
+	for {
+		fmt.Fprint(t.out, DEBUG_PROMPT)
+		if !t.in.Scan() {
+			// nobody is left to resume the program
+			fmt.Fprintln(t.out)
+			return debugger.Quit
+		}
+		command, arg, _ := strings.Cut(strings.TrimSpace(t.in.Text()), " ")
+		arg = strings.TrimSpace(arg)
+
+		switch command {
+		case "":
+		case "help", "h":
+			t.help()
+		case "continue", "c":
+			return debugger.Continue
+		case "next", "n":
+			return debugger.StepOver
+		case "step", "s":
+			return debugger.StepInto
+		case "out", "o":
+			return debugger.StepOut
+		case "quit", "q":
+			return debugger.Quit
+		case "break", "b":
+			if line, ok := t.line(arg); ok {
+				t.dbg.SetBreakpoint(line)
+				fmt.Fprintf(t.out, "Breakpoint set at line %d\n", line)
+			}
+		case "clear":
+			if line, ok := t.line(arg); ok {
+				t.dbg.ClearBreakpoint(line)
+				fmt.Fprintf(t.out, "Breakpoint cleared at line %d\n", line)
+			}
+		case "breakpoints", "bl":
+			lines := t.dbg.Breakpoints()
+			if len(lines) == 0 {
+				fmt.Fprintln(t.out, "No breakpoints")
+			}
+			for _, line := range lines {
+				fmt.Fprintf(t.out, "  line %d: %s\n", line, strings.TrimSpace(t.sourceLine(line)))
+			}
+		case "print", "p":
+			if arg == "" {
+				fmt.Fprintln(t.out, "Usage: print <expression>")
+				continue
+			}
+			result := t.dbg.Evaluate(arg, stop.Env())
+			if err, ok := result.(*evaluator.Error); ok {
+				fmt.Fprintf(t.out, "Error: %s\n", err.Message)
+			} else {
+				fmt.Fprintln(t.out, result.Inspect())
+			}
+		case "scopes":
+			t.scopes(stop.Env())
+		case "stack", "bt":
+			for i, frame := range stop.Frames {
+				fmt.Fprintf(t.out, "  #%d %s at line %d\n", i, frame.Name, frame.Line)
+			}
+		case "list", "l":
+			t.list(stop.Line(), 3)
+		default:
+			fmt.Fprintf(t.out, "Unknown command %q, type 'help' for commands\n", command)
+		}
+	}
+}
+
+// parses a line number argument, reporting a bad one
+func (t *terminal) line(arg string) (int, bool) {
+	line, err := strconv.Atoi(arg)
+	if err != nil || line < 1 || line > len(t.source) {
+		fmt.Fprintf(t.out, "Expected a line number between 1 and %d\n", len(t.source))
+		return 0, false
+	}
+	return line, true
+}
+
+func (t *terminal) sourceLine(line int) string {
+	if line < 1 || line > len(t.source) {
+		return ""
+	}
+	return t.source[line-1]
+}
+
+// prints the lines around line, marking it and any breakpoints
+func (t *terminal) list(line, context int) {
+	breakpoints := make(map[int]bool)
+	for _, b := range t.dbg.Breakpoints() {
+		breakpoints[b] = true
+	}
+	width := len(strconv.Itoa(line + context))
+	for n := line - context; n <= line+context; n++ {
+		if n < 1 || n > len(t.source) {
+			continue
+		}
+		marker := "  "
+		if n == line {
+			marker = "->"
+		} else if breakpoints[n] {
+			marker = " *"
+		}
+		fmt.Fprintf(t.out, "%s %*d | %s\n", marker, width, n, t.source[n-1])
+	}
+}
+
+// prints every scope visible from env, walking outwards to the globals
+func (t *terminal) scopes(env *evaluator.Environment) {
+	chain := debugger.ScopeChain(env)
+	for i, scope := range chain {
+		name := fmt.Sprintf("scope %d", i)
+		if i == len(chain)-1 {
+			name = "globals"
+		}
+		fmt.Fprintf(t.out, "%s:\n", name)
+		if len(scope.Names) == 0 {
+			fmt.Fprintln(t.out, "  (empty)")
+		}
+		for j, variable := range scope.Names {
+			fmt.Fprintf(t.out, "  %s = %s\n", variable, scope.Values[j].Inspect())
+		}
+	}
+}
+
+func (t *terminal) help() {
+	fmt.Fprintln(t.out, "Debugger Commands:")
+	fmt.Fprintln(t.out, "  break N, b N     - Pause before statements on line N")
+	fmt.Fprintln(t.out, "  clear N          - Remove the breakpoint on line N")
+	fmt.Fprintln(t.out, "  breakpoints, bl  - List breakpoints")
+	fmt.Fprintln(t.out, "  continue, c      - Run to the next breakpoint")
+	fmt.Fprintln(t.out, "  next, n          - Step over to the next statement")
+	fmt.Fprintln(t.out, "  step, s          - Step into function calls")
+	fmt.Fprintln(t.out, "  out, o           - Step out of the current function")
+	fmt.Fprintln(t.out, "  print E, p E     - Evaluate expression E in the current scope")
+	fmt.Fprintln(t.out, "  scopes           - Show the scope chain from innermost to globals")
+	fmt.Fprintln(t.out, "  stack, bt        - Show the call stack")
+	fmt.Fprintln(t.out, "  list, l          - Show the source around the current line")
+	fmt.Fprintln(t.out, "  quit, q          - Stop the program")
+}
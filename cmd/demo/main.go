@@ -4,10 +4,16 @@ import (
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"lexicon/src/compiler"
+	"lexicon/src/diagnostic"
 	"lexicon/src/evaluator"
 	"lexicon/src/lexer"
 	"lexicon/src/logger"
+	"lexicon/src/optimizer"
 	"lexicon/src/parser"
+	"lexicon/src/resolver"
+	"lexicon/src/typecheck"
+	"lexicon/src/vm"
 	"os"
 	"strings"
 )
@@ -16,11 +22,19 @@ func main() {
 	// Command-line flags
 	traceMode := flag.Bool("trace", false, "Enable trace execution mode")
 	debugMode := flag.Bool("debug", false, "Enable debug logging")
+	noTypecheck := flag.Bool("no-typecheck", false, "Skip the static type check before running")
+	noOptimize := flag.Bool("no-optimize", false, "Run the program without constant folding")
+	useVM := flag.Bool("vm", false, "Run on the bytecode virtual machine instead of the tree-walking evaluator")
+	debugInteractive := flag.Bool("debug-interactive", false, "Run under the step debugger, reading commands from standard input")
 	flag.Parse()
 
 	args := flag.Args()
 	if len(args) < 1 {
-		fmt.Println("Usage: sprun [--trace] [--debug] <filename.spr>")
+		fmt.Println("Usage: sprun [--trace] [--debug] [--debug-interactive] [--no-typecheck] [--no-optimize] [--vm] <filename.spr>")
+		os.Exit(1)
+	}
+	if *debugInteractive && *useVM {
+		fmt.Println("Error: --debug-interactive needs the tree-walking evaluator and cannot be used with --vm")
 		os.Exit(1)
 	}
 
@@ -31,6 +45,7 @@ func main() {
 	}
 
 	// Set logging modes
+	logger.SetOutput(os.Stdout)
 	if *traceMode {
 		logger.EnableTrace()
 	}
@@ -44,20 +59,41 @@ func main() {
 		os.Exit(1)
 	}
 
+	renderer := diagnostic.NewRenderer(filename, string(input))
+
 	l := lexer.New(string(input))
 	p := parser.New(l)
 	program := p.ParseProgram()
 
 	// Check for parser errors
 	if len(p.Errors()) > 0 {
-		fmt.Println("Parser errors detected:")
-		for _, err := range p.Errors() {
-			fmt.Printf("  %s\n", err)
-		}
+		renderer.RenderAll(os.Stdout, p.Diagnostics())
 		os.Exit(1)
 	}
 
+	// Check for type errors
+	if !*noTypecheck {
+		checker := typecheck.New()
+		checker.Check(program)
+		if errors := checker.Diagnostics(); len(errors) > 0 {
+			renderer.RenderAll(os.Stdout, errors)
+			os.Exit(1)
+		}
+	}
+
+	// Fold constants and prune dead branches, the debugger keeps every
+	// statement so that any line can hold a breakpoint
+	if !*noOptimize && !*debugInteractive {
+		optimizer.Optimize(program, nil)
+	}
+
+	// Assign variable slots, warnings do not stop the run
+	r := resolver.New()
+	r.Resolve(program)
+	renderer.RenderAll(os.Stdout, r.Diagnostics())
+
 	env := evaluator.NewEnvironment()
+	env.SetExecContext(evaluator.NewExecContext(os.Stdout, os.Stderr))
 
 	fmt.Println("=== Sprout Interpreter ===")
 	fmt.Println("Executing:", filename)
@@ -66,11 +102,24 @@ func main() {
 	}
 	fmt.Println()
 
-	result := evaluator.Eval(program, env)
+	var result evaluator.Object
+	if *debugInteractive {
+		result = debugProgram(program, env, string(input), os.Stdin, os.Stdout)
+	} else if *useVM {
+		bytecode, err := compiler.Compile(program)
+		if err != nil {
+			fmt.Printf("Compiler error: %s\n", err)
+			os.Exit(1)
+		}
+		result = vm.New(bytecode, env).Run()
+	} else {
+		result = evaluator.Eval(program, env)
+	}
 
 	// Check for runtime errors
-	if result != nil && result.Type() == evaluator.ERROR_OBJ {
-		fmt.Printf("\n%s\n", result.Inspect())
+	if errObj, ok := result.(*evaluator.Error); ok {
+		fmt.Println()
+		renderer.Render(os.Stdout, errObj.Diagnostic())
 		os.Exit(1)
 	}
 
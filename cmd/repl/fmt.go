@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"lexicon/src/diagnostic"
+	"lexicon/src/formatter"
+	"os"
+	"strings"
+)
+
+// sprout fmt [--check | --write] [files...]
+// prints the files in the canonical style, or standard input when no file is
+// given. exits with 1 when --check finds an unformatted file and 2 on errors
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	check := flags.Bool("check", false, "List files that are not formatted instead of printing them")
+	write := flags.Bool("write", false, "Rewrite files in place instead of printing them")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: sprout fmt [--check | --write] [filename.spr ...]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *check && *write {
+		fmt.Fprintln(os.Stderr, "Error: --check and --write cannot be used together")
+		return 2
+	}
+
+	files := flags.Args()
+	if len(files) == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "Error: --write needs a file")
+			return 2
+		}
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+			return 2
+		}
+		return formatSource("<stdin>", string(input), *check, false)
+	}
+
+	status := 0
+	for _, filename := range files {
+		if !strings.HasSuffix(filename, ".spr") {
+			fmt.Fprintf(os.Stderr, "Error: %s: file must have .spr extension\n", filename)
+			status = 2
+			continue
+		}
+		input, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file %s: %v\n", filename, err)
+			status = 2
+			continue
+		}
+		if code := formatSource(filename, string(input), *check, *write); code > status {
+			status = code
+		}
+	}
+	return status
+}
+
+func formatSource(filename, source string, check, write bool) int {
+	formatted, err := formatter.Format(source)
+	var parseErr *formatter.ParseError
+	if errors.As(err, &parseErr) {
+		renderer := diagnostic.NewRenderer(filename, source)
+		renderer.Color = diagnostic.IsTerminal(os.Stderr)
+		renderer.RenderAll(os.Stderr, parseErr.Diagnostics)
+		return 2
+	}
+
+	switch {
+	case check:
+		if formatted != source {
+			fmt.Println(filename)
+			return 1
+		}
+	case write:
+		if formatted != source {
+			if err := os.WriteFile(filename, []byte(formatted), 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing file %s: %v\n", filename, err)
+				return 2
+			}
+		}
+	default:
+		fmt.Print(formatted)
+	}
+	return 0
+}
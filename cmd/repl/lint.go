@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"lexicon/src/diagnostic"
+	"lexicon/src/lexer"
+	"lexicon/src/lint"
+	"lexicon/src/parser"
+	"os"
+	"strings"
+)
+
+// sprout lint [files...]
+// reports likely mistakes in the files, or standard input when no file is
+// given. exits with 1 when there are findings and 2 on errors
+func runLint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: sprout lint [filename.spr ...]")
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	files := flags.Args()
+	if len(files) == 0 {
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+			return 2
+		}
+		return lintSource("<stdin>", string(input))
+	}
+
+	status := 0
+	for _, filename := range files {
+		if !strings.HasSuffix(filename, ".spr") {
+			fmt.Fprintf(os.Stderr, "Error: %s: file must have .spr extension\n", filename)
+			status = 2
+			continue
+		}
+		input, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file %s: %v\n", filename, err)
+			status = 2
+			continue
+		}
+		if code := lintSource(filename, string(input)); code > status {
+			status = code
+		}
+	}
+	return status
+}
+
+func lintSource(filename, source string) int {
+	renderer := diagnostic.NewRenderer(filename, source)
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		renderer.RenderAll(os.Stdout, p.Diagnostics())
+		return 2
+	}
+
+	findings := lint.Lint(program)
+	renderer.RenderAll(os.Stdout, findings)
+	if len(findings) > 0 {
+		return 1
+	}
+	return 0
+}
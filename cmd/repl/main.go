@@ -2,13 +2,19 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"io"
 	"lexicon/src/ast"
+	"lexicon/src/compiler"
+	"lexicon/src/diagnostic"
 	"lexicon/src/evaluator"
 	"lexicon/src/lexer"
 	"lexicon/src/logger"
+	"lexicon/src/optimizer"
 	"lexicon/src/parser"
+	"lexicon/src/resolver"
+	"lexicon/src/vm"
 	"os"
 	"strings"
 )
@@ -16,7 +22,20 @@ import (
 const PROMPT = "sprout> "
 
 func main() {
-	env := evaluator.NewEnvironment()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "fmt":
+			os.Exit(runFmt(os.Args[2:]))
+		case "lint":
+			os.Exit(runLint(os.Args[2:]))
+		}
+	}
+
+	useVM := flag.Bool("vm", false, "Run on the bytecode virtual machine instead of the tree-walking evaluator")
+	flag.Parse()
+
+	logger.SetOutput(os.Stdout)
+	env := newEnvironment()
 	scanner := bufio.NewScanner(os.Stdin)
 
 	fmt.Println("Welcome to the Sprout Programming Language REPL!")
@@ -51,7 +70,7 @@ func main() {
 		}
 
 		if line == "clear" {
-			env = evaluator.NewEnvironment()
+			env = newEnvironment()
 			fmt.Println("Environment cleared!")
 			continue
 		}
@@ -78,11 +97,12 @@ func main() {
 		p := parser.New(l)
 		program := p.ParseProgram()
 
+		renderer := diagnostic.NewRenderer("", line)
+
 		// Check for parser errors
 		if len(p.Errors()) > 0 {
-			fmt.Println("Parser errors:")
-			for _, err := range p.Errors() {
-				fmt.Printf("  %s\n", err)
+			for _, d := range p.Diagnostics() {
+				renderer.Render(os.Stdout, d)
 			}
 			continue
 		}
@@ -90,12 +110,25 @@ func main() {
 		if len(program.Statements) == 0 {
 			continue
 		}
-
-		result := evaluator.Eval(program, env)
+		globals := env.Names()
+		optimizer.Optimize(program, globals)
+		resolver.Resolve(program, globals)
+
+		var result evaluator.Object
+		if *useVM {
+			bytecode, err := compiler.Compile(program)
+			if err != nil {
+				fmt.Printf("Compiler error: %s\n", err)
+				continue
+			}
+			result = vm.New(bytecode, env).Run()
+		} else {
+			result = evaluator.Eval(program, env)
+		}
 
 		if result != nil {
 			if errObj, ok := result.(*evaluator.Error); ok {
-				fmt.Printf("Error: %s\n", errObj.Message)
+				renderer.Render(os.Stdout, errObj.Diagnostic())
 			} else if result.Type() != evaluator.NULL_OBJ {
 				// Only print results for non-PrintStatements
 				// Check if the last statement was a print/echo
@@ -114,6 +147,13 @@ func main() {
 	}
 }
 
+// creates a fresh REPL environment writing echo output to stdout
+func newEnvironment() *evaluator.Environment {
+	env := evaluator.NewEnvironment()
+	env.SetExecContext(evaluator.NewExecContext(os.Stdout, os.Stderr))
+	return env
+}
+
 func printHelp() {
 	fmt.Println("Sprout REPL Commands:")
 	fmt.Println("  help       - Show this help message")
@@ -126,8 +166,14 @@ func printHelp() {
 	fmt.Println("Language Features:")
 	fmt.Println("  sprout x = 10;           - Declare variable")
 	fmt.Println("  x = 20;                  - Reassign variable")
+	fmt.Println("  const rate = 0.2;        - Declare constant")
 	fmt.Println("  echo \"Hello\";            - Print output")
 	fmt.Println("  if (x > 5) { echo x; }   - Conditionals")
+	fmt.Println("  while (x < 5) { x = x + 1; } - While loop")
+	fmt.Println("  for (sprout i = 0; i < 3; i = i + 1) { } - For loop")
+	fmt.Println("  sprout f = fn(a) { a }   - Functions and closures")
+	fmt.Println("  sprout a = [1, 2, 3];    - Arrays (a[0], a[-1], a[1:3])")
+	fmt.Println("  sprout m = {\"k\": 1};    - Hashes (m[\"k\"], delete m[\"k\"])")
 	fmt.Println("  5 + 3 * 2;               - Expressions")
 	fmt.Println("  true && false;           - Logical operations")
 }
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"lexicon/src/dap"
+	"lexicon/src/logger"
+	"os"
+)
+
+// sprout-dap serves the Debug Adapter Protocol over standard input and
+// output, editors start it for each debug session
+func main() {
+	// standard output carries the protocol, anything logged goes to stderr
+	logger.SetOutput(os.Stderr)
+
+	if err := dap.NewServer(os.Stdin, os.Stdout).Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "sprout-dap: %v\n", err)
+		os.Exit(1)
+	}
+}
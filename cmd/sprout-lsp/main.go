@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"lexicon/src/logger"
+	"lexicon/src/lsp"
+	"os"
+)
+
+// sprout-lsp serves the Language Server Protocol over standard input and
+// output, editors start it and talk to it for the lifetime of a session
+func main() {
+	// standard output carries the protocol, anything logged goes to stderr
+	logger.SetOutput(os.Stderr)
+
+	if err := lsp.NewServer(os.Stdin, os.Stdout).Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "sprout-lsp: %v\n", err)
+		os.Exit(1)
+	}
+}
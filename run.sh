@@ -3,10 +3,16 @@
 # Sprout Language Quick Start Script
 
 echo "🌱 Building Sprout REPL..."
-go build -o sprout cmd/repl/main.go
+go build -o sprout ./cmd/repl
 
 echo "🌱 Building Sprout Runner..."
-go build -o sprun cmd/demo/main.go
+go build -o sprun ./cmd/demo
+
+echo "🌱 Building Sprout Language Server..."
+go build -o sprout-lsp ./cmd/sprout-lsp
+
+echo "🌱 Building Sprout Debug Adapter..."
+go build -o sprout-dap ./cmd/sprout-dap
 
 if [ $? -eq 0 ]; then
     echo " Build successful!"
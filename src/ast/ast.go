@@ -26,10 +26,13 @@ func (p *Parser) nextToken() {
 	p.peekToken = p.l.NextToken()
 }
 
-// basic AST node interface
+// basic AST node interface, Pos is the node's first character and End the
+// position just past its last one
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position
+	End() token.Position
 }
 
 type Statement interface {
@@ -45,6 +48,7 @@ type Expression interface {
 // program root node
 type Program struct {
 	Statements []Statement
+	Comments   []*Comment // every comment in source order
 }
 
 func (p *Program) TokenLiteral() string {
@@ -55,6 +59,20 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
+func (p *Program) End() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+	return token.Position{}
+}
+
 // better debugging by making tests functional
 func (p *Program) String() string {
 	var out strings.Builder
@@ -65,7 +83,7 @@ func (p *Program) String() string {
 }
 
 // variable declaration
-// sprout x = 10 | sprout x int = 10 | x = 10
+// sprout x = 10 | sprout x int = 10 | const x = 10 | x = 10
 type VariableDeclaration struct {
 	Token token.Token
 	Name  *Identifier
@@ -75,9 +93,32 @@ type VariableDeclaration struct {
 
 func (vd *VariableDeclaration) statementNode()       {}
 func (vd *VariableDeclaration) TokenLiteral() string { return vd.Token.Literal }
+func (vd *VariableDeclaration) Pos() token.Position  { return vd.Token.Pos() }
+func (vd *VariableDeclaration) End() token.Position {
+	switch {
+	case vd.Value != nil:
+		return vd.Value.End()
+	case vd.Type != nil:
+		return vd.Type.End()
+	case vd.Name != nil:
+		return vd.Name.End()
+	}
+	return vd.Token.End()
+}
+
+// reports whether this is a plain reassignment (x = 10) rather than a declaration
+func (vd *VariableDeclaration) IsAssignment() bool { return vd.Token.Type == token.IDENT }
+
+// reports whether this declares a constant (const x = 10)
+func (vd *VariableDeclaration) IsConstant() bool { return vd.Token.Type == token.CONST }
+
 func (vd *VariableDeclaration) String() string {
 	var out strings.Builder
-	out.WriteString("sprout ")
+	if vd.IsConstant() {
+		out.WriteString("const ")
+	} else if !vd.IsAssignment() {
+		out.WriteString("sprout ")
+	}
 	out.WriteString(vd.Name.String())
 	if vd.Type != nil {
 		out.WriteString(" ")
@@ -91,14 +132,35 @@ func (vd *VariableDeclaration) String() string {
 	return out.String()
 }
 
+// comment, from the # to the end of the line
+// # note
+type Comment struct {
+	Token token.Token
+}
+
+func (c *Comment) TokenLiteral() string { return c.Token.Literal }
+func (c *Comment) String() string       { return c.Token.Literal }
+func (c *Comment) Pos() token.Position  { return c.Token.Pos() }
+func (c *Comment) End() token.Position  { return c.Token.End() }
+
 // identifier node
 type Identifier struct {
 	Token token.Token
 	Value string
+	Slot  Slot // filled in by the resolver
+}
+
+// position of a variable's binding, Depth scopes out at Index
+type Slot struct {
+	Depth    int
+	Index    int
+	Resolved bool // false when the binding is only known at runtime
 }
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() token.Position  { return i.Token.Pos() }
+func (i *Identifier) End() token.Position  { return i.Token.End() }
 func (i *Identifier) String() string       { return i.Value }
 
 // integer literal
@@ -109,6 +171,8 @@ type IntegerLiteral struct {
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos() }
+func (il *IntegerLiteral) End() token.Position  { return il.Token.End() }
 func (il *IntegerLiteral) String() string       { return fmt.Sprintf("%d", il.Value) }
 
 // float literal
@@ -119,6 +183,8 @@ type FloatLiteral struct {
 
 func (fl *FloatLiteral) expressionNode()      {}
 func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Position  { return fl.Token.Pos() }
+func (fl *FloatLiteral) End() token.Position  { return fl.Token.End() }
 func (fl *FloatLiteral) String() string       { return fmt.Sprintf("%f", fl.Value) }
 
 // boolean literal
@@ -129,6 +195,8 @@ type BooleanLiteral struct {
 
 func (bl *BooleanLiteral) expressionNode()      {}
 func (bl *BooleanLiteral) TokenLiteral() string { return bl.Token.Literal }
+func (bl *BooleanLiteral) Pos() token.Position  { return bl.Token.Pos() }
+func (bl *BooleanLiteral) End() token.Position  { return bl.Token.End() }
 func (bl *BooleanLiteral) String() string {
 	if bl.Value {
 		return "true"
@@ -144,6 +212,8 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos() }
+func (sl *StringLiteral) End() token.Position  { return sl.Token.End() }
 func (sl *StringLiteral) String() string       { return fmt.Sprintf("%q", sl.Value) }
 
 // if-else expression
@@ -156,7 +226,17 @@ type IfExpression struct {
 
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
-func (ie *IfExpression) statementNode()       {}
+func (ie *IfExpression) Pos() token.Position  { return ie.Token.Pos() }
+func (ie *IfExpression) End() token.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+	if ie.Consequence != nil {
+		return ie.Consequence.End()
+	}
+	return endOf(ie.Condition, ie.Token)
+}
+func (ie *IfExpression) statementNode() {}
 func (ie *IfExpression) String() string {
 	var out strings.Builder
 	out.WriteString("if (")
@@ -172,12 +252,20 @@ func (ie *IfExpression) String() string {
 
 // block statement
 type BlockStatement struct {
-	Token      token.Token
+	Token      token.Token // the '{' token
 	Statements []Statement
+	Rbrace     token.Token
 }
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos() }
+func (bs *BlockStatement) End() token.Position {
+	if n := len(bs.Statements); n > 0 {
+		return closedEnd(bs.Rbrace, bs.Statements[n-1].End())
+	}
+	return closedEnd(bs.Rbrace, bs.Token.End())
+}
 func (bs *BlockStatement) String() string {
 	var out strings.Builder
 	out.WriteString("{ ")
@@ -196,6 +284,8 @@ type PrintStatement struct {
 
 func (ps *PrintStatement) statementNode()       {}
 func (ps *PrintStatement) TokenLiteral() string { return ps.Token.Literal }
+func (ps *PrintStatement) Pos() token.Position  { return ps.Token.Pos() }
+func (ps *PrintStatement) End() token.Position  { return endOf(ps.Value, ps.Token) }
 func (ps *PrintStatement) String() string {
 	var out strings.Builder
 	out.WriteString("echo ")
@@ -212,6 +302,18 @@ type ExpressionStatement struct {
 
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position {
+	if es.Expression != nil {
+		return es.Expression.Pos()
+	}
+	return es.Token.Pos()
+}
+func (es *ExpressionStatement) End() token.Position {
+	if es.Expression != nil {
+		return es.Expression.End()
+	}
+	return es.Token.End()
+}
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -229,6 +331,8 @@ type LogicalExpression struct {
 
 func (le *LogicalExpression) expressionNode()      {}
 func (le *LogicalExpression) TokenLiteral() string { return le.Token.Literal }
+func (le *LogicalExpression) Pos() token.Position  { return posOf(le.Left, le.Token) }
+func (le *LogicalExpression) End() token.Position  { return endOf(le.Right, le.Token) }
 func (le *LogicalExpression) String() string {
 	var out strings.Builder
 	out.WriteString("(")
@@ -251,6 +355,8 @@ type InfixExpression struct {
 
 func (ie *InfixExpression) expressionNode()      {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) Pos() token.Position  { return posOf(ie.Left, ie.Token) }
+func (ie *InfixExpression) End() token.Position  { return endOf(ie.Right, ie.Token) }
 func (ie *InfixExpression) String() string {
 	var out strings.Builder
 	out.WriteString("(")
@@ -269,6 +375,8 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position  { return pe.Token.Pos() }
+func (pe *PrefixExpression) End() token.Position  { return endOf(pe.Right, pe.Token) }
 func (pe *PrefixExpression) String() string {
 	var out strings.Builder
 	out.WriteString("(" + pe.Operator)
@@ -276,3 +384,352 @@ func (pe *PrefixExpression) String() string {
 	out.WriteString(")")
 	return out.String()
 }
+
+// return statement
+// return x + 1
+type ReturnStatement struct {
+	Token       token.Token
+	ReturnValue Expression
+}
+
+func (rs *ReturnStatement) statementNode()       {}
+func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Position  { return rs.Token.Pos() }
+func (rs *ReturnStatement) End() token.Position {
+	if rs.ReturnValue != nil {
+		return rs.ReturnValue.End()
+	}
+	return rs.Token.End()
+}
+func (rs *ReturnStatement) String() string {
+	var out strings.Builder
+	out.WriteString("return")
+	if rs.ReturnValue != nil {
+		out.WriteString(" ")
+		out.WriteString(rs.ReturnValue.String())
+	}
+	out.WriteString(";")
+	return out.String()
+}
+
+// function literal
+// fn(a, b) { return a + b; }
+type FunctionLiteral struct {
+	Token      token.Token
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (fl *FunctionLiteral) expressionNode()      {}
+func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position  { return fl.Token.Pos() }
+func (fl *FunctionLiteral) End() token.Position {
+	if fl.Body != nil {
+		return fl.Body.End()
+	}
+	return fl.Token.End()
+}
+func (fl *FunctionLiteral) String() string {
+	params := make([]string, 0, len(fl.Parameters))
+	for _, p := range fl.Parameters {
+		params = append(params, p.String())
+	}
+
+	var out strings.Builder
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(fl.Body.String())
+	return out.String()
+}
+
+// call expression
+// add(1, 2)
+type CallExpression struct {
+	Token     token.Token // the '(' token
+	Function  Expression
+	Arguments []Expression
+	Rparen    token.Token
+}
+
+func (ce *CallExpression) expressionNode()      {}
+func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position  { return posOf(ce.Function, ce.Token) }
+func (ce *CallExpression) End() token.Position {
+	if n := len(ce.Arguments); n > 0 {
+		return closedEnd(ce.Rparen, endOf(ce.Arguments[n-1], ce.Token))
+	}
+	return closedEnd(ce.Rparen, ce.Token.End())
+}
+func (ce *CallExpression) String() string {
+	args := make([]string, 0, len(ce.Arguments))
+	for _, a := range ce.Arguments {
+		args = append(args, a.String())
+	}
+
+	var out strings.Builder
+	out.WriteString(ce.Function.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(args, ", "))
+	out.WriteString(")")
+	return out.String()
+}
+
+// while loop
+// while (cond) { }
+type WhileStatement struct {
+	Token     token.Token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) Pos() token.Position  { return ws.Token.Pos() }
+func (ws *WhileStatement) End() token.Position {
+	if ws.Body != nil {
+		return ws.Body.End()
+	}
+	return ws.Token.End()
+}
+func (ws *WhileStatement) String() string {
+	var out strings.Builder
+	out.WriteString("while (")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(") ")
+	out.WriteString(ws.Body.String())
+	return out.String()
+}
+
+// c-style for loop, every clause is optional
+// for (sprout i = 0; i < 10; i = i + 1) { }
+type ForStatement struct {
+	Token     token.Token
+	Init      Statement
+	Condition Expression
+	Post      Statement
+	Body      *BlockStatement
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) Pos() token.Position  { return fs.Token.Pos() }
+func (fs *ForStatement) End() token.Position {
+	if fs.Body != nil {
+		return fs.Body.End()
+	}
+	return fs.Token.End()
+}
+func (fs *ForStatement) String() string {
+	var out strings.Builder
+	out.WriteString("for (")
+	if fs.Init != nil {
+		out.WriteString(strings.TrimSuffix(fs.Init.String(), ";"))
+	}
+	out.WriteString("; ")
+	if fs.Condition != nil {
+		out.WriteString(fs.Condition.String())
+	}
+	out.WriteString("; ")
+	if fs.Post != nil {
+		out.WriteString(strings.TrimSuffix(fs.Post.String(), ";"))
+	}
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+	return out.String()
+}
+
+// break statement
+type BreakStatement struct {
+	Token token.Token
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) Pos() token.Position  { return bs.Token.Pos() }
+func (bs *BreakStatement) End() token.Position  { return bs.Token.End() }
+func (bs *BreakStatement) String() string       { return "break;" }
+
+// continue statement
+type ContinueStatement struct {
+	Token token.Token
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) Pos() token.Position  { return cs.Token.Pos() }
+func (cs *ContinueStatement) End() token.Position  { return cs.Token.End() }
+func (cs *ContinueStatement) String() string       { return "continue;" }
+
+// array literal
+// [1, 2, 3]
+type ArrayLiteral struct {
+	Token    token.Token // the '[' token
+	Elements []Expression
+	Rbracket token.Token
+}
+
+func (al *ArrayLiteral) expressionNode()      {}
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos() }
+func (al *ArrayLiteral) End() token.Position {
+	if n := len(al.Elements); n > 0 {
+		return closedEnd(al.Rbracket, endOf(al.Elements[n-1], al.Token))
+	}
+	return closedEnd(al.Rbracket, al.Token.End())
+}
+func (al *ArrayLiteral) String() string {
+	elements := make([]string, 0, len(al.Elements))
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// index expression
+// a[i]
+type IndexExpression struct {
+	Token    token.Token // the '[' token
+	Left     Expression
+	Index    Expression
+	Rbracket token.Token
+}
+
+func (ie *IndexExpression) expressionNode()      {}
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position  { return posOf(ie.Left, ie.Token) }
+func (ie *IndexExpression) End() token.Position {
+	return closedEnd(ie.Rbracket, endOf(ie.Index, ie.Token))
+}
+func (ie *IndexExpression) String() string {
+	return "(" + ie.Left.String() + "[" + ie.Index.String() + "])"
+}
+
+// slice expression, both bounds are optional
+// a[1:3] | a[:2] | a[1:]
+type SliceExpression struct {
+	Token    token.Token // the '[' token
+	Left     Expression
+	Low      Expression
+	High     Expression
+	Rbracket token.Token
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) Pos() token.Position  { return posOf(se.Left, se.Token) }
+func (se *SliceExpression) End() token.Position {
+	switch {
+	case se.High != nil:
+		return closedEnd(se.Rbracket, se.High.End())
+	case se.Low != nil:
+		return closedEnd(se.Rbracket, se.Low.End())
+	}
+	return closedEnd(se.Rbracket, se.Token.End())
+}
+func (se *SliceExpression) String() string {
+	var out strings.Builder
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Low != nil {
+		out.WriteString(se.Low.String())
+	}
+	out.WriteString(":")
+	if se.High != nil {
+		out.WriteString(se.High.String())
+	}
+	out.WriteString("])")
+	return out.String()
+}
+
+// index assignment
+// a[i] = v
+type IndexAssignment struct {
+	Token  token.Token // the '=' token
+	Target *IndexExpression
+	Value  Expression
+}
+
+func (ia *IndexAssignment) statementNode()       {}
+func (ia *IndexAssignment) TokenLiteral() string { return ia.Token.Literal }
+func (ia *IndexAssignment) Pos() token.Position {
+	if ia.Target != nil {
+		return ia.Target.Pos()
+	}
+	return ia.Token.Pos()
+}
+func (ia *IndexAssignment) End() token.Position { return endOf(ia.Value, ia.Token) }
+func (ia *IndexAssignment) String() string {
+	return ia.Target.String() + " = " + ia.Value.String() + ";"
+}
+
+// hash literal, pairs keep their source order
+// {"a": 1, "b": 2}
+type HashLiteral struct {
+	Token  token.Token // the '{' token
+	Keys   []Expression
+	Values []Expression
+	Rbrace token.Token
+}
+
+func (hl *HashLiteral) expressionNode()      {}
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position  { return hl.Token.Pos() }
+func (hl *HashLiteral) End() token.Position {
+	if n := len(hl.Values); n > 0 {
+		return closedEnd(hl.Rbrace, endOf(hl.Values[n-1], hl.Token))
+	}
+	return closedEnd(hl.Rbrace, hl.Token.End())
+}
+func (hl *HashLiteral) String() string {
+	pairs := make([]string, 0, len(hl.Keys))
+	for i, key := range hl.Keys {
+		pairs = append(pairs, key.String()+": "+hl.Values[i].String())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// delete statement
+// delete m["key"]
+type DeleteStatement struct {
+	Token  token.Token
+	Target *IndexExpression
+}
+
+func (ds *DeleteStatement) statementNode()       {}
+func (ds *DeleteStatement) TokenLiteral() string { return ds.Token.Literal }
+func (ds *DeleteStatement) Pos() token.Position  { return ds.Token.Pos() }
+func (ds *DeleteStatement) End() token.Position {
+	if ds.Target != nil {
+		return ds.Target.End()
+	}
+	return ds.Token.End()
+}
+func (ds *DeleteStatement) String() string { return "delete " + ds.Target.String() + ";" }
+
+// start of a child node, tok of its parent stands in for a child that a
+// parse error left out
+func posOf(child Node, tok token.Token) token.Position {
+	if child == nil {
+		return tok.Pos()
+	}
+	return child.Pos()
+}
+
+// end of a child node, or of tok when the child is missing
+func endOf(child Node, tok token.Token) token.Position {
+	if child == nil {
+		return tok.End()
+	}
+	return child.End()
+}
+
+// end of a node closed by a bracket, last stands in when the node was built
+// without its closing token, as the optimizer does
+func closedEnd(closing token.Token, last token.Position) token.Position {
+	if closing.Pos().IsValid() {
+		return closing.End()
+	}
+	return last
+}
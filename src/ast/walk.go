@@ -0,0 +1,111 @@
+package ast
+
+// Inspect walks the tree below node in source order, calling f for every
+// node it reaches. when f returns false the node's children are skipped
+func Inspect(node Node, f func(Node) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, stmt := range n.Statements {
+			Inspect(stmt, f)
+		}
+	case *VariableDeclaration:
+		if n.Name != nil {
+			Inspect(n.Name, f)
+		}
+		if n.Type != nil {
+			Inspect(n.Type, f)
+		}
+		inspectExpression(n.Value, f)
+	case *IfExpression:
+		inspectExpression(n.Condition, f)
+		if n.Consequence != nil {
+			Inspect(n.Consequence, f)
+		}
+		if n.Alternative != nil {
+			Inspect(n.Alternative, f)
+		}
+	case *BlockStatement:
+		for _, stmt := range n.Statements {
+			Inspect(stmt, f)
+		}
+	case *PrintStatement:
+		inspectExpression(n.Value, f)
+	case *ExpressionStatement:
+		inspectExpression(n.Expression, f)
+	case *LogicalExpression:
+		inspectExpression(n.Left, f)
+		inspectExpression(n.Right, f)
+	case *InfixExpression:
+		inspectExpression(n.Left, f)
+		inspectExpression(n.Right, f)
+	case *PrefixExpression:
+		inspectExpression(n.Right, f)
+	case *ReturnStatement:
+		inspectExpression(n.ReturnValue, f)
+	case *FunctionLiteral:
+		for _, param := range n.Parameters {
+			Inspect(param, f)
+		}
+		if n.Body != nil {
+			Inspect(n.Body, f)
+		}
+	case *CallExpression:
+		inspectExpression(n.Function, f)
+		for _, arg := range n.Arguments {
+			inspectExpression(arg, f)
+		}
+	case *WhileStatement:
+		inspectExpression(n.Condition, f)
+		if n.Body != nil {
+			Inspect(n.Body, f)
+		}
+	case *ForStatement:
+		if n.Init != nil {
+			Inspect(n.Init, f)
+		}
+		inspectExpression(n.Condition, f)
+		if n.Body != nil {
+			Inspect(n.Body, f)
+		}
+		if n.Post != nil {
+			Inspect(n.Post, f)
+		}
+	case *ArrayLiteral:
+		for _, el := range n.Elements {
+			inspectExpression(el, f)
+		}
+	case *IndexExpression:
+		inspectExpression(n.Left, f)
+		inspectExpression(n.Index, f)
+	case *SliceExpression:
+		inspectExpression(n.Left, f)
+		inspectExpression(n.Low, f)
+		inspectExpression(n.High, f)
+	case *IndexAssignment:
+		if n.Target != nil {
+			Inspect(n.Target, f)
+		}
+		inspectExpression(n.Value, f)
+	case *HashLiteral:
+		for i, key := range n.Keys {
+			inspectExpression(key, f)
+			inspectExpression(n.Values[i], f)
+		}
+	case *DeleteStatement:
+		if n.Target != nil {
+			Inspect(n.Target, f)
+		}
+	}
+}
+
+// optional expressions and statements are nil interfaces, or typed nils left
+// behind by a parse error
+func inspectExpression(expr Expression, f func(Node) bool) {
+	if expr != nil {
+		Inspect(expr, f)
+	}
+}
@@ -0,0 +1,226 @@
+package compiler
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// bytecode instructions, an opcode byte followed by big endian operands
+type Instructions []byte
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota // push constants[c]
+	OpNull
+	OpTrue
+	OpFalse
+	OpPop // pop the top of the stack
+
+	// binary operators, pop right then left and push the result
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpPow
+	OpEqual
+	OpNotEqual
+	OpLess
+	OpGreater
+	OpLessEqual
+	OpGreaterEqual
+	OpInfix // any other operator, names[n] holds it
+
+	// unary operators
+	OpMinus
+	OpBang
+	OpPrefix // any other operator, names[n] holds it
+	OpToBool // replace the top of the stack with its truthiness
+
+	OpJump        // jump to an absolute offset
+	OpJumpIfFalse // pop, jump when the value is not truthy
+
+	// variables live in evaluator environments and are resolved by name
+	OpGetName      // push the value of names[n]
+	OpGetSlot      // push the value of names[n] from the slot (depth, index) assigned by the resolver
+	OpCheckBinding // const checks for names[n] before its value is evaluated, flag 1 for assignment
+	OpDeclare      // declare names[n] with type names[t] (NoType when untyped), flag 1 for const
+	OpAssign       // assign the nearest binding of names[n]
+	OpPushScope    // enter a block scope
+	OpPopScope     // leave a block scope
+
+	OpPrint // write the top of the stack to the output, leaving it in place
+
+	OpArray        // build an array from the top n values
+	OpHash         // build a hash from the top n key/value pairs
+	OpCheckHashKey // fail unless the top of the stack is hashable
+	OpIndex        // pop index and left, push left[index]
+	OpSetIndex     // pop value, index and left, store and push value
+	OpDelete       // pop index and left, delete and push null
+	OpSliceable    // fail unless the top of the stack can be sliced
+	OpSliceBound   // fail unless the top of the stack is a valid bound
+	OpSlice        // pop high, low and left, null bounds are missing
+
+	OpClosure     // push a function for constants[c] closing over the current scope
+	OpCall        // call the function below the top n arguments
+	OpReturnValue // return the top of the stack from the current function
+)
+
+// marks an untyped declaration in OpDeclare
+const NoType = 0xFFFF
+
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant:     {"OpConstant", []int{2}},
+	OpNull:         {"OpNull", []int{}},
+	OpTrue:         {"OpTrue", []int{}},
+	OpFalse:        {"OpFalse", []int{}},
+	OpPop:          {"OpPop", []int{}},
+	OpAdd:          {"OpAdd", []int{}},
+	OpSub:          {"OpSub", []int{}},
+	OpMul:          {"OpMul", []int{}},
+	OpDiv:          {"OpDiv", []int{}},
+	OpMod:          {"OpMod", []int{}},
+	OpPow:          {"OpPow", []int{}},
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpLess:         {"OpLess", []int{}},
+	OpGreater:      {"OpGreater", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpInfix:        {"OpInfix", []int{2}},
+	OpMinus:        {"OpMinus", []int{}},
+	OpBang:         {"OpBang", []int{}},
+	OpPrefix:       {"OpPrefix", []int{2}},
+	OpToBool:       {"OpToBool", []int{}},
+	OpJump:         {"OpJump", []int{2}},
+	OpJumpIfFalse:  {"OpJumpIfFalse", []int{2}},
+	OpGetName:      {"OpGetName", []int{2}},
+	OpGetSlot:      {"OpGetSlot", []int{2, 2, 2}},
+	OpCheckBinding: {"OpCheckBinding", []int{2, 1}},
+	OpDeclare:      {"OpDeclare", []int{2, 2, 1}},
+	OpAssign:       {"OpAssign", []int{2}},
+	OpPushScope:    {"OpPushScope", []int{}},
+	OpPopScope:     {"OpPopScope", []int{}},
+	OpPrint:        {"OpPrint", []int{}},
+	OpArray:        {"OpArray", []int{2}},
+	OpHash:         {"OpHash", []int{2}},
+	OpCheckHashKey: {"OpCheckHashKey", []int{}},
+	OpIndex:        {"OpIndex", []int{}},
+	OpSetIndex:     {"OpSetIndex", []int{}},
+	OpDelete:       {"OpDelete", []int{}},
+	OpSliceable:    {"OpSliceable", []int{}},
+	OpSliceBound:   {"OpSliceBound", []int{}},
+	OpSlice:        {"OpSlice", []int{}},
+	OpClosure:      {"OpClosure", []int{2}},
+	OpCall:         {"OpCall", []int{1}},
+	OpReturnValue:  {"OpReturnValue", []int{}},
+}
+
+// looks up the definition of an opcode
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// encodes one instruction
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	length := 1
+	for _, w := range def.OperandWidths {
+		length += w
+	}
+
+	instruction := make([]byte, length)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// reports the first operand of an instruction too large for its width, Make
+// would silently truncate it
+func CheckOperands(op Opcode, operands ...int) error {
+	def, ok := definitions[op]
+	if !ok {
+		return fmt.Errorf("opcode %d undefined", op)
+	}
+	for i, o := range operands {
+		if limit := 1<<(8*def.OperandWidths[i]) - 1; o < 0 || o > limit {
+			return fmt.Errorf("%s operand %d is out of range 0..%d", def.Name, o, limit)
+		}
+	}
+	return nil
+}
+
+// decodes the operands of an instruction and reports how many bytes they used
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ins[offset])
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+// disassembles the instructions, one per line prefixed with its offset
+func (ins Instructions) String() string {
+	var out strings.Builder
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s", i, def.Name)
+		for _, o := range operands {
+			fmt.Fprintf(&out, " %d", o)
+		}
+		out.WriteString("\n")
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
@@ -0,0 +1,647 @@
+package compiler
+
+import (
+	"fmt"
+	"lexicon/src/ast"
+	"lexicon/src/evaluator"
+	"lexicon/src/token"
+	"strings"
+)
+
+const COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+
+// function body lowered to bytecode, stored in the constant pool
+type CompiledFunction struct {
+	Instructions Instructions
+	Tokens       map[int]token.Token // source position of instructions that can fail
+	Parameters   []string
+	Literal      *ast.FunctionLiteral // nil for the program itself
+	Bytecode     *Bytecode            // pools the operands refer to
+}
+
+func (cf *CompiledFunction) Type() evaluator.ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// output of the compiler, Main holds the top level statements
+type Bytecode struct {
+	Main      *CompiledFunction
+	Constants []evaluator.Object
+	Names     []string
+}
+
+// instructions of one function being compiled
+type compilationScope struct {
+	instructions Instructions
+	tokens       map[int]token.Token
+	blockDepth   int // block scopes opened by OpPushScope
+	loops        []*loopContext
+}
+
+// jumps of a loop waiting for their target
+type loopContext struct {
+	blockDepth int
+	breaks     []int
+	continues  []int
+}
+
+type Compiler struct {
+	constants []evaluator.Object
+	names     []string
+	nameIndex map[string]int
+	scopes    []*compilationScope
+	err       error // the first operand that did not fit its instruction
+}
+
+func New() *Compiler {
+	return &Compiler{
+		nameIndex: make(map[string]int),
+		scopes:    []*compilationScope{newCompilationScope()},
+	}
+}
+
+func newCompilationScope() *compilationScope {
+	return &compilationScope{tokens: make(map[int]token.Token)}
+}
+
+// compiles a program in one call
+func Compile(program *ast.Program) (*Bytecode, error) {
+	c := New()
+	if err := c.Compile(program); err != nil {
+		return nil, err
+	}
+	return c.Bytecode(), nil
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	scope := c.scope()
+	bytecode := &Bytecode{
+		Main:      &CompiledFunction{Instructions: scope.instructions, Tokens: scope.tokens},
+		Constants: c.constants,
+		Names:     c.names,
+	}
+
+	// closures outlive the run that created them, so functions keep their own pools
+	bytecode.Main.Bytecode = bytecode
+	for _, constant := range c.constants {
+		if fn, ok := constant.(*CompiledFunction); ok {
+			fn.Bytecode = bytecode
+		}
+	}
+	return bytecode
+}
+
+// compiles a node, every statement and expression leaves exactly one value on the stack
+func (c *Compiler) Compile(node ast.Node) error {
+	switch node := node.(type) {
+
+	// program node
+	case *ast.Program:
+		if err := c.compileStatements(node.Statements); err != nil {
+			return err
+		}
+		c.emit(OpReturnValue)
+		if c.err != nil {
+			return c.err
+		}
+
+	// statements
+	case *ast.VariableDeclaration:
+		name := c.name(node.Name.Value)
+		c.emitAt(node.Name.Token, OpCheckBinding, name, boolOperand(node.IsAssignment()))
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		if node.IsAssignment() {
+			c.emitAt(node.Name.Token, OpAssign, name)
+		} else {
+			typ := NoType
+			if node.Type != nil {
+				typ = c.name(node.Type.Value)
+			}
+			c.emitAt(node.Name.Token, OpDeclare, name, typ, boolOperand(node.IsConstant()))
+		}
+
+	case *ast.PrintStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(OpPrint)
+
+	case *ast.ExpressionStatement:
+		if node.Expression == nil {
+			c.emit(OpNull)
+			return nil
+		}
+		return c.Compile(node.Expression)
+
+	case *ast.IfExpression:
+		return c.compileIf(node)
+
+	case *ast.BlockStatement:
+		return c.compileScopedBlock(node)
+
+	case *ast.ReturnStatement:
+		if node.ReturnValue == nil {
+			c.emit(OpNull)
+		} else if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		c.emit(OpReturnValue)
+
+	case *ast.WhileStatement:
+		return c.compileWhile(node)
+
+	case *ast.ForStatement:
+		return c.compileFor(node)
+
+	case *ast.BreakStatement:
+		return c.compileLoopJump(node.Token, true)
+
+	case *ast.ContinueStatement:
+		return c.compileLoopJump(node.Token, false)
+
+	case *ast.IndexAssignment:
+		if err := c.compileAll(node.Target.Left, node.Target.Index, node.Value); err != nil {
+			return err
+		}
+		c.emitAt(node.Target.Token, OpSetIndex)
+
+	case *ast.DeleteStatement:
+		if err := c.compileAll(node.Target.Left, node.Target.Index); err != nil {
+			return err
+		}
+		c.emitAt(node.Target.Token, OpDelete)
+
+	// expressions
+	case *ast.IntegerLiteral:
+		c.emit(OpConstant, c.constant(&evaluator.Integer{Value: node.Value}))
+
+	case *ast.FloatLiteral:
+		c.emit(OpConstant, c.constant(&evaluator.Float{Value: node.Value}))
+
+	case *ast.StringLiteral:
+		c.emit(OpConstant, c.constant(&evaluator.String{Value: node.Value}))
+
+	case *ast.BooleanLiteral:
+		if node.Value {
+			c.emit(OpTrue)
+		} else {
+			c.emit(OpFalse)
+		}
+
+	case *ast.Identifier:
+		if node.Slot.Resolved {
+			c.emitAt(node.Token, OpGetSlot, c.name(node.Value), node.Slot.Depth, node.Slot.Index)
+		} else {
+			c.emitAt(node.Token, OpGetName, c.name(node.Value))
+		}
+
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		switch node.Operator {
+		case "-":
+			c.emitAt(node.Token, OpMinus)
+		case "!":
+			c.emitAt(node.Token, OpBang)
+		default:
+			c.emitAt(node.Token, OpPrefix, c.name(node.Operator))
+		}
+
+	case *ast.InfixExpression:
+		if err := c.compileAll(node.Left, node.Right); err != nil {
+			return err
+		}
+		if op, ok := infixOpcodes[node.Operator]; ok {
+			c.emitAt(node.Token, op)
+		} else {
+			c.emitAt(node.Token, OpInfix, c.name(node.Operator))
+		}
+
+	case *ast.LogicalExpression:
+		return c.compileLogical(node)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node)
+
+	case *ast.CallExpression:
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+		if err := c.compileAll(node.Arguments...); err != nil {
+			return err
+		}
+		c.emitAt(node.Token, OpCall, len(node.Arguments))
+
+	case *ast.ArrayLiteral:
+		if err := c.compileAll(node.Elements...); err != nil {
+			return err
+		}
+		c.emit(OpArray, len(node.Elements))
+
+	case *ast.IndexExpression:
+		if err := c.compileAll(node.Left, node.Index); err != nil {
+			return err
+		}
+		c.emitAt(node.Token, OpIndex)
+
+	case *ast.SliceExpression:
+		return c.compileSlice(node)
+
+	case *ast.HashLiteral:
+		for i, key := range node.Keys {
+			if err := c.Compile(key); err != nil {
+				return err
+			}
+			c.emitAt(node.Token, OpCheckHashKey)
+			if err := c.Compile(node.Values[i]); err != nil {
+				return err
+			}
+		}
+		c.emit(OpHash, len(node.Keys))
+
+	default:
+		return fmt.Errorf("cannot compile %T", node)
+	}
+
+	return nil
+}
+
+var infixOpcodes = map[string]Opcode{
+	"+":  OpAdd,
+	"-":  OpSub,
+	"*":  OpMul,
+	"/":  OpDiv,
+	"%":  OpMod,
+	"**": OpPow,
+	"==": OpEqual,
+	"!=": OpNotEqual,
+	"<":  OpLess,
+	">":  OpGreater,
+	"<=": OpLessEqual,
+	">=": OpGreaterEqual,
+}
+
+// compiles statements so that only the value of the last one stays on the stack
+func (c *Compiler) compileStatements(statements []ast.Statement) error {
+	if len(statements) == 0 {
+		c.emit(OpNull)
+		return nil
+	}
+
+	for i, stmt := range statements {
+		if err := c.Compile(stmt); err != nil {
+			return err
+		}
+		if i < len(statements)-1 {
+			c.emit(OpPop)
+		}
+	}
+	return nil
+}
+
+// compiles a block in its own scope, like the evaluator does for every block
+func (c *Compiler) compileScopedBlock(block *ast.BlockStatement) error {
+	scope := c.scope()
+	c.emit(OpPushScope)
+	scope.blockDepth++
+
+	if err := c.compileStatements(block.Statements); err != nil {
+		return err
+	}
+
+	scope.blockDepth--
+	c.emit(OpPopScope)
+	return nil
+}
+
+func (c *Compiler) compileAll(nodes ...ast.Expression) error {
+	for _, node := range nodes {
+		if err := c.Compile(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// if (cond) { } else { }, a missing else produces null
+func (c *Compiler) compileIf(node *ast.IfExpression) error {
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+	jumpIfFalse := c.emit(OpJumpIfFalse, 0)
+
+	if err := c.compileScopedBlock(node.Consequence); err != nil {
+		return err
+	}
+	jump := c.emit(OpJump, 0)
+
+	c.patchJump(jumpIfFalse, c.pos())
+	if node.Alternative != nil {
+		if err := c.compileScopedBlock(node.Alternative); err != nil {
+			return err
+		}
+	} else {
+		c.emit(OpNull)
+	}
+	c.patchJump(jump, c.pos())
+	return nil
+}
+
+// && and || skip the right operand once the left decides the result
+func (c *Compiler) compileLogical(node *ast.LogicalExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+	jumpIfFalse := c.emit(OpJumpIfFalse, 0)
+
+	if node.Operator == "&&" {
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(OpToBool)
+		jump := c.emit(OpJump, 0)
+		c.patchJump(jumpIfFalse, c.pos())
+		c.emit(OpFalse)
+		c.patchJump(jump, c.pos())
+		return nil
+	}
+
+	c.emit(OpTrue)
+	jump := c.emit(OpJump, 0)
+	c.patchJump(jumpIfFalse, c.pos())
+	if err := c.Compile(node.Right); err != nil {
+		return err
+	}
+	c.emit(OpToBool)
+	c.patchJump(jump, c.pos())
+	return nil
+}
+
+// while (cond) { }, loops produce null
+func (c *Compiler) compileWhile(node *ast.WhileStatement) error {
+	start := c.pos()
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+	exit := c.emit(OpJumpIfFalse, 0)
+
+	loop := c.enterLoop()
+	if err := c.compileScopedBlock(node.Body); err != nil {
+		return err
+	}
+	c.emit(OpPop)
+	c.emit(OpJump, start)
+	c.leaveLoop(loop, start)
+
+	c.patchJump(exit, c.pos())
+	c.patchLoopExits(loop)
+	c.emit(OpNull)
+	return nil
+}
+
+// for (init; cond; post) { }, the init clause gets its own scope
+func (c *Compiler) compileFor(node *ast.ForStatement) error {
+	scope := c.scope()
+	c.emit(OpPushScope)
+	scope.blockDepth++
+
+	if node.Init != nil {
+		if err := c.Compile(node.Init); err != nil {
+			return err
+		}
+		c.emit(OpPop)
+	}
+
+	start := c.pos()
+	exit := -1
+	if node.Condition != nil {
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+		exit = c.emit(OpJumpIfFalse, 0)
+	}
+
+	loop := c.enterLoop()
+	if err := c.compileScopedBlock(node.Body); err != nil {
+		return err
+	}
+	c.emit(OpPop)
+
+	post := c.pos()
+	if node.Post != nil {
+		if err := c.Compile(node.Post); err != nil {
+			return err
+		}
+		c.emit(OpPop)
+	}
+	c.emit(OpJump, start)
+	c.leaveLoop(loop, post)
+
+	if exit >= 0 {
+		c.patchJump(exit, c.pos())
+	}
+	c.patchLoopExits(loop)
+
+	scope.blockDepth--
+	c.emit(OpPopScope)
+	c.emit(OpNull)
+	return nil
+}
+
+// break and continue leave the block scopes opened inside the loop, then jump
+func (c *Compiler) compileLoopJump(tok token.Token, isBreak bool) error {
+	scope := c.scope()
+	if len(scope.loops) == 0 {
+		return fmt.Errorf("[Line %d:%d] %s outside loop", tok.Line, tok.Column, tok.Literal)
+	}
+	loop := scope.loops[len(scope.loops)-1]
+
+	for i := scope.blockDepth; i > loop.blockDepth; i-- {
+		c.emit(OpPopScope)
+	}
+	jump := c.emit(OpJump, 0)
+	if isBreak {
+		loop.breaks = append(loop.breaks, jump)
+	} else {
+		loop.continues = append(loop.continues, jump)
+	}
+	return nil
+}
+
+func (c *Compiler) enterLoop() *loopContext {
+	scope := c.scope()
+	loop := &loopContext{blockDepth: scope.blockDepth}
+	scope.loops = append(scope.loops, loop)
+	return loop
+}
+
+// closes the innermost loop and points its continue jumps at target
+func (c *Compiler) leaveLoop(loop *loopContext, target int) {
+	scope := c.scope()
+	scope.loops = scope.loops[:len(scope.loops)-1]
+	for _, jump := range loop.continues {
+		c.patchJump(jump, target)
+	}
+}
+
+// points the break jumps of a loop at the current position, where the loop produces null
+func (c *Compiler) patchLoopExits(loop *loopContext) {
+	for _, jump := range loop.breaks {
+		c.patchJump(jump, c.pos())
+	}
+}
+
+// a[low:high], missing bounds are pushed as null
+func (c *Compiler) compileSlice(node *ast.SliceExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+	c.emitAt(node.Token, OpSliceable)
+
+	for _, bound := range []ast.Expression{node.Low, node.High} {
+		if bound == nil {
+			c.emit(OpNull)
+			continue
+		}
+		if err := c.Compile(bound); err != nil {
+			return err
+		}
+		c.emitAt(node.Token, OpSliceBound)
+	}
+
+	c.emitAt(node.Token, OpSlice)
+	return nil
+}
+
+// fn(a) { }, parameters and the body share one scope
+func (c *Compiler) compileFunction(node *ast.FunctionLiteral) error {
+	c.scopes = append(c.scopes, newCompilationScope())
+	if err := c.compileStatements(node.Body.Statements); err != nil {
+		return err
+	}
+	c.emit(OpReturnValue)
+
+	scope := c.scope()
+	c.scopes = c.scopes[:len(c.scopes)-1]
+
+	params := make([]string, len(node.Parameters))
+	for i, p := range node.Parameters {
+		params[i] = p.Value
+	}
+	fn := &CompiledFunction{
+		Instructions: scope.instructions,
+		Tokens:       scope.tokens,
+		Parameters:   params,
+		Literal:      node,
+	}
+	c.emit(OpClosure, c.constant(fn))
+	return nil
+}
+
+func (c *Compiler) scope() *compilationScope {
+	return c.scopes[len(c.scopes)-1]
+}
+
+func (c *Compiler) pos() int {
+	return len(c.scope().instructions)
+}
+
+// appends an instruction and returns its offset
+func (c *Compiler) emit(op Opcode, operands ...int) int {
+	return c.add(token.Token{}, op, operands)
+}
+
+// appends an instruction that can fail, errors are reported at tok
+func (c *Compiler) emitAt(tok token.Token, op Opcode, operands ...int) int {
+	pos := c.add(tok, op, operands)
+	c.scope().tokens[pos] = tok
+	return pos
+}
+
+func (c *Compiler) add(tok token.Token, op Opcode, operands []int) int {
+	c.checkOperands(tok, op, operands)
+	pos := c.pos()
+	scope := c.scope()
+	scope.instructions = append(scope.instructions, Make(op, operands...)...)
+	return pos
+}
+
+func (c *Compiler) patchJump(pos, target int) {
+	ins := c.scope().instructions
+	op := Opcode(ins[pos])
+	c.checkOperands(token.Token{}, op, []int{target})
+	copy(ins[pos:], Make(op, target))
+}
+
+// what an operand counts, for errors about operands that do not fit
+var operandLimits = map[Opcode]string{
+	OpConstant:    "constants",
+	OpClosure:     "constants",
+	OpJump:        "instructions in one function",
+	OpJumpIfFalse: "instructions in one function",
+	OpCall:        "arguments in one call",
+	OpArray:       "array elements",
+	OpHash:        "hash pairs",
+	OpGetSlot:     "variables in one scope",
+}
+
+// records the first operand too large for its instruction, the bytecode
+// would otherwise refer to the wrong constant, variable or offset
+func (c *Compiler) checkOperands(tok token.Token, op Opcode, operands []int) {
+	if c.err != nil {
+		return
+	}
+	err := CheckOperands(op, operands...)
+	if err == nil {
+		return
+	}
+	what, ok := operandLimits[op]
+	if !ok {
+		what = "names"
+	}
+	if tok.Line > 0 {
+		c.err = fmt.Errorf("[Line %d:%d] too many %s: %s", tok.Line, tok.Column, what, err)
+	} else {
+		c.err = fmt.Errorf("too many %s: %s", what, err)
+	}
+}
+
+func (c *Compiler) constant(obj evaluator.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// interns a variable, type or operator name
+func (c *Compiler) name(name string) int {
+	if idx, ok := c.nameIndex[name]; ok {
+		return idx
+	}
+	c.names = append(c.names, name)
+	c.nameIndex[name] = len(c.names) - 1
+	return len(c.names) - 1
+}
+
+func boolOperand(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// lists the constant pool and the disassembly of every function, for debugging
+func (b *Bytecode) String() string {
+	var out strings.Builder
+	out.WriteString("main:\n")
+	out.WriteString(b.Main.Instructions.String())
+	for i, constant := range b.Constants {
+		if fn, ok := constant.(*CompiledFunction); ok {
+			fmt.Fprintf(&out, "constant %d: %s\n", i, fn.Literal.String())
+			out.WriteString(fn.Instructions.String())
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,160 @@
+package compiler
+
+import (
+	"lexicon/src/evaluator"
+	"lexicon/src/lexer"
+	"lexicon/src/parser"
+	"strings"
+	"testing"
+)
+
+func TestMakeAndReadOperands(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		bytes    int
+	}{
+		{OpConstant, []int{65534}, 2},
+		{OpDeclare, []int{3, NoType, 1}, 5},
+		{OpCall, []int{255}, 1},
+		{OpAdd, []int{}, 0},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+		def, err := Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("definition not found: %s", err)
+		}
+
+		operands, read := ReadOperands(def, instruction[1:])
+		if read != tt.bytes {
+			t.Errorf("%s: expected %d operand bytes, got=%d", def.Name, tt.bytes, read)
+		}
+		for i, want := range tt.operands {
+			if operands[i] != want {
+				t.Errorf("%s: operand %d wrong. expected=%d, got=%d", def.Name, i, want, operands[i])
+			}
+		}
+	}
+}
+
+func TestCompileProgram(t *testing.T) {
+	input := `sprout x int = 1;
+while (x < 3) { x = x + 1; }
+x;`
+
+	bytecode := compile(t, input)
+
+	expected := `0000 OpCheckBinding 0 0
+0004 OpConstant 0
+0007 OpDeclare 0 1 0
+0013 OpPop
+0014 OpGetName 0
+0017 OpConstant 1
+0020 OpLess
+0021 OpJumpIfFalse 44
+0024 OpPushScope
+0025 OpCheckBinding 0 1
+0029 OpGetName 0
+0032 OpConstant 2
+0035 OpAdd
+0036 OpAssign 0
+0039 OpPopScope
+0040 OpPop
+0041 OpJump 14
+0044 OpNull
+0045 OpPop
+0046 OpGetName 0
+0049 OpReturnValue
+`
+	if got := bytecode.Main.Instructions.String(); got != expected {
+		t.Errorf("wrong instructions.\nexpected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	if len(bytecode.Names) != 2 || bytecode.Names[0] != "x" || bytecode.Names[1] != "int" {
+		t.Errorf("wrong names, got=%v", bytecode.Names)
+	}
+	if len(bytecode.Constants) != 3 {
+		t.Fatalf("expected 3 constants, got=%d", len(bytecode.Constants))
+	}
+	if c, ok := bytecode.Constants[1].(*evaluator.Integer); !ok || c.Value != 3 {
+		t.Errorf("wrong constant, got=%v", bytecode.Constants[1])
+	}
+}
+
+func TestCompileFunction(t *testing.T) {
+	bytecode := compile(t, "sprout f = fn(a, b) { return a; };")
+
+	fn, ok := bytecode.Constants[0].(*CompiledFunction)
+	if !ok {
+		t.Fatalf("constant is not *CompiledFunction. got=%T", bytecode.Constants[0])
+	}
+	if len(fn.Parameters) != 2 || fn.Parameters[0] != "a" || fn.Parameters[1] != "b" {
+		t.Errorf("wrong parameters, got=%v", fn.Parameters)
+	}
+	if fn.Bytecode != bytecode {
+		t.Errorf("function does not point at its bytecode")
+	}
+
+	expected := "0000 OpGetName 1\n0003 OpReturnValue\n0004 OpReturnValue\n"
+	if got := fn.Instructions.String(); got != expected {
+		t.Errorf("wrong function instructions.\nexpected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestFailingInstructionsKeepTheirPosition(t *testing.T) {
+	bytecode := compile(t, "sprout a = 1;\na + true;")
+
+	tok, ok := bytecode.Main.Tokens[18]
+	if !ok || tok.Literal != "+" || tok.Line != 2 {
+		t.Errorf("expected OpAdd to keep the + token, got=%+v (found=%t)\n%s", tok, ok, bytecode.Main.Instructions)
+	}
+}
+
+// operands that do not fit their instruction fail to compile instead of
+// wrapping around
+func TestOperandLimits(t *testing.T) {
+	arguments := func(n int) string {
+		return "f(" + strings.Repeat("1, ", n-1) + "1);"
+	}
+	tests := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{"65536 constants", strings.Repeat("1;", 65536), ""},
+		{"65537 constants", strings.Repeat("1;", 65537), "too many constants: OpConstant operand 65536 is out of range 0..65535"},
+		{"255 arguments", arguments(255), ""},
+		{"256 arguments", arguments(256), "[Line 1:2] too many arguments in one call: OpCall operand 256 is out of range 0..255"},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) > 0 {
+			t.Fatalf("%s: parser errors: %v", tt.name, p.Errors())
+		}
+		_, err := Compile(program)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %s", tt.name, err)
+		case tt.err != "" && (err == nil || err.Error() != tt.err):
+			t.Errorf("%s: expected error %q, got=%v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func compile(t *testing.T, input string) *Bytecode {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	bytecode, err := Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return bytecode
+}
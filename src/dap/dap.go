@@ -0,0 +1,475 @@
+// Package dap implements a Debug Adapter Protocol server for Sprout. Editors
+// launch a .spr file through it and drive the debugger package: breakpoints,
+// stepping, the call stack and the scopes of the Environment chain. The
+// program runs on the tree-walking evaluator in its own goroutine while the
+// server keeps answering requests.
+package dap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"lexicon/src/ast"
+	"lexicon/src/debugger"
+	"lexicon/src/diagnostic"
+	"lexicon/src/evaluator"
+	"lexicon/src/framing"
+	"lexicon/src/lexer"
+	"lexicon/src/parser"
+	"lexicon/src/resolver"
+	"lexicon/src/typecheck"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// the program is the only thread
+const THREAD_ID = 1
+
+// Server answers the requests of one debug session
+type Server struct {
+	in *bufio.Reader
+
+	writeMu sync.Mutex // guards out and seq, events come from the program too
+	out     io.Writer
+	seq     int
+
+	// the launched program
+	path       string
+	source     string
+	program    *ast.Program
+	statements map[int]bool // lines where a statement starts
+	debugger   *debugger.Debugger
+	env        *evaluator.Environment
+	ctx        context.Context // cancelled to stop the program
+	cancel     context.CancelFunc
+	resume     chan debugger.Action
+	resuming   *debugger.Action // sent to the program once the request is answered
+	done       chan struct{}    // closed when the program has finished
+	started    bool             // configurationDone has run the program
+
+	stateMu    sync.Mutex // guards the fields below
+	stop       *debugger.Stop
+	references map[int]*evaluator.Environment // variablesReference to scope, valid while paused
+	reference  int                            // last variablesReference handed out
+}
+
+// creates a server reading requests from in and writing replies to out
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{in: bufio.NewReader(in), out: out}
+}
+
+// Run serves requests until the client disconnects. a program still running
+// when the stream ends is stopped
+func (s *Server) Run() error {
+	defer s.terminate()
+	for {
+		body, err := framing.Read(s.in)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return errors.New("connection closed before disconnect")
+			}
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			return fmt.Errorf("invalid message: %v", err)
+		}
+		if req.Type != "request" {
+			continue
+		}
+
+		result, err := s.handle(req)
+		if err != nil {
+			s.respond(req, false, err.Error(), nil)
+			continue
+		}
+		s.respond(req, true, "", result)
+		if req.Command == "disconnect" {
+			return nil
+		}
+		s.after(req.Command)
+	}
+}
+
+// dispatches a request and returns the body of its response
+func (s *Server) handle(req request) (interface{}, error) {
+	switch req.Command {
+	case "initialize":
+		return map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers":        true,
+			"supportsTerminateRequest":         true,
+		}, nil
+
+	case "launch":
+		var args LaunchArguments
+		if err := decode(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return nil, s.launch(args)
+
+	case "setBreakpoints":
+		var args SetBreakpointsArguments
+		if err := decode(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.setBreakpoints(args)
+
+	case "configurationDone":
+		if s.program == nil {
+			return nil, errors.New("no program launched")
+		}
+		if s.started {
+			return nil, errors.New("the program has already started")
+		}
+		s.started = true
+		return nil, nil
+
+	case "threads":
+		return map[string]interface{}{"threads": []Thread{{ID: THREAD_ID, Name: "main"}}}, nil
+
+	case "continue":
+		return map[string]interface{}{"allThreadsContinued": true}, s.resumeWith(debugger.Continue)
+	case "next":
+		return nil, s.resumeWith(debugger.StepOver)
+	case "stepIn":
+		return nil, s.resumeWith(debugger.StepInto)
+	case "stepOut":
+		return nil, s.resumeWith(debugger.StepOut)
+
+	case "stackTrace":
+		return s.stackTrace()
+
+	case "scopes":
+		var args ScopesArguments
+		if err := decode(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.scopes(args.FrameID)
+
+	case "variables":
+		var args VariablesArguments
+		if err := decode(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.variables(args.VariablesReference)
+
+	case "evaluate":
+		var args EvaluateArguments
+		if err := decode(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.evaluate(args)
+
+	case "terminate", "disconnect":
+		s.terminate()
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unsupported command: %s", req.Command)
+}
+
+// sends the events that must follow a successful response
+func (s *Server) after(command string) {
+	switch command {
+	case "initialize":
+		// the client may now send breakpoints and then configurationDone
+		s.event("initialized", nil)
+	case "configurationDone":
+		s.start()
+	case "continue", "next", "stepIn", "stepOut":
+		action := *s.resuming
+		s.resuming = nil
+		s.resume <- action
+	}
+}
+
+// reads, parses and type checks the program, it starts on configurationDone
+func (s *Server) launch(args LaunchArguments) error {
+	if s.program != nil {
+		return errors.New("a program is already launched")
+	}
+	input, err := os.ReadFile(args.Program)
+	if err != nil {
+		return err
+	}
+	source := string(input)
+
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	diagnostics := p.Diagnostics()
+	if len(diagnostics) == 0 {
+		checker := typecheck.New()
+		checker.Check(program)
+		diagnostics = checker.Diagnostics()
+	}
+	if len(diagnostics) > 0 {
+		var out bytes.Buffer
+		diagnostic.NewRenderer(args.Program, source).RenderAll(&out, diagnostics)
+		return errors.New(out.String())
+	}
+	resolver.Resolve(program, nil)
+
+	s.path, s.source, s.program = args.Program, source, program
+	// the debugger pauses before the statements of programs and blocks
+	s.statements = make(map[int]bool)
+	ast.Inspect(program, func(node ast.Node) bool {
+		var statements []ast.Statement
+		switch node := node.(type) {
+		case *ast.Program:
+			statements = node.Statements
+		case *ast.BlockStatement:
+			statements = node.Statements
+		}
+		for _, stmt := range statements {
+			s.statements[stmt.Pos().Line] = true
+		}
+		return true
+	})
+
+	s.resume = make(chan debugger.Action)
+	s.done = make(chan struct{})
+	s.debugger = debugger.New(s.pause)
+	s.debugger.StopOnEntry = args.StopOnEntry
+	s.env = evaluator.NewEnvironment()
+	s.env.SetExecContext(evaluator.NewExecContext(&output{s, "stdout"}, &output{s, "stderr"}))
+	s.debugger.Attach(s.env)
+	return nil
+}
+
+// runs the launched program until it ends or is stopped
+func (s *Server) start() {
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	go func() {
+		defer close(s.done)
+		result := evaluator.EvalContext(s.ctx, s.program, s.env)
+
+		exitCode := 0
+		if err, ok := result.(*evaluator.Error); ok {
+			exitCode = 1
+			if err.Code != evaluator.CANCELLED {
+				var out bytes.Buffer
+				diagnostic.NewRenderer(s.path, s.source).Render(&out, err.Diagnostic())
+				s.event("output", map[string]interface{}{"category": "stderr", "output": out.String()})
+			}
+		}
+		s.event("exited", map[string]interface{}{"exitCode": exitCode})
+		s.event("terminated", nil)
+	}()
+}
+
+// stops a running program and waits for it to end
+func (s *Server) terminate() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+}
+
+// called by the debugger on the program's goroutine, blocks until the
+// client resumes the program
+func (s *Server) pause(stop *debugger.Stop) debugger.Action {
+	s.stateMu.Lock()
+	s.stop = stop
+	s.references = make(map[int]*evaluator.Environment)
+	s.stateMu.Unlock()
+
+	s.event("stopped", map[string]interface{}{
+		"reason":            stop.Reason,
+		"threadId":          THREAD_ID,
+		"allThreadsStopped": true,
+	})
+	select {
+	case action := <-s.resume:
+		return action
+	case <-s.ctx.Done():
+		return debugger.Quit
+	}
+}
+
+// resumes a paused program
+func (s *Server) resumeWith(action debugger.Action) error {
+	s.stateMu.Lock()
+	paused := s.stop != nil
+	s.stop = nil
+	s.references = nil
+	s.stateMu.Unlock()
+	if !paused {
+		return errors.New("the program is not paused")
+	}
+	// the response goes out before the program can stop again
+	s.resuming = &action
+	return nil
+}
+
+// the stop the program is paused at
+func (s *Server) paused() (*debugger.Stop, error) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	if s.stop == nil {
+		return nil, errors.New("the program is not paused")
+	}
+	return s.stop, nil
+}
+
+func (s *Server) setBreakpoints(args SetBreakpointsArguments) (interface{}, error) {
+	if s.program == nil {
+		return nil, errors.New("no program launched")
+	}
+	lines := make([]int, 0, len(args.Breakpoints))
+	breakpoints := make([]Breakpoint, 0, len(args.Breakpoints))
+	for _, b := range args.Breakpoints {
+		bp := Breakpoint{Verified: s.statements[b.Line], Line: b.Line}
+		if bp.Verified {
+			lines = append(lines, b.Line)
+		} else {
+			bp.Message = "no statement starts on this line"
+		}
+		breakpoints = append(breakpoints, bp)
+	}
+	s.debugger.SetBreakpoints(lines)
+	return map[string]interface{}{"breakpoints": breakpoints}, nil
+}
+
+// frame ids are 1 for the innermost frame and count outwards
+func (s *Server) stackTrace() (interface{}, error) {
+	stop, err := s.paused()
+	if err != nil {
+		return nil, err
+	}
+	frames := make([]StackFrame, len(stop.Frames))
+	for i, frame := range stop.Frames {
+		frames[i] = StackFrame{
+			ID:     i + 1,
+			Name:   frame.Name,
+			Source: &Source{Name: filepath.Base(s.path), Path: s.path},
+			Line:   frame.Line,
+			Column: 1,
+		}
+	}
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil
+}
+
+func (s *Server) frame(id int) (debugger.Frame, error) {
+	stop, err := s.paused()
+	if err != nil {
+		return debugger.Frame{}, err
+	}
+	if id < 1 || id > len(stop.Frames) {
+		return debugger.Frame{}, fmt.Errorf("unknown frame %d", id)
+	}
+	return stop.Frames[id-1], nil
+}
+
+// one scope for every Environment of the frame's chain, innermost first
+func (s *Server) scopes(frameID int) (interface{}, error) {
+	frame, err := s.frame(frameID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	var envs []*evaluator.Environment
+	for env := frame.Env; env != nil; env = env.Outer() {
+		envs = append(envs, env)
+	}
+	scopes := make([]Scope, len(envs))
+	for i, env := range envs {
+		name := "Locals"
+		switch {
+		case i == len(envs)-1:
+			name = "Globals"
+		case i > 0:
+			name = fmt.Sprintf("Outer %d", i)
+		}
+		s.reference++
+		s.references[s.reference] = env
+		scopes[i] = Scope{Name: name, VariablesReference: s.reference}
+	}
+	return map[string]interface{}{"scopes": scopes}, nil
+}
+
+func (s *Server) variables(reference int) (interface{}, error) {
+	s.stateMu.Lock()
+	env, ok := s.references[reference]
+	s.stateMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown variables reference %d", reference)
+	}
+
+	store := env.GetStore()
+	names := env.Names()
+	variables := make([]Variable, 0, len(names))
+	for _, name := range names {
+		value := store[name]
+		variables = append(variables, Variable{Name: name, Value: value.Inspect(), Type: string(value.Type())})
+	}
+	return map[string]interface{}{"variables": variables}, nil
+}
+
+// evaluates an expression in a paused frame, the innermost one by default
+func (s *Server) evaluate(args EvaluateArguments) (interface{}, error) {
+	if args.FrameID == 0 {
+		args.FrameID = 1
+	}
+	frame, err := s.frame(args.FrameID)
+	if err != nil {
+		return nil, err
+	}
+	result := s.debugger.Evaluate(args.Expression, frame.Env)
+	if err, ok := result.(*evaluator.Error); ok {
+		return nil, errors.New(err.Message)
+	}
+	return map[string]interface{}{"result": result.Inspect(), "type": string(result.Type()), "variablesReference": 0}, nil
+}
+
+func (s *Server) respond(req request, success bool, message string, body interface{}) {
+	s.send(&response{Type: "response", RequestSeq: req.Seq, Success: success, Command: req.Command, Message: message, Body: body})
+}
+
+func (s *Server) event(name string, body interface{}) {
+	s.send(&event{Type: "event", Event: name, Body: body})
+}
+
+// numbers and writes a message, a broken stream ends Run on its next read
+func (s *Server) send(msg interface{}) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.seq++
+	switch msg := msg.(type) {
+	case *response:
+		msg.Seq = s.seq
+	case *event:
+		msg.Seq = s.seq
+	}
+	framing.Write(s.out, msg)
+}
+
+func decode(arguments json.RawMessage, v interface{}) error {
+	if len(arguments) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(arguments, v); err != nil {
+		return fmt.Errorf("invalid arguments: %v", err)
+	}
+	return nil
+}
+
+// output forwards what the program writes to the client as output events
+type output struct {
+	s        *Server
+	category string
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.s.event("output", map[string]interface{}{"category": o.category, "output": string(p)})
+	return len(p), nil
+}
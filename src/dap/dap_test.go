@@ -0,0 +1,390 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"lexicon/src/framing"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// incoming is any message the server sends
+type incoming struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Command    string          `json:"command"`
+	Message    string          `json:"message"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// client is a fake editor talking to an in-process server over pipes
+type client struct {
+	t    *testing.T
+	in   *io.PipeWriter
+	seq  int
+	done chan error
+
+	messages chan incoming
+	events   []incoming // received while waiting for a response, oldest first
+}
+
+func newClient(t *testing.T) *client {
+	t.Helper()
+	clientToServer, serverIn := io.Pipe()
+	serverOut, serverToClient := io.Pipe()
+	c := &client{t: t, in: serverIn, done: make(chan error, 1), messages: make(chan incoming, 64)}
+	go func() {
+		err := NewServer(clientToServer, serverToClient).Run()
+		serverToClient.Close()
+		c.done <- err
+	}()
+	go func() {
+		r := bufio.NewReader(serverOut)
+		for {
+			body, err := framing.Read(r)
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			var msg incoming
+			if err := json.Unmarshal(body, &msg); err != nil {
+				panic(err)
+			}
+			c.messages <- msg
+		}
+	}()
+	t.Cleanup(func() { c.in.Close() })
+	return c
+}
+
+func (c *client) receive() incoming {
+	c.t.Helper()
+	select {
+	case msg, ok := <-c.messages:
+		if !ok {
+			c.t.Fatal("server closed the connection")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timed out waiting for the server")
+	}
+	return incoming{}
+}
+
+// sends a request and waits for its response, decoding the body into body
+func (c *client) request(command string, arguments interface{}, body interface{}) incoming {
+	c.t.Helper()
+	c.seq++
+	seq := c.seq
+	msg := map[string]interface{}{"seq": seq, "type": "request", "command": command}
+	if arguments != nil {
+		msg["arguments"] = arguments
+	}
+	if err := framing.Write(c.in, msg); err != nil {
+		c.t.Fatalf("writing %s: %v", command, err)
+	}
+	for {
+		msg := c.receive()
+		if msg.Type == "event" {
+			c.events = append(c.events, msg)
+			continue
+		}
+		if msg.RequestSeq != seq || msg.Command != command {
+			c.t.Fatalf("%s: unexpected response %+v", command, msg)
+		}
+		if body != nil && msg.Success {
+			if err := json.Unmarshal(msg.Body, body); err != nil {
+				c.t.Fatalf("%s: decoding %s: %v", command, msg.Body, err)
+			}
+		}
+		return msg
+	}
+}
+
+// like request but fails the test when the server reports an error
+func (c *client) must(command string, arguments interface{}, body interface{}) {
+	c.t.Helper()
+	if resp := c.request(command, arguments, body); !resp.Success {
+		c.t.Fatalf("%s failed: %s", command, resp.Message)
+	}
+}
+
+// waits for the next event named name, collecting program output on the way
+func (c *client) event(name string, output *strings.Builder) incoming {
+	c.t.Helper()
+	for {
+		var msg incoming
+		if len(c.events) > 0 {
+			msg, c.events = c.events[0], c.events[1:]
+		} else {
+			msg = c.receive()
+		}
+		if msg.Type != "event" {
+			c.t.Fatalf("expected event %s, got %+v", name, msg)
+		}
+		if msg.Event == "output" && output != nil {
+			var body struct{ Output string }
+			json.Unmarshal(msg.Body, &body)
+			output.WriteString(body.Output)
+		}
+		if msg.Event == name {
+			return msg
+		}
+	}
+}
+
+// waits for the program to stop and returns why and where
+func (c *client) stopped() (string, []StackFrame) {
+	c.t.Helper()
+	var body struct{ Reason string }
+	json.Unmarshal(c.event("stopped", nil).Body, &body)
+	var trace struct{ StackFrames []StackFrame }
+	c.must("stackTrace", map[string]interface{}{"threadId": THREAD_ID}, &trace)
+	return body.Reason, trace.StackFrames
+}
+
+const program = `sprout total = 0;
+sprout add = fn(a, b) {
+    sprout sum = a + b;
+    return sum;
+};
+for (sprout i = 0; i < 2; i = i + 1) {
+    total = add(total, i);
+}
+echo total;
+`
+
+// starts a session on program with breakpoints on lines, running it
+func launch(t *testing.T, source string, stopOnEntry bool, lines ...int) *client {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "main.spr")
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newClient(t)
+	c.must("initialize", map[string]interface{}{"adapterID": "sprout"}, nil)
+	c.event("initialized", nil)
+	c.must("launch", map[string]interface{}{"program": path, "stopOnEntry": stopOnEntry}, nil)
+	var breakpoints []map[string]int
+	for _, line := range lines {
+		breakpoints = append(breakpoints, map[string]int{"line": line})
+	}
+	c.must("setBreakpoints", map[string]interface{}{"source": map[string]string{"path": path}, "breakpoints": breakpoints}, nil)
+	c.must("configurationDone", nil, nil)
+	return c
+}
+
+func TestBreakpointsAndStepping(t *testing.T) {
+	c := launch(t, program, true, 3)
+
+	where := func(frames []StackFrame) string {
+		var out []string
+		for _, f := range frames {
+			out = append(out, f.Name+":"+itoa(f.Line))
+		}
+		return strings.Join(out, " ")
+	}
+	steps := []struct {
+		command  string
+		reason   string
+		expected string
+	}{
+		{"", "entry", "main:1"},
+		{"continue", "breakpoint", "add:3 main:7"},
+		{"next", "step", "add:4 main:7"},
+		{"next", "step", "main:7"},
+		{"stepIn", "breakpoint", "add:3 main:7"},
+		{"stepOut", "step", "main:9"},
+	}
+	for _, step := range steps {
+		if step.command != "" {
+			c.must(step.command, map[string]interface{}{"threadId": THREAD_ID}, nil)
+		}
+		reason, frames := c.stopped()
+		if reason != step.reason || where(frames) != step.expected {
+			t.Fatalf("after %q expected %s at %s, got %s at %s", step.command, step.reason, step.expected, reason, where(frames))
+		}
+	}
+
+	var output strings.Builder
+	c.must("continue", map[string]interface{}{"threadId": THREAD_ID}, nil)
+	var exited struct{ ExitCode int }
+	json.Unmarshal(c.event("exited", &output).Body, &exited)
+	c.event("terminated", nil)
+	if output.String() != "1\n" || exited.ExitCode != 0 {
+		t.Errorf("expected output 1 and exit code 0, got %q and %d", output.String(), exited.ExitCode)
+	}
+
+	c.must("disconnect", nil, nil)
+	if err := <-c.done; err != nil {
+		t.Errorf("expected a clean disconnect, got %v", err)
+	}
+}
+
+func TestScopesAndVariables(t *testing.T) {
+	c := launch(t, program, false, 4)
+	c.stopped()
+
+	var scopes struct{ Scopes []Scope }
+	c.must("scopes", map[string]interface{}{"frameId": 1}, &scopes)
+	var names []string
+	for _, s := range scopes.Scopes {
+		names = append(names, s.Name)
+	}
+	if strings.Join(names, " ") != "Locals Globals" {
+		t.Fatalf("expected Locals and Globals for the function frame, got %v", names)
+	}
+
+	variables := func(reference int) string {
+		var body struct{ Variables []Variable }
+		c.must("variables", map[string]interface{}{"variablesReference": reference}, &body)
+		var out []string
+		for _, v := range body.Variables {
+			out = append(out, v.Name+"="+v.Value+":"+v.Type)
+		}
+		return strings.Join(out, " ")
+	}
+	if got := variables(scopes.Scopes[0].VariablesReference); got != "a=0:INTEGER b=0:INTEGER sum=0:INTEGER" {
+		t.Errorf("unexpected locals %q", got)
+	}
+	if got := variables(scopes.Scopes[1].VariablesReference); !strings.HasPrefix(got, "total=0:INTEGER add=fn(a, b)") {
+		t.Errorf("unexpected globals %q", got)
+	}
+
+	// the caller's frame sees the loop's scopes up to the globals
+	c.must("scopes", map[string]interface{}{"frameId": 2}, &scopes)
+	names = nil
+	for _, s := range scopes.Scopes {
+		names = append(names, s.Name)
+	}
+	if strings.Join(names, " ") != "Locals Outer 1 Globals" {
+		t.Errorf("expected the block, loop and global scopes, got %v", names)
+	}
+	if got := variables(scopes.Scopes[1].VariablesReference); got != "i=0:INTEGER" {
+		t.Errorf("unexpected loop scope %q", got)
+	}
+
+	var result struct{ Result string }
+	c.must("evaluate", map[string]interface{}{"expression": "add(a, 40)", "frameId": 1}, &result)
+	if result.Result != "40" {
+		t.Errorf("expected 40, got %q", result.Result)
+	}
+	c.must("evaluate", map[string]interface{}{"expression": "total + i + 1", "frameId": 2}, &result)
+	if result.Result != "1" {
+		t.Errorf("expected 1, got %q", result.Result)
+	}
+	if resp := c.request("evaluate", map[string]interface{}{"expression": "missing", "frameId": 1}, nil); resp.Success {
+		t.Error("expected evaluating an unknown name to fail")
+	}
+
+	// references do not outlive the pause
+	c.must("next", map[string]interface{}{"threadId": THREAD_ID}, nil)
+	c.stopped()
+	c.must("scopes", map[string]interface{}{"frameId": 1}, nil)
+	if resp := c.request("variables", map[string]interface{}{"variablesReference": scopes.Scopes[0].VariablesReference}, nil); resp.Success {
+		t.Error("expected a stale variables reference to be rejected")
+	}
+	c.must("disconnect", nil, nil)
+}
+
+func TestBreakpointVerification(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.spr")
+	os.WriteFile(path, []byte(program), 0o644)
+	c := newClient(t)
+	c.must("initialize", nil, nil)
+	c.must("launch", map[string]interface{}{"program": path}, nil)
+
+	var body struct{ Breakpoints []Breakpoint }
+	c.must("setBreakpoints", map[string]interface{}{
+		"source":      map[string]string{"path": path},
+		"breakpoints": []map[string]int{{"line": 3}, {"line": 5}, {"line": 8}, {"line": 9}},
+	}, &body)
+	var verified []string
+	for _, b := range body.Breakpoints {
+		if b.Verified {
+			verified = append(verified, itoa(b.Line))
+		}
+	}
+	if strings.Join(verified, " ") != "3 9" {
+		t.Errorf("expected lines 3 and 9 to be verified, got %v", verified)
+	}
+	c.must("disconnect", nil, nil)
+}
+
+func TestErrors(t *testing.T) {
+	// a program that does not type check is not launched
+	path := filepath.Join(t.TempDir(), "bad.spr")
+	os.WriteFile(path, []byte(`sprout x int = "a";`), 0o644)
+	c := newClient(t)
+	c.must("initialize", nil, nil)
+	resp := c.request("launch", map[string]interface{}{"program": path}, nil)
+	if resp.Success || !strings.Contains(resp.Message, "bad.spr:1:") {
+		t.Errorf("expected the launch to fail with a rendered diagnostic, got %+v", resp)
+	}
+	if resp := c.request("continue", map[string]interface{}{"threadId": THREAD_ID}, nil); resp.Success {
+		t.Error("expected continue to fail without a paused program")
+	}
+	if resp := c.request("restartFrame", nil, nil); resp.Success || !strings.Contains(resp.Message, "unsupported") {
+		t.Errorf("expected an unsupported command, got %+v", resp)
+	}
+	c.must("disconnect", nil, nil)
+
+	// a runtime error is shown and ends the program with exit code 1
+	c = launch(t, "echo 1;\necho 1 / 0;\n", false)
+	var output strings.Builder
+	var exited struct{ ExitCode int }
+	json.Unmarshal(c.event("exited", &output).Body, &exited)
+	if exited.ExitCode != 1 || !strings.Contains(output.String(), "division by zero") {
+		t.Errorf("expected the runtime error and exit code 1, got %q and %d", output.String(), exited.ExitCode)
+	}
+	c.must("disconnect", nil, nil)
+}
+
+func TestRepeatedConfigurationDone(t *testing.T) {
+	c := launch(t, "echo 1;\n", false)
+	resp := c.request("configurationDone", nil, nil)
+	if resp.Success || !strings.Contains(resp.Message, "already started") {
+		t.Errorf("expected a second configurationDone to fail, got %+v", resp)
+	}
+
+	// the program ran once
+	var output strings.Builder
+	c.event("terminated", &output)
+	if output.String() != "1\n" {
+		t.Errorf("expected the output once, got %q", output.String())
+	}
+	c.must("disconnect", nil, nil)
+	if err := <-c.done; err != nil {
+		t.Errorf("expected a clean disconnect, got %v", err)
+	}
+}
+
+func TestDisconnectStopsTheProgram(t *testing.T) {
+	// paused at a breakpoint
+	c := launch(t, program, false, 3)
+	c.stopped()
+	c.must("disconnect", nil, nil)
+	if err := <-c.done; err != nil {
+		t.Errorf("expected a clean disconnect, got %v", err)
+	}
+
+	// running with no end in sight
+	c = launch(t, "while (true) { }", false)
+	c.must("disconnect", nil, nil)
+	if err := <-c.done; err != nil {
+		t.Errorf("expected a clean disconnect, got %v", err)
+	}
+}
+
+func itoa(n int) string {
+	b, _ := json.Marshal(n)
+	return string(b)
+}
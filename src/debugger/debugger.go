@@ -0,0 +1,239 @@
+// Package debugger pauses Sprout programs run by the evaluator. It sits on
+// the evaluator's Hook, keeps the call stack and line breakpoints, and hands
+// every pause to a front end, such as the terminal debugger of sprun or a
+// Debug Adapter Protocol server, which decides how the program goes on.
+package debugger
+
+import (
+	"fmt"
+	"lexicon/src/ast"
+	"lexicon/src/evaluator"
+	"lexicon/src/lexer"
+	"lexicon/src/parser"
+	"lexicon/src/token"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Action tells a paused program how to go on
+type Action int
+
+const (
+	Continue Action = iota // run to the next breakpoint
+	StepOver               // pause at the next statement of this or an outer frame
+	StepInto               // pause at the very next statement, entering calls
+	StepOut                // pause once the current function returns
+	Quit                   // end the run
+)
+
+// why a program paused
+const (
+	REASON_ENTRY      = "entry"
+	REASON_BREAKPOINT = "breakpoint"
+	REASON_STEP       = "step"
+)
+
+// Frame is one active call, the program itself is the outermost frame
+type Frame struct {
+	Name string
+	Line int                    // line of the statement running in the frame
+	Env  *evaluator.Environment // innermost scope of that statement
+}
+
+// Stop describes a paused program
+type Stop struct {
+	Reason    string
+	Statement ast.Statement
+	Frames    []Frame // innermost first
+}
+
+// the line the program is paused at
+func (s *Stop) Line() int {
+	return s.Frames[0].Line
+}
+
+// the innermost scope of the paused statement
+func (s *Stop) Env() *evaluator.Environment {
+	return s.Frames[0].Env
+}
+
+// Debugger implements evaluator.Hook. pause is called on the evaluating
+// goroutine whenever the program stops and the program resumes with the
+// action it returns
+type Debugger struct {
+	StopOnEntry bool // pause before the first statement
+
+	pause func(*Stop) Action
+
+	mu          sync.Mutex
+	breakpoints map[int]bool
+
+	frames     []Frame // outermost first
+	action     Action
+	target     int  // frame count when the last step began
+	started    bool // the first statement has been seen
+	evaluating bool // the front end is evaluating an expression
+}
+
+// creates a debugger that runs to the first breakpoint
+func New(pause func(*Stop) Action) *Debugger {
+	return &Debugger{
+		pause:       pause,
+		breakpoints: make(map[int]bool),
+		frames:      []Frame{{Name: "main"}},
+		action:      Continue,
+	}
+}
+
+// attaches the debugger to the execution context of env
+func (d *Debugger) Attach(env *evaluator.Environment) {
+	env.ExecContext().Hook = d
+}
+
+// sets a breakpoint on a line, statements starting on it pause the program
+func (d *Debugger) SetBreakpoint(line int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.breakpoints[line] = true
+}
+
+// removes the breakpoint on a line
+func (d *Debugger) ClearBreakpoint(line int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.breakpoints, line)
+}
+
+// replaces every breakpoint with breakpoints on lines
+func (d *Debugger) SetBreakpoints(lines []int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.breakpoints = make(map[int]bool, len(lines))
+	for _, line := range lines {
+		d.breakpoints[line] = true
+	}
+}
+
+// lines with a breakpoint, in order
+func (d *Debugger) Breakpoints() []int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	lines := make([]int, 0, len(d.breakpoints))
+	for line := range d.breakpoints {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+func (d *Debugger) hasBreakpoint(line int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.breakpoints[line]
+}
+
+// Statement is called by the evaluator before each statement
+func (d *Debugger) Statement(stmt ast.Statement, env *evaluator.Environment) *evaluator.Error {
+	if d.evaluating {
+		return nil
+	}
+	top := &d.frames[len(d.frames)-1]
+	top.Line = stmt.Pos().Line
+	top.Env = env
+
+	reason := ""
+	switch {
+	case !d.started && d.StopOnEntry:
+		reason = REASON_ENTRY
+	case d.action == StepInto:
+		reason = REASON_STEP
+	case d.action == StepOver && len(d.frames) <= d.target:
+		reason = REASON_STEP
+	case d.action == StepOut && len(d.frames) < d.target:
+		reason = REASON_STEP
+	}
+	d.started = true
+	if reason != REASON_ENTRY && d.hasBreakpoint(top.Line) {
+		reason = REASON_BREAKPOINT
+	}
+	if reason == "" {
+		return nil
+	}
+
+	d.action = d.pause(&Stop{Reason: reason, Statement: stmt, Frames: d.Frames()})
+	d.target = len(d.frames)
+	if d.action == Quit {
+		return &evaluator.Error{Message: "execution stopped by the debugger", Code: evaluator.CANCELLED}
+	}
+	return nil
+}
+
+// EnterFunction is called by the evaluator when a call begins
+func (d *Debugger) EnterFunction(name string, call token.Token, env *evaluator.Environment) {
+	if d.evaluating {
+		return
+	}
+	if name == "" {
+		name = "anonymous"
+	}
+	d.frames = append(d.frames, Frame{Name: name, Line: call.Line, Env: env})
+}
+
+// LeaveFunction is called by the evaluator when a call returns
+func (d *Debugger) LeaveFunction() {
+	if d.evaluating {
+		return
+	}
+	d.frames = d.frames[:len(d.frames)-1]
+}
+
+// the active calls, innermost first
+func (d *Debugger) Frames() []Frame {
+	frames := make([]Frame, len(d.frames))
+	for i, frame := range d.frames {
+		frames[len(d.frames)-1-i] = frame
+	}
+	return frames
+}
+
+// evaluates an expression in env while the program is paused, calls it
+// makes run without pausing
+func (d *Debugger) Evaluate(source string, env *evaluator.Environment) evaluator.Object {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		return &evaluator.Error{Message: strings.Join(errs, "; ")}
+	}
+	if len(program.Statements) != 1 {
+		return &evaluator.Error{Message: "expected a single expression"}
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok || stmt.Expression == nil {
+		return &evaluator.Error{Message: fmt.Sprintf("not an expression: %s", source)}
+	}
+
+	d.evaluating = true
+	defer func() { d.evaluating = false }()
+	return evaluator.Eval(stmt.Expression, env)
+}
+
+// Scope is one environment of a scope chain
+type Scope struct {
+	Names  []string // in declaration order
+	Values []evaluator.Object
+}
+
+// the scopes visible from env, innermost first, ending with the globals
+func ScopeChain(env *evaluator.Environment) []Scope {
+	var scopes []Scope
+	for ; env != nil; env = env.Outer() {
+		store := env.GetStore()
+		scope := Scope{Names: env.Names()}
+		for _, name := range scope.Names {
+			scope.Values = append(scope.Values, store[name])
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes
+}
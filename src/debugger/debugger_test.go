@@ -0,0 +1,143 @@
+package debugger
+
+import (
+	"bytes"
+	"fmt"
+	"lexicon/src/evaluator"
+	"lexicon/src/lexer"
+	"lexicon/src/parser"
+	"strings"
+	"testing"
+)
+
+const program = `sprout total = 0;
+sprout add = fn(a, b) {
+    sprout sum = a + b;
+    return sum;
+};
+for (sprout i = 0; i < 2; i = i + 1) {
+    total = add(total, i);
+}
+echo total;`
+
+// runs program, answering each pause with the next action and recording
+// where it stopped as "reason line frame"
+func run(t *testing.T, setup func(*Debugger), actions ...Action) ([]string, string, evaluator.Object) {
+	t.Helper()
+	var stops []string
+	var d *Debugger
+	d = New(func(stop *Stop) Action {
+		stops = append(stops, fmt.Sprintf("%s %d %s", stop.Reason, stop.Line(), stop.Frames[0].Name))
+		if len(actions) == 0 {
+			return Continue
+		}
+		action := actions[0]
+		actions = actions[1:]
+		return action
+	})
+	if setup != nil {
+		setup(d)
+	}
+
+	var out bytes.Buffer
+	env := evaluator.NewEnvironment()
+	env.SetExecContext(evaluator.NewExecContext(&out, &out))
+	d.Attach(env)
+	p := parser.New(lexer.New(program))
+	result := evaluator.Eval(p.ParseProgram(), env)
+	return stops, out.String(), result
+}
+
+func TestStepping(t *testing.T) {
+	entry := func(d *Debugger) { d.StopOnEntry = true }
+	tests := []struct {
+		name     string
+		setup    func(*Debugger)
+		actions  []Action
+		expected []string
+	}{
+		{"no breakpoints", nil, nil, nil},
+		{"entry", entry, nil, []string{"entry 1 main"}},
+		{"step over", entry, []Action{StepOver, StepOver, StepOver, StepOver}, []string{
+			"entry 1 main", "step 2 main", "step 6 main", "step 7 main", "step 7 main",
+		}},
+		{"step into", entry, []Action{StepOver, StepOver, StepOver, StepInto, StepInto, StepInto}, []string{
+			"entry 1 main", "step 2 main", "step 6 main", "step 7 main", "step 3 add", "step 4 add", "step 7 main",
+		}},
+		{"step out", func(d *Debugger) { d.SetBreakpoint(3) }, []Action{StepOut, StepOut}, []string{
+			"breakpoint 3 add", "step 7 main", "breakpoint 3 add",
+		}},
+		{"breakpoints", func(d *Debugger) { d.SetBreakpoints([]int{4, 9}) }, nil, []string{
+			"breakpoint 4 add", "breakpoint 4 add", "breakpoint 9 main",
+		}},
+		{"cleared breakpoint", func(d *Debugger) { d.SetBreakpoint(4); d.SetBreakpoint(9); d.ClearBreakpoint(4) }, nil, []string{
+			"breakpoint 9 main",
+		}},
+	}
+
+	for _, tt := range tests {
+		stops, out, result := run(t, tt.setup, tt.actions...)
+		if strings.Join(stops, ", ") != strings.Join(tt.expected, ", ") {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, stops)
+		}
+		if out != "1\n" || result.Type() == evaluator.ERROR_OBJ {
+			t.Errorf("%s: the program should run to the end, got %q and %s", tt.name, out, result.Inspect())
+		}
+	}
+}
+
+func TestQuit(t *testing.T) {
+	stops, out, result := run(t, func(d *Debugger) { d.SetBreakpoint(7) }, Quit)
+	if len(stops) != 1 || out != "" {
+		t.Errorf("expected the run to end at the first stop, got %q and %q", stops, out)
+	}
+	if err, ok := result.(*evaluator.Error); !ok || err.Code != evaluator.CANCELLED {
+		t.Errorf("expected a cancelled run, got %s", result.Inspect())
+	}
+}
+
+func TestInspectingAPausedProgram(t *testing.T) {
+	var d *Debugger
+	var printed, frames []string
+	var chain []Scope
+	d = New(func(stop *Stop) Action {
+		for _, source := range []string{"a + b", "total", "add(10, 20)", "nope", "sprout x = 1;"} {
+			result := d.Evaluate(source, stop.Env())
+			if err, ok := result.(*evaluator.Error); ok {
+				printed = append(printed, "error: "+err.Message)
+			} else {
+				printed = append(printed, result.Inspect())
+			}
+		}
+		for _, frame := range stop.Frames {
+			frames = append(frames, fmt.Sprintf("%s:%d", frame.Name, frame.Line))
+		}
+		chain = ScopeChain(stop.Env())
+		return Quit
+	})
+	d.SetBreakpoint(4)
+	env := evaluator.NewEnvironment()
+	d.Attach(env)
+	evaluator.Eval(parser.New(lexer.New(program)).ParseProgram(), env)
+
+	expected := []string{"0", "0", "30", "error: identifier not found: nope", "error: not an expression: sprout x = 1;"}
+	if strings.Join(printed, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("expected %q, got %q", expected, printed)
+	}
+	if strings.Join(frames, " ") != "add:4 main:7" {
+		t.Errorf("expected the call stack add:4 main:7, got %q", frames)
+	}
+
+	// the function's scope is enclosed by the globals it was defined in
+	var scopes []string
+	for _, scope := range chain {
+		var vars []string
+		for i, name := range scope.Names {
+			vars = append(vars, name+"="+scope.Values[i].Inspect())
+		}
+		scopes = append(scopes, strings.Join(vars, " "))
+	}
+	if len(scopes) != 2 || scopes[0] != "a=0 b=0 sum=0" || !strings.HasPrefix(scopes[1], "total=0 add=fn(a, b)") {
+		t.Errorf("unexpected scope chain %q", scopes)
+	}
+}
@@ -0,0 +1,124 @@
+package diagnostic
+
+import (
+	"fmt"
+	"lexicon/src/token"
+)
+
+// how serious a diagnostic is, errors stop a program from running
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Info
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	default:
+		return "info"
+	}
+}
+
+// 1-based line and column in the source
+type Position struct {
+	Line   int
+	Column int
+}
+
+// source range of a diagnostic, End is the last column covered and equals
+// Start for a single character or an unknown length
+type Span struct {
+	Start Position
+	End   Position
+}
+
+// Diagnostic is a problem found in a program by any stage, from the parser to
+// the evaluator, in a form every front end can render the same way
+type Diagnostic struct {
+	Severity Severity
+	Code     string // stable identifier such as EXPECTED_TOKEN
+	Span     Span
+	Message  string
+	Hint     string // optional suggestion for fixing the problem
+}
+
+// creates a diagnostic covering a token
+func New(severity Severity, code string, tok token.Token, format string, args ...interface{}) Diagnostic {
+	return Diagnostic{
+		Severity: severity,
+		Code:     code,
+		Span:     TokenSpan(tok),
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+// creates a diagnostic at a position whose extent is unknown
+func At(severity Severity, code string, line, column int, message string) Diagnostic {
+	pos := Position{Line: line, Column: column}
+	return Diagnostic{
+		Severity: severity,
+		Code:     code,
+		Span:     Span{Start: pos, End: pos},
+		Message:  message,
+	}
+}
+
+// returns d with a hint attached
+func (d Diagnostic) WithHint(format string, args ...interface{}) Diagnostic {
+	d.Hint = fmt.Sprintf(format, args...)
+	return d
+}
+
+// formats the diagnostic the way errors have always been listed, "[Line L:C] message"
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("[Line %d:%d] %s", d.Span.Start.Line, d.Span.Start.Column, d.Message)
+}
+
+// returns the span of a token, a token ending on a later line, like a
+// multi-line string, is cut to its first character
+func TokenSpan(tok token.Token) Span {
+	start := Position{Line: tok.Line, Column: tok.Column}
+	end := start
+	if e := tok.End(); e.Line == start.Line && e.Column-1 > start.Column {
+		end.Column = e.Column - 1
+	}
+	return Span{Start: start, End: end}
+}
+
+// returns the span of source from start up to end, such as an AST node's Pos
+// and End, end being the position just past the last character
+func PositionSpan(start, end token.Position) Span {
+	span := Span{
+		Start: Position{Line: start.Line, Column: start.Column},
+		End:   Position{Line: end.Line, Column: end.Column - 1},
+	}
+	if end.Line < start.Line || end.Line == start.Line && end.Column-1 < start.Column {
+		span.End = span.Start
+	}
+	return span
+}
+
+// formats every diagnostic with String
+func Strings(diagnostics []Diagnostic) []string {
+	out := make([]string, len(diagnostics))
+	for i, d := range diagnostics {
+		out[i] = d.String()
+	}
+	return out
+}
+
+// reports whether any diagnostic is an error
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
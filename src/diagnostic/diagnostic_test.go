@@ -0,0 +1,109 @@
+package diagnostic
+
+import (
+	"bytes"
+	"lexicon/src/token"
+	"strings"
+	"testing"
+)
+
+func TestTokenSpan(t *testing.T) {
+	tests := []struct {
+		tok      token.Token
+		expected Span
+	}{
+		{token.Token{Literal: "x", Line: 1, Column: 5}, Span{Position{1, 5}, Position{1, 5}}},
+		{token.Token{Literal: "sprout", Line: 2, Column: 1}, Span{Position{2, 1}, Position{2, 6}}},
+		{token.Token{Literal: "", Line: 3, Column: 8}, Span{Position{3, 8}, Position{3, 8}}},
+		// a string's span includes its quotes
+		{token.Token{Literal: "ab", Line: 1, Column: 3, EndLine: 1, EndColumn: 7}, Span{Position{1, 3}, Position{1, 6}}},
+		{token.Token{Literal: "a\nb", Line: 1, Column: 3, EndLine: 2, EndColumn: 3}, Span{Position{1, 3}, Position{1, 3}}},
+	}
+
+	for _, tt := range tests {
+		if got := TokenSpan(tt.tok); got != tt.expected {
+			t.Errorf("%q: expected %+v, got=%+v", tt.tok.Literal, tt.expected, got)
+		}
+	}
+}
+
+func TestPositionSpan(t *testing.T) {
+	start := token.Position{Line: 2, Column: 4}
+	if got := PositionSpan(start, token.Position{Line: 2, Column: 9}); got != (Span{Position{2, 4}, Position{2, 8}}) {
+		t.Errorf("wrong span, got=%+v", got)
+	}
+	if got := PositionSpan(start, token.Position{Line: 4, Column: 2}); got != (Span{Position{2, 4}, Position{4, 1}}) {
+		t.Errorf("wrong multi-line span, got=%+v", got)
+	}
+	if got := PositionSpan(start, start); got != (Span{Position{2, 4}, Position{2, 4}}) {
+		t.Errorf("wrong empty span, got=%+v", got)
+	}
+}
+
+func TestString(t *testing.T) {
+	d := New(Error, "CODE", token.Token{Literal: "=", Line: 3, Column: 10}, "Expected %s", "IDENT")
+	if d.String() != "[Line 3:10] Expected IDENT" {
+		t.Errorf("wrong string, got=%q", d.String())
+	}
+	if !HasErrors([]Diagnostic{At(Warning, "W", 1, 1, "w"), d}) || HasErrors([]Diagnostic{At(Warning, "W", 1, 1, "w")}) {
+		t.Errorf("HasErrors only counts errors")
+	}
+}
+
+func TestRender(t *testing.T) {
+	source := "sprout a = 1;\n\tsprout total = a +;\necho a;"
+
+	tests := []struct {
+		d        Diagnostic
+		expected string
+	}{
+		{
+			New(Error, "NO_PREFIX_PARSE_FN", token.Token{Literal: ";", Line: 2, Column: 19}, "no prefix parse function for ;"),
+			`error[NO_PREFIX_PARSE_FN]: no prefix parse function for ;
+ --> main.spr:2:19
+  |
+2 | 	sprout total = a +;
+  | 	                 ^
+`,
+		},
+		{
+			New(Warning, "UNUSED_VARIABLE", token.Token{Literal: "total", Line: 2, Column: 9}, "unused variable total").
+				WithHint("remove it"),
+			`warning[UNUSED_VARIABLE]: unused variable total
+ --> main.spr:2:9
+  |
+2 | 	sprout total = a +;
+  | 	       ^~~~~
+  = hint: remove it
+`,
+		},
+		{
+			At(Error, "RUNTIME_ERROR", 0, 0, "unknown operator: -STRING"),
+			"error[RUNTIME_ERROR]: unknown operator: -STRING\n",
+		},
+	}
+
+	r := NewRenderer("main.spr", source)
+	r.Color = false
+	for _, tt := range tests {
+		var out bytes.Buffer
+		r.Render(&out, tt.d)
+		if out.String() != tt.expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", tt.d.Code, tt.expected, out.String())
+		}
+	}
+}
+
+func TestRenderColor(t *testing.T) {
+	r := NewRenderer("", "x;")
+	r.Color = true
+
+	var out bytes.Buffer
+	r.Render(&out, At(Error, "RUNTIME_ERROR", 1, 1, "identifier not found: x"))
+	if !strings.Contains(out.String(), red) || !strings.Contains(out.String(), reset) {
+		t.Errorf("expected colored output, got=%q", out.String())
+	}
+	if !strings.Contains(out.String(), "-->"+reset+" line 1:1\n") {
+		t.Errorf("expected a location without file name, got=%q", out.String())
+	}
+}
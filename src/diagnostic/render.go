@@ -0,0 +1,142 @@
+package diagnostic
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ANSI colors used when rendering to a terminal
+const (
+	reset  = "\033[0m"
+	bold   = "\033[1m"
+	red    = "\033[31m"
+	yellow = "\033[33m"
+	blue   = "\033[34m"
+	cyan   = "\033[36m"
+)
+
+// Renderer prints diagnostics with the source line they point at and a ^~~~
+// underline below the span:
+//
+//	error[EXPECTED_TOKEN]: Expected next token to be =, got INT instead
+//	 --> main.spr:3:10
+//	  |
+//	3 | sprout y 3;
+//	  |          ^
+type Renderer struct {
+	Filename string // shown in the location line, empty for input without a file
+	Color    bool
+	lines    []string
+}
+
+// creates a renderer for source, colored when stdout is a terminal
+func NewRenderer(filename, source string) *Renderer {
+	return &Renderer{
+		Filename: filename,
+		Color:    IsTerminal(os.Stdout),
+		lines:    strings.Split(source, "\n"),
+	}
+}
+
+// reports whether f is a terminal, NO_COLOR in the environment turns color off
+func IsTerminal(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// writes one diagnostic
+func (r *Renderer) Render(w io.Writer, d Diagnostic) {
+	severity := d.Severity.String()
+	if d.Code != "" {
+		severity += "[" + d.Code + "]"
+	}
+	fmt.Fprintf(w, "%s: %s\n", r.paint(bold+severityColor(d.Severity), severity), r.paint(bold, d.Message))
+
+	line := d.Span.Start.Line
+	if line < 1 {
+		// nothing to point at, as for some runtime errors
+		if d.Hint != "" {
+			fmt.Fprintf(w, "%s %s\n", r.paint(blue, "="), r.paint(cyan, "hint: ")+d.Hint)
+		}
+		return
+	}
+	gutter := strings.Repeat(" ", len(strconv.Itoa(line)))
+	location := fmt.Sprintf("line %d:%d", line, d.Span.Start.Column)
+	if r.Filename != "" {
+		location = fmt.Sprintf("%s:%d:%d", r.Filename, line, d.Span.Start.Column)
+	}
+	fmt.Fprintf(w, "%s%s %s\n", gutter, r.paint(blue, "-->"), location)
+
+	if line <= len(r.lines) {
+		source := strings.TrimRight(r.lines[line-1], "\r")
+		bar := r.paint(blue, "|")
+		fmt.Fprintf(w, "%s %s\n", gutter, bar)
+		fmt.Fprintf(w, "%s %s %s\n", r.paint(blue, strconv.Itoa(line)), bar, source)
+		fmt.Fprintf(w, "%s %s %s\n", gutter, bar, r.paint(bold+severityColor(d.Severity), underline(source, d.Span)))
+	}
+
+	if d.Hint != "" {
+		fmt.Fprintf(w, "%s %s %s\n", gutter, r.paint(blue, "="), r.paint(cyan, "hint: ")+d.Hint)
+	}
+}
+
+// writes every diagnostic followed by a blank line
+func (r *Renderer) RenderAll(w io.Writer, diagnostics []Diagnostic) {
+	for _, d := range diagnostics {
+		r.Render(w, d)
+		fmt.Fprintln(w)
+	}
+}
+
+func (r *Renderer) paint(color, s string) string {
+	if !r.Color {
+		return s
+	}
+	return color + s + reset
+}
+
+func severityColor(s Severity) string {
+	switch s {
+	case Error:
+		return red
+	case Warning:
+		return yellow
+	default:
+		return cyan
+	}
+}
+
+// builds the ^~~~ marker for the span's columns on source, tabs are copied so
+// the marker lines up however the terminal expands them
+func underline(source string, span Span) string {
+	runes := []rune(source)
+	start := span.Start.Column
+	if start < 1 {
+		start = 1
+	}
+	end := start
+	if span.End.Line == span.Start.Line && span.End.Column > start {
+		end = span.End.Column
+	}
+
+	var b strings.Builder
+	for i := 1; i < start; i++ {
+		if i <= len(runes) && runes[i-1] == '\t' {
+			b.WriteRune('\t')
+		} else {
+			b.WriteRune(' ')
+		}
+	}
+	b.WriteRune('^')
+	b.WriteString(strings.Repeat("~", end-start))
+	return b.String()
+}
@@ -0,0 +1,50 @@
+package evaluator
+
+import "sort"
+
+// named set of host functions, give each interpreter its own registry to
+// keep their builtins isolated
+type Registry struct {
+	builtins map[string]*Builtin
+}
+
+// creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{builtins: make(map[string]*Builtin)}
+}
+
+// registers fn under name, replacing any earlier builtin with that name
+func (r *Registry) Register(name string, fn BuiltinFunction) {
+	r.builtins[name] = &Builtin{Name: name, Fn: fn}
+}
+
+// removes a builtin, reports false if it was not registered
+func (r *Registry) Unregister(name string) bool {
+	if _, ok := r.builtins[name]; !ok {
+		return false
+	}
+	delete(r.builtins, name)
+	return true
+}
+
+// finds a builtin by name, safe to call on a nil registry
+func (r *Registry) Lookup(name string) (*Builtin, bool) {
+	if r == nil {
+		return nil, false
+	}
+	builtin, ok := r.builtins[name]
+	return builtin, ok
+}
+
+// returns the registered names in sorted order
+func (r *Registry) Names() []string {
+	if r == nil {
+		return nil
+	}
+	names := make([]string, 0, len(r.builtins))
+	for name := range r.builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -1,16 +1,30 @@
 package evaluator
 
-// environment for managing variable scopes and symbol table
+// scopes that grow past this many bindings get a name index
+const indexThreshold = 8
+
+// one variable, its slot is its position in the scope
+type binding struct {
+	name     string
+	value    Object
+	typ      string // declared type, empty when untyped
+	constant bool   // declared with const
+}
+
+// environment for managing variable scopes and symbol table, bindings are kept
+// in declaration order so the resolver can address them by (depth, index)
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	bindings []binding
+	index    map[string]int // name to slot, only for large scopes
+	outer    *Environment
+
+	builtins *Registry    // set on the root environment only
+	exec     *ExecContext // set on the root environment only
 }
 
-// creates a new environment with optimized initial capacity
+// creates a new environment, slots are allocated on first declaration
 func NewEnvironment() *Environment {
-	// Pre-allocate space for common number of variables
-	s := make(map[string]Object, 16)
-	return &Environment{store: s, outer: nil}
+	return &Environment{}
 }
 
 // creates a new enclosed environment for nested scopes
@@ -20,31 +34,175 @@ func NewEnclosedEnvironment(outer *Environment) *Environment {
 	return env
 }
 
-// retrieves a variable value from the environment (optimized lookup)
+// returns the enclosing environment, nil for the root
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
+
+// returns the slot of name in this scope, -1 if it is not declared here
+func (e *Environment) find(name string) int {
+	if e.index != nil {
+		if i, ok := e.index[name]; ok {
+			return i
+		}
+		return -1
+	}
+	for i := range e.bindings {
+		if e.bindings[i].name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// returns the scope and slot of the nearest binding of name
+func (e *Environment) lookup(name string) (*Environment, int) {
+	for env := e; env != nil; env = env.outer {
+		if i := env.find(name); i >= 0 {
+			return env, i
+		}
+	}
+	return nil, -1
+}
+
+// adds a binding to this scope and returns its slot
+func (e *Environment) add(b binding) int {
+	e.bindings = append(e.bindings, b)
+	slot := len(e.bindings) - 1
+
+	if e.index != nil {
+		e.index[b.name] = slot
+	} else if len(e.bindings) > indexThreshold {
+		e.index = make(map[string]int, len(e.bindings))
+		for i := range e.bindings {
+			e.index[e.bindings[i].name] = i
+		}
+	}
+	return slot
+}
+
+// retrieves a variable value from the environment
 func (e *Environment) Get(name string) (Object, bool) {
-	obj, ok := e.store[name]
-	if !ok && e.outer != nil {
-		obj, ok = e.outer.Get(name)
+	env, i := e.lookup(name)
+	if env == nil {
+		return nil, false
+	}
+	return env.bindings[i].value, true
+}
+
+// retrieves a variable from a slot assigned by the resolver. the slot is only
+// trusted while it still holds name, otherwise the lookup falls back to Get
+func (e *Environment) GetSlot(depth, index int, name string) (Object, bool) {
+	env := e
+	for i := 0; i < depth && env != nil; i++ {
+		env = env.outer
+	}
+	if env != nil && index < len(env.bindings) && env.bindings[index].name == name {
+		return env.bindings[index].value, true
 	}
-	return obj, ok
+	return e.Get(name)
 }
 
 // sets a variable value in the current environment
 func (e *Environment) Set(name string, val Object) Object {
-	e.store[name] = val
+	if i := e.find(name); i >= 0 {
+		e.bindings[i].value = val
+		return val
+	}
+	e.add(binding{name: name, value: val})
+	return val
+}
+
+// updates the nearest existing binding of name, reports false if there is none
+func (e *Environment) Assign(name string, val Object) (Object, bool) {
+	env, i := e.lookup(name)
+	if env == nil {
+		return nil, false
+	}
+	env.bindings[i].value = val
+	return val, true
+}
+
+// declares a variable in the current environment, typ is empty for untyped bindings.
+// redeclaring a name reuses its slot
+func (e *Environment) Declare(name string, val Object, typ string, constant bool) Object {
+	b := binding{name: name, value: val, typ: typ, constant: constant}
+	if i := e.find(name); i >= 0 {
+		e.bindings[i] = b
+	} else {
+		e.add(b)
+	}
 	return val
 }
 
-// returns all variable names in the current environment (not including outer scopes)
+// reports whether name is declared as a constant in this scope, outer scopes are ignored
+func (e *Environment) IsLocalConst(name string) bool {
+	i := e.find(name)
+	return i >= 0 && e.bindings[i].constant
+}
+
+// reports whether the nearest binding of name is a constant
+func (e *Environment) IsConst(name string) bool {
+	env, i := e.lookup(name)
+	return env != nil && env.bindings[i].constant
+}
+
+// returns the declared type of the nearest binding of name, empty if untyped
+func (e *Environment) TypeOf(name string) string {
+	env, i := e.lookup(name)
+	if env == nil {
+		return ""
+	}
+	return env.bindings[i].typ
+}
+
+// attaches a builtin registry, enclosed environments share their root's registry
+func (e *Environment) SetBuiltins(r *Registry) {
+	e.builtins = r
+}
+
+// returns the registry of the root environment, nil if none is attached
+func (e *Environment) Builtins() *Registry {
+	for env := e; env != nil; env = env.outer {
+		if env.builtins != nil {
+			return env.builtins
+		}
+	}
+	return nil
+}
+
+// attaches an execution context, enclosed environments share their root's context
+func (e *Environment) SetExecContext(ctx *ExecContext) {
+	e.exec = ctx
+}
+
+// returns the execution context of the root environment, creating one that
+// writes to stdout and stderr on first use
+func (e *Environment) ExecContext() *ExecContext {
+	env := e
+	for env.exec == nil && env.outer != nil {
+		env = env.outer
+	}
+	if env.exec == nil {
+		env.exec = defaultExecContext()
+	}
+	return env.exec
+}
+
+// returns all variable names in the current environment in slot order (not including outer scopes)
 func (e *Environment) Names() []string {
-	names := make([]string, 0, len(e.store))
-	for name := range e.store {
-		names = append(names, name)
+	names := make([]string, len(e.bindings))
+	for i := range e.bindings {
+		names[i] = e.bindings[i].name
 	}
 	return names
 }
 
-// returns the store for inspection (read-only access)
+// returns a copy of the current scope's variables for inspection
 func (e *Environment) GetStore() map[string]Object {
-	return e.store
+	store := make(map[string]Object, len(e.bindings))
+	for i := range e.bindings {
+		store[e.bindings[i].name] = e.bindings[i].value
+	}
+	return store
 }
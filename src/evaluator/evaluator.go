@@ -14,6 +14,15 @@ func Eval(node ast.Node, env *Environment) Object {
 	logger.IncreaseIndent()
 	defer logger.DecreaseIndent()
 
+	exec := env.ExecContext()
+	if _, ok := node.(*ast.Program); ok {
+		// limits apply per program run
+		exec.Reset()
+	}
+	if err := exec.Step(); err != nil {
+		return err
+	}
+
 	switch node := node.(type) {
 
 	// program node
@@ -37,16 +46,38 @@ func Eval(node ast.Node, env *Environment) Object {
 		return evalIfExpression(node, env)
 
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		// every block gets its own scope
+		return evalBlockStatement(node, NewEnclosedEnvironment(env))
+
+	case *ast.ReturnStatement:
+		return evalReturnStatement(node, env)
+
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+
+	case *ast.IndexAssignment:
+		return evalIndexAssignment(node, env)
+
+	case *ast.DeleteStatement:
+		return evalDeleteStatement(node, env)
+
+	case *ast.BreakStatement:
+		return BREAK
+
+	case *ast.ContinueStatement:
+		return CONTINUE
 
 	// expressions
 	case *ast.IntegerLiteral:
 		logger.Trace("IntegerLiteral: %d", node.Value)
-		return &Integer{Value: node.Value}
+		return exec.Track(&Integer{Value: node.Value})
 
 	case *ast.FloatLiteral:
 		logger.Trace("FloatLiteral: %f", node.Value)
-		return &Float{Value: node.Value}
+		return exec.Track(&Float{Value: node.Value})
 
 	case *ast.BooleanLiteral:
 		logger.Trace("BooleanLiteral: %t", node.Value)
@@ -54,7 +85,7 @@ func Eval(node ast.Node, env *Environment) Object {
 
 	case *ast.StringLiteral:
 		logger.Trace("StringLiteral: %s", node.Value)
-		return &String{Value: node.Value}
+		return exec.Track(&String{Value: node.Value})
 
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
@@ -64,7 +95,7 @@ func Eval(node ast.Node, env *Environment) Object {
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return exec.Track(evalPrefixExpression(node.Operator, right))
 
 	case *ast.InfixExpression:
 		left := Eval(node.Left, env)
@@ -75,7 +106,40 @@ func Eval(node ast.Node, env *Environment) Object {
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right, node.Token)
+		return exec.Track(evalInfixExpression(node.Operator, left, right, node.Token))
+
+	case *ast.LogicalExpression:
+		return evalLogicalExpression(node, env)
+
+	case *ast.FunctionLiteral:
+		return exec.Track(&Function{Parameters: node.Parameters, Body: node.Body, Env: env})
+
+	case *ast.CallExpression:
+		return evalCallExpression(node, env)
+
+	case *ast.ArrayLiteral:
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return exec.Track(&Array{Elements: elements})
+
+	case *ast.IndexExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := Eval(node.Index, env)
+		if isError(index) {
+			return index
+		}
+		return evalIndexExpression(left, index, node.Token)
+
+	case *ast.SliceExpression:
+		return exec.Track(evalSliceExpression(node, env))
+
+	case *ast.HashLiteral:
+		return exec.Track(evalHashLiteral(node, env))
 
 	}
 
@@ -87,10 +151,16 @@ func evalProgram(program *ast.Program, env *Environment) Object {
 	var result Object = NULL
 
 	for _, statement := range program.Statements {
+		if err := pause(statement, env); err != nil {
+			return err
+		}
 		result = Eval(statement, env)
 
-		if returnValue, ok := result.(*Error); ok {
-			return returnValue
+		switch result := result.(type) {
+		case *ReturnValue:
+			return result.Value
+		case *Error:
+			return result
 		}
 	}
 
@@ -102,10 +172,16 @@ func evalBlockStatement(block *ast.BlockStatement, env *Environment) Object {
 	var result Object = NULL
 
 	for _, statement := range block.Statements {
+		if err := pause(statement, env); err != nil {
+			return err
+		}
 		result = Eval(statement, env)
 
-		if result != nil && result.Type() == ERROR_OBJ {
-			return result
+		if result != nil {
+			rt := result.Type()
+			if rt == ERROR_OBJ || rt == RETURN_VALUE_OBJ || rt == BREAK_OBJ || rt == CONTINUE_OBJ {
+				return result
+			}
 		}
 	}
 
@@ -115,16 +191,81 @@ func evalBlockStatement(block *ast.BlockStatement, env *Environment) Object {
 // evaluates variable declaration
 func evalVariableDeclaration(node *ast.VariableDeclaration, env *Environment) Object {
 	logger.Trace("VariableDeclaration: %s", node.Name.Value)
+	name := node.Name.Value
+
+	if err := CheckBinding(env, name, node.IsAssignment(), node.Name.Token); err != nil {
+		return err
+	}
+
 	val := Eval(node.Value, env)
 	if isError(val) {
 		return val
 	}
 
-	env.Set(node.Name.Value, val)
-	logger.Trace("Set variable %s = %s", node.Name.Value, val.Inspect())
+	var typ string
+	if node.Type != nil {
+		typ = node.Type.Value
+	}
+	val = Bind(env, name, val, typ, node.IsAssignment(), node.IsConstant(), node.Name.Token)
+	if !isError(val) {
+		logger.Trace("Set variable %s = %s", name, val.Inspect())
+	}
 	return val
 }
 
+// checks that run before the value of a declaration or assignment is evaluated
+func CheckBinding(env *Environment, name string, assignment bool, tok token.Token) *Error {
+	if assignment && env.IsConst(name) {
+		return newErrorWithToken("cannot assign to constant %s", tok, name)
+	}
+	if !assignment && env.IsLocalConst(name) {
+		return newErrorWithToken("cannot redeclare constant %s", tok, name)
+	}
+	return nil
+}
+
+// declares name, or assigns its nearest binding, after checking val against the declared type
+func Bind(env *Environment, name string, val Object, typ string, assignment, constant bool, tok token.Token) Object {
+	// sprout x T = v declares, x = v reassigns under the existing declaration
+	if assignment {
+		typ = env.TypeOf(name)
+	}
+
+	val, ok := coerceToDeclaredType(typ, val)
+	if !ok {
+		return newErrorWithToken("type mismatch: cannot assign %s to %s variable %s",
+			tok, val.Type(), typ, name)
+	}
+
+	if !assignment {
+		env.Declare(name, val, typ, constant)
+	} else if _, ok := env.Assign(name, val); !ok {
+		return newErrorWithToken("assignment to undeclared variable: %s", tok, name)
+	}
+	return val
+}
+
+// checks val against a declared type, widening int to float where needed
+func coerceToDeclaredType(typ string, val Object) (Object, bool) {
+	switch typ {
+	case "":
+		return val, true
+	case "int":
+		return val, val.Type() == INTEGER_OBJ
+	case "float":
+		if integer, ok := val.(*Integer); ok {
+			return &Float{Value: float64(integer.Value)}, true
+		}
+		return val, val.Type() == FLOAT_OBJ
+	case "string":
+		return val, val.Type() == STRING_OBJ
+	case "bool":
+		return val, val.Type() == BOOLEAN_OBJ
+	default:
+		return val, false
+	}
+}
+
 // evaluates print statement
 func evalPrintStatement(node *ast.PrintStatement, env *Environment) Object {
 	val := Eval(node.Value, env)
@@ -132,10 +273,23 @@ func evalPrintStatement(node *ast.PrintStatement, env *Environment) Object {
 		return val
 	}
 
-	fmt.Println(val.Inspect())
+	fmt.Fprintln(env.ExecContext().Out, val.Inspect())
 	return val
 }
 
+// evaluates return statement
+func evalReturnStatement(node *ast.ReturnStatement, env *Environment) Object {
+	if node.ReturnValue == nil {
+		return &ReturnValue{Value: NULL}
+	}
+
+	val := Eval(node.ReturnValue, env)
+	if isError(val) {
+		return val
+	}
+	return &ReturnValue{Value: val}
+}
+
 // evaluates if-else expression
 func evalIfExpression(ie *ast.IfExpression, env *Environment) Object {
 	logger.Trace("IfExpression")
@@ -158,21 +312,425 @@ func evalIfExpression(ie *ast.IfExpression, env *Environment) Object {
 	}
 }
 
+// evaluates while loop
+func evalWhileStatement(ws *ast.WhileStatement, env *Environment) Object {
+	logger.Trace("WhileStatement")
+	for {
+		condition := Eval(ws.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		if stop, result := evalLoopBody(ws.Body, env); stop {
+			return result
+		}
+	}
+}
+
+// evaluates c-style for loop
+func evalForStatement(fs *ast.ForStatement, outer *Environment) Object {
+	logger.Trace("ForStatement")
+
+	// variables declared in the init clause are scoped to the loop
+	env := NewEnclosedEnvironment(outer)
+	if fs.Init != nil {
+		if init := Eval(fs.Init, env); isError(init) {
+			return init
+		}
+	}
+
+	for {
+		if fs.Condition != nil {
+			condition := Eval(fs.Condition, env)
+			if isError(condition) {
+				return condition
+			}
+			if !isTruthy(condition) {
+				return NULL
+			}
+		}
+
+		if stop, result := evalLoopBody(fs.Body, env); stop {
+			return result
+		}
+
+		if fs.Post != nil {
+			if post := Eval(fs.Post, env); isError(post) {
+				return post
+			}
+		}
+	}
+}
+
+// runs one loop iteration in a fresh scope and reports whether the loop has to stop,
+// together with the value the loop statement should produce
+func evalLoopBody(body *ast.BlockStatement, env *Environment) (bool, Object) {
+	result := Eval(body, env)
+	switch result.(type) {
+	case *Error, *ReturnValue:
+		return true, result
+	case *Break:
+		logger.Trace("Break out of loop")
+		return true, NULL
+	default:
+		return false, nil
+	}
+}
+
 // evaluates identifier (variable lookup)
 func evalIdentifier(node *ast.Identifier, env *Environment) Object {
 	logger.Trace("Identifier lookup: %s", node.Value)
-	val, ok := env.Get(node.Value)
-	if !ok {
-		return &Error{
-			Message: fmt.Sprintf("identifier not found: %s", node.Value),
-			Line:    node.Token.Line,
-			Column:  node.Token.Column,
+	if node.Slot.Resolved {
+		if val, ok := env.GetSlot(node.Slot.Depth, node.Slot.Index, node.Value); ok {
+			return val
 		}
 	}
-	logger.Trace("Found %s = %s", node.Value, val.Inspect())
+	val := Lookup(env, node.Value, node.Token)
+	if !isError(val) {
+		logger.Trace("Found %s = %s", node.Value, val.Inspect())
+	}
 	return val
 }
 
+// resolves a name to a variable, then to a builtin, since variables shadow builtins
+func Lookup(env *Environment, name string, tok token.Token) Object {
+	if val, ok := env.Get(name); ok {
+		return val
+	}
+	if builtin, ok := env.Builtins().Lookup(name); ok {
+		return builtin
+	}
+	return newErrorWithToken("identifier not found: %s", tok, name)
+}
+
+// evaluates function call
+func evalCallExpression(node *ast.CallExpression, env *Environment) Object {
+	function := Eval(node.Function, env)
+	if isError(function) {
+		return function
+	}
+
+	args := evalExpressions(node.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+
+	// a literal called in place has no name worth showing
+	name := node.Function.String()
+	if _, ok := node.Function.(*ast.FunctionLiteral); ok {
+		name = ""
+	}
+	return applyFunction(function, args, node.Token, name)
+}
+
+// evaluates expressions left to right, stopping at the first error
+func evalExpressions(exps []ast.Expression, env *Environment) []Object {
+	result := make([]Object, 0, len(exps))
+
+	for _, e := range exps {
+		evaluated := Eval(e, env)
+		if isError(evaluated) {
+			return []Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+// calls a function object with already evaluated arguments, name is the
+// callee as written at the call site and only shown to a debugger
+func applyFunction(fn Object, args []Object, tok token.Token, name string) Object {
+	if builtin, ok := fn.(*Builtin); ok {
+		return applyBuiltin(builtin, args, tok)
+	}
+
+	function, ok := fn.(*Function)
+	if !ok {
+		return newErrorWithToken("not a function: %s", tok, fn.Type())
+	}
+
+	if len(args) != len(function.Parameters) {
+		return newErrorWithToken("wrong number of arguments: want=%d, got=%d",
+			tok, len(function.Parameters), len(args))
+	}
+
+	exec := function.Env.ExecContext()
+	if err := exec.Enter(tok); err != nil {
+		return err
+	}
+	defer exec.Leave()
+
+	logger.Trace("Call fn with %d argument(s)", len(args))
+	extendedEnv := NewEnclosedEnvironment(function.Env)
+	for i, param := range function.Parameters {
+		extendedEnv.Set(param.Value, args[i])
+	}
+
+	if exec.Hook != nil {
+		exec.Hook.EnterFunction(name, tok, extendedEnv)
+		defer exec.Hook.LeaveFunction()
+	}
+
+	// parameters and the body share one scope
+	evaluated := evalBlockStatement(function.Body, extendedEnv)
+	return unwrapReturnValue(evaluated)
+}
+
+// calls a builtin or an evaluator function, reporting errors at tok
+func ApplyFunction(fn Object, args []Object, tok token.Token) Object {
+	return applyFunction(fn, args, tok, "")
+}
+
+// calls a host function, errors it returns are reported at the call site
+func applyBuiltin(builtin *Builtin, args []Object, tok token.Token) Object {
+	logger.Trace("Call builtin %s with %d argument(s)", builtin.Name, len(args))
+	result := builtin.Fn(args...)
+	if result == nil {
+		return NULL
+	}
+	if err, ok := result.(*Error); ok && err.Line == 0 {
+		return &Error{Message: err.Message, Line: tok.Line, Column: tok.Column}
+	}
+	return result
+}
+
+// unwraps a return value so it stops bubbling past the function call
+func unwrapReturnValue(obj Object) Object {
+	if returnValue, ok := obj.(*ReturnValue); ok {
+		return returnValue.Value
+	}
+	return obj
+}
+
+// evaluates a[i]
+func evalIndexExpression(left, index Object, tok token.Token) Object {
+	switch {
+	case left.Type() == ARRAY_OBJ && index.Type() == INTEGER_OBJ:
+		array := left.(*Array)
+		idx, ok := arrayIndex(array, index.(*Integer).Value)
+		if !ok {
+			return newErrorWithToken("index out of range: %d (length %d)",
+				tok, index.(*Integer).Value, len(array.Elements))
+		}
+		return array.Elements[idx]
+	case left.Type() == ARRAY_OBJ:
+		return newErrorWithToken("array index must be INTEGER, got %s", tok, index.Type())
+	case left.Type() == HASH_OBJ:
+		key, ok := index.(Hashable)
+		if !ok {
+			return newErrorWithToken("unusable as hash key: %s", tok, index.Type())
+		}
+		if val, ok := left.(*Hash).Get(key); ok {
+			return val
+		}
+		return NULL
+	default:
+		return newErrorWithToken("index operator not supported: %s", tok, left.Type())
+	}
+}
+
+// evaluates a[low:high], missing bounds default to the start and end
+func evalSliceExpression(node *ast.SliceExpression, env *Environment) Object {
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+	if err := CheckSliceable(left, node.Token); err != nil {
+		return err
+	}
+
+	low, errObj := evalSliceBound(node.Low, node.Token, env)
+	if errObj != nil {
+		return errObj
+	}
+	high, errObj := evalSliceBound(node.High, node.Token, env)
+	if errObj != nil {
+		return errObj
+	}
+
+	return SliceArray(left.(*Array), low, high, node.Token)
+}
+
+// evaluates one slice bound, a missing bound gives nil
+func evalSliceBound(expr ast.Expression, tok token.Token, env *Environment) (*Integer, Object) {
+	if expr == nil {
+		return nil, nil
+	}
+
+	val := Eval(expr, env)
+	if isError(val) {
+		return nil, val
+	}
+	if err := CheckSliceBound(val, tok); err != nil {
+		return nil, err
+	}
+	return val.(*Integer), nil
+}
+
+// reports an error unless left can be sliced
+func CheckSliceable(left Object, tok token.Token) *Error {
+	if _, ok := left.(*Array); !ok {
+		return newErrorWithToken("slice operator not supported: %s", tok, left.Type())
+	}
+	return nil
+}
+
+// reports an error unless val can be used as a slice bound
+func CheckSliceBound(val Object, tok token.Token) *Error {
+	if _, ok := val.(*Integer); !ok {
+		return newErrorWithToken("slice bound must be INTEGER, got %s", tok, val.Type())
+	}
+	return nil
+}
+
+// copies array[low:high], nil bounds default to the start and end and
+// negative bounds count from the end
+func SliceArray(array *Array, low, high *Integer, tok token.Token) Object {
+	length := int64(len(array.Elements))
+	lo, hi := int64(0), length
+	if low != nil {
+		lo = low.Value
+		if lo < 0 {
+			lo += length
+		}
+	}
+	if high != nil {
+		hi = high.Value
+		if hi < 0 {
+			hi += length
+		}
+	}
+
+	if lo < 0 || hi > length || lo > hi {
+		return newErrorWithToken("slice bounds out of range: [%d:%d] (length %d)",
+			tok, lo, hi, length)
+	}
+
+	elements := make([]Object, hi-lo)
+	copy(elements, array.Elements[lo:hi])
+	return &Array{Elements: elements}
+}
+
+// evaluates a[i] = v
+func evalIndexAssignment(node *ast.IndexAssignment, env *Environment) Object {
+	left := Eval(node.Target.Left, env)
+	if isError(left) {
+		return left
+	}
+	index := Eval(node.Target.Index, env)
+	if isError(index) {
+		return index
+	}
+	val := Eval(node.Value, env)
+	if isError(val) {
+		return val
+	}
+
+	return SetIndex(left, index, val, node.Target.Token)
+}
+
+// stores val at left[index] and returns it
+func SetIndex(left, index, val Object, tok token.Token) Object {
+	switch {
+	case left.Type() == ARRAY_OBJ && index.Type() == INTEGER_OBJ:
+		array := left.(*Array)
+		idx, ok := arrayIndex(array, index.(*Integer).Value)
+		if !ok {
+			return newErrorWithToken("index out of range: %d (length %d)",
+				tok, index.(*Integer).Value, len(array.Elements))
+		}
+		array.Elements[idx] = val
+		return val
+	case left.Type() == ARRAY_OBJ:
+		return newErrorWithToken("array index must be INTEGER, got %s", tok, index.Type())
+	case left.Type() == HASH_OBJ:
+		if _, ok := index.(Hashable); !ok {
+			return newErrorWithToken("unusable as hash key: %s", tok, index.Type())
+		}
+		left.(*Hash).Set(index, val)
+		return val
+	default:
+		return newErrorWithToken("index assignment not supported: %s", tok, left.Type())
+	}
+}
+
+// evaluates {"k": v}, keys and values are evaluated in source order
+func evalHashLiteral(node *ast.HashLiteral, env *Environment) Object {
+	hash := NewHash()
+
+	for i, keyNode := range node.Keys {
+		key := Eval(keyNode, env)
+		if isError(key) {
+			return key
+		}
+		if err := CheckHashKey(key, node.Token); err != nil {
+			return err
+		}
+
+		value := Eval(node.Values[i], env)
+		if isError(value) {
+			return value
+		}
+
+		hash.Set(key, value)
+	}
+
+	return hash
+}
+
+// reports an error unless key can be used as a hash key
+func CheckHashKey(key Object, tok token.Token) *Error {
+	if _, ok := key.(Hashable); !ok {
+		return newErrorWithToken("unusable as hash key: %s", tok, key.Type())
+	}
+	return nil
+}
+
+// evaluates delete m[key], deleting a missing key is a no-op
+func evalDeleteStatement(node *ast.DeleteStatement, env *Environment) Object {
+	left := Eval(node.Target.Left, env)
+	if isError(left) {
+		return left
+	}
+	index := Eval(node.Target.Index, env)
+	if isError(index) {
+		return index
+	}
+
+	return DeleteKey(left, index, node.Target.Token)
+}
+
+// removes index from the hash left, deleting a missing key is a no-op
+func DeleteKey(left, index Object, tok token.Token) Object {
+	hash, ok := left.(*Hash)
+	if !ok {
+		return newErrorWithToken("delete not supported: %s", tok, left.Type())
+	}
+	key, ok := index.(Hashable)
+	if !ok {
+		return newErrorWithToken("unusable as hash key: %s", tok, index.Type())
+	}
+
+	hash.Delete(key)
+	return NULL
+}
+
+// helper: resolves a possibly negative index against the array length
+func arrayIndex(array *Array, index int64) (int64, bool) {
+	length := int64(len(array.Elements))
+	if index < 0 {
+		index += length
+	}
+	if index < 0 || index >= length {
+		return 0, false
+	}
+	return index, true
+}
+
 // evaluates prefix expressions (-, !, not)
 func evalPrefixExpression(operator string, right Object) Object {
 	switch operator {
@@ -185,30 +743,52 @@ func evalPrefixExpression(operator string, right Object) Object {
 	}
 }
 
-// evaluates infix expressions (+, -, *, /, %, **, ==, !=, <, >, <=, >=, &&, ||)
+// evaluates && and ||, the right operand is skipped once the left decides the result.
+// both operators always produce a boolean based on the truthiness of their operands.
+func evalLogicalExpression(node *ast.LogicalExpression, env *Environment) Object {
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	switch {
+	case node.Operator == "&&" && !isTruthy(left):
+		logger.Trace("LogicalExpression: short-circuit &&")
+		return FALSE
+	case node.Operator == "||" && isTruthy(left):
+		logger.Trace("LogicalExpression: short-circuit ||")
+		return TRUE
+	}
+
+	right := Eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
+// evaluates infix expressions (+, -, *, /, %, **, ==, !=, <, >, <=, >=)
 func evalInfixExpression(operator string, left, right Object, tok token.Token) Object {
 	logger.Trace("InfixExpression: %s %s %s", left.Inspect(), operator, right.Inspect())
 
 	switch {
 	// integer arithmetic
 	case left.Type() == INTEGER_OBJ && right.Type() == INTEGER_OBJ:
-		return evalIntegerInfixExpression(operator, left, right)
+		return evalIntegerInfixExpression(operator, left, right, tok)
 
 	// float arithmetic
 	case left.Type() == FLOAT_OBJ || right.Type() == FLOAT_OBJ:
-		return evalFloatInfixExpression(operator, left, right)
+		return evalFloatInfixExpression(operator, left, right, tok)
 
-	// boolean operations
+	// string comparison and concatenation
+	case left.Type() == STRING_OBJ && right.Type() == STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right, tok)
+
+	// value equality for everything else
 	case operator == "==":
-		return nativeBoolToBooleanObject(left == right)
+		return nativeBoolToBooleanObject(objectsEqual(left, right))
 	case operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
-
-	// logical operations
-	case operator == "&&":
-		return nativeBoolToBooleanObject(isTruthy(left) && isTruthy(right))
-	case operator == "||":
-		return nativeBoolToBooleanObject(isTruthy(left) || isTruthy(right))
+		return nativeBoolToBooleanObject(!objectsEqual(left, right))
 
 	// string concatenation with automatic type conversion
 	case (left.Type() == STRING_OBJ || right.Type() == STRING_OBJ) && operator == "+":
@@ -226,7 +806,7 @@ func evalInfixExpression(operator string, left, right Object, tok token.Token) O
 }
 
 // evaluates integer infix expressions
-func evalIntegerInfixExpression(operator string, left, right Object) Object {
+func evalIntegerInfixExpression(operator string, left, right Object, tok token.Token) Object {
 	leftVal := left.(*Integer).Value
 	rightVal := right.(*Integer).Value
 
@@ -239,12 +819,12 @@ func evalIntegerInfixExpression(operator string, left, right Object) Object {
 		return &Integer{Value: leftVal * rightVal}
 	case "/":
 		if rightVal == 0 {
-			return newError("division by zero")
+			return newErrorWithToken("division by zero", tok)
 		}
 		return &Integer{Value: leftVal / rightVal}
 	case "%":
 		if rightVal == 0 {
-			return newError("modulo by zero")
+			return newErrorWithToken("modulo by zero", tok)
 		}
 		return &Integer{Value: leftVal % rightVal}
 	case "**":
@@ -262,12 +842,12 @@ func evalIntegerInfixExpression(operator string, left, right Object) Object {
 	case "!=":
 		return nativeBoolToBooleanObject(leftVal != rightVal)
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newErrorWithToken("unknown operator: %s %s %s", tok, left.Type(), operator, right.Type())
 	}
 }
 
 // evaluates float infix expressions
-func evalFloatInfixExpression(operator string, left, right Object) Object {
+func evalFloatInfixExpression(operator string, left, right Object, tok token.Token) Object {
 	var leftVal, rightVal float64
 
 	// convert to float if needed
@@ -277,7 +857,7 @@ func evalFloatInfixExpression(operator string, left, right Object) Object {
 	case INTEGER_OBJ:
 		leftVal = float64(left.(*Integer).Value)
 	default:
-		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+		return newErrorWithToken("type mismatch: %s %s %s", tok, left.Type(), operator, right.Type())
 	}
 
 	switch right.Type() {
@@ -286,7 +866,7 @@ func evalFloatInfixExpression(operator string, left, right Object) Object {
 	case INTEGER_OBJ:
 		rightVal = float64(right.(*Integer).Value)
 	default:
-		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+		return newErrorWithToken("type mismatch: %s %s %s", tok, left.Type(), operator, right.Type())
 	}
 
 	switch operator {
@@ -298,7 +878,7 @@ func evalFloatInfixExpression(operator string, left, right Object) Object {
 		return &Float{Value: leftVal * rightVal}
 	case "/":
 		if rightVal == 0 {
-			return newError("division by zero")
+			return newErrorWithToken("division by zero", tok)
 		}
 		return &Float{Value: leftVal / rightVal}
 	case "**":
@@ -316,7 +896,32 @@ func evalFloatInfixExpression(operator string, left, right Object) Object {
 	case "!=":
 		return nativeBoolToBooleanObject(leftVal != rightVal)
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newErrorWithToken("unknown operator: %s %s %s", tok, left.Type(), operator, right.Type())
+	}
+}
+
+// evaluates string infix expressions, comparisons are lexicographic by byte
+func evalStringInfixExpression(operator string, left, right Object, tok token.Token) Object {
+	leftVal := left.(*String).Value
+	rightVal := right.(*String).Value
+
+	switch operator {
+	case "+":
+		return &String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	default:
+		return newErrorWithToken("unknown operator: %s %s %s", tok, left.Type(), operator, right.Type())
 	}
 }
 
@@ -362,6 +967,60 @@ func isTruthy(obj Object) bool {
 	}
 }
 
+// helper: compares two objects by value, collections are compared element by element
+// and numbers compare equal across int and float. functions compare by identity.
+func objectsEqual(left, right Object) bool {
+	switch left := left.(type) {
+	case *Integer:
+		switch right := right.(type) {
+		case *Integer:
+			return left.Value == right.Value
+		case *Float:
+			return float64(left.Value) == right.Value
+		}
+		return false
+	case *Float:
+		switch right := right.(type) {
+		case *Float:
+			return left.Value == right.Value
+		case *Integer:
+			return left.Value == float64(right.Value)
+		}
+		return false
+	case *String:
+		right, ok := right.(*String)
+		return ok && left.Value == right.Value
+	case *Boolean:
+		right, ok := right.(*Boolean)
+		return ok && left.Value == right.Value
+	case *Array:
+		right, ok := right.(*Array)
+		if !ok || len(left.Elements) != len(right.Elements) {
+			return false
+		}
+		for i := range left.Elements {
+			if !objectsEqual(left.Elements[i], right.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		right, ok := right.(*Hash)
+		if !ok || len(left.Pairs) != len(right.Pairs) {
+			return false
+		}
+		for key, pair := range left.Pairs {
+			other, ok := right.Pairs[key]
+			if !ok || !objectsEqual(pair.Value, other.Value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return left == right
+	}
+}
+
 // helper: converts native bool to Boolean object
 func nativeBoolToBooleanObject(input bool) *Boolean {
 	if input {
@@ -1,8 +1,15 @@
 package evaluator
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"lexicon/src/ast"
 	"lexicon/src/lexer"
 	"lexicon/src/parser"
+	"lexicon/src/token"
+	"strings"
 	"testing"
 )
 
@@ -139,6 +146,45 @@ func TestLogicalOperators(t *testing.T) {
 	}
 }
 
+func TestShortCircuitEvaluation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"sprout x = 0; x != 0 && 10 / x > 1;", false},
+		{"sprout x = 0; x == 0 || 10 / x > 1;", true},
+		{"false and undefinedName;", false},
+		{"true or undefinedName;", true},
+		{"sprout x = 5; x != 0 && 10 / x > 1;", true},
+		{"5 && \"yes\";", true},
+		{"0 || false;", true},
+		{"false || 0;", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+
+	// the right operand is not evaluated at all when skipped
+	input := `
+	sprout calls = [0];
+	sprout touch = fn() { calls[0] = calls[0] + 1; true; };
+	false && touch();
+	true || touch();
+	true && touch();
+	false || touch();
+	calls[0];
+	`
+	testIntegerObject(t, testEval(input), 2)
+
+	// errors in the evaluated operand still surface
+	errObj, ok := testEval("true && 10 / 0 > 1").(*Error)
+	if !ok || errObj.Message != "division by zero" || errObj.Line != 1 || errObj.Column != 12 {
+		t.Errorf("expected division by zero error at 1:12, got=%v", errObj)
+	}
+}
+
 func TestIfElseExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -218,6 +264,57 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "a"`, false},
+		{`"a" != "b"`, true},
+		{`sprout grade = "A"; grade == "A";`, true},
+		{`"apple" < "banana"`, true},
+		{`"apple" > "banana"`, false},
+		{`"abc" < "abd"`, true},
+		{`"ab" < "abc"`, true},
+		{`"B" < "a"`, true},
+		{`"a" <= "a"`, true},
+		{`"b" >= "a"`, true},
+		{`"b" <= "a"`, false},
+		{`"" < "a"`, true},
+		{`"1" == 1`, false},
+		{`"1" != 1`, true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestValueEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"[1, 2, 3] == [1, 2, 3]", true},
+		{"[1, 2, 3] == [1, 2]", false},
+		{"[1, 2, 3] != [1, 2, 4]", true},
+		{`["a", [true]] == ["a", [true]]`, true},
+		{"[1] == [1.0]", true},
+		{`sprout a = {"k": [1], 2: "v"}; sprout b = {2: "v", "k": [1]}; a == b;`, true},
+		{`sprout a = {"k": 1}; sprout b = {"k": 2}; a == b;`, false},
+		{`sprout a = {"k": 1}; sprout b = {"j": 1}; a != b;`, true},
+		{"[] == {}", false},
+		{"sprout f = fn() { 1 }; f == f;", true},
+		{"fn() { 1 } == fn() { 1 }", false},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestErrorHandling(t *testing.T) {
 	tests := []struct {
 		input           string
@@ -259,6 +356,14 @@ func TestErrorHandling(t *testing.T) {
 			"10 % 0",
 			"modulo by zero",
 		},
+		{
+			`"a" - "b"`,
+			"unknown operator: STRING - STRING",
+		},
+		{
+			`"a" < 1`,
+			"type mismatch: STRING < INTEGER",
+		},
 	}
 
 	for _, tt := range tests {
@@ -290,6 +395,115 @@ func TestNestedScopes(t *testing.T) {
 	testIntegerObject(t, evaluated, 30)
 }
 
+func TestBlockScoping(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		// a declaration inside a block shadows instead of overwriting
+		{"sprout x = 1; if (true) { sprout x = 2; } x;", 1},
+		{"sprout x = 1; if (false) { } else { sprout x = 2; } x;", 1},
+		{"sprout x = 1; { sprout x = 2; } x;", 1},
+		// assignment updates the nearest enclosing binding
+		{"sprout x = 1; if (true) { x = 2; } x;", 2},
+		{"sprout x = 1; if (true) { sprout x = 5; x = 2; } x;", 1},
+		{"sprout x = 1; if (true) { if (true) { x = x + 10; } } x;", 11},
+		{"sprout total = 0; for (sprout i = 1; i <= 3; i = i + 1) { sprout sq = i * i; total = total + sq; } total;", 14},
+		{"sprout i = 100; for (sprout i = 0; i < 3; i = i + 1) { } i;", 100},
+		// closures share the binding they captured
+		{`sprout counter = fn() {
+			sprout count = 0;
+			fn() { count = count + 1; count; };
+		};
+		sprout next = counter();
+		next(); next();
+		next();`, 3},
+		{"sprout x = 1; sprout set = fn() { x = 5; }; set(); x;", 5},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestBlockScopingErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"if (true) { sprout y = 1; } y;", "identifier not found: y"},
+		{"for (sprout i = 0; i < 1; i = i + 1) { } i;", "identifier not found: i"},
+		{"x = 5;", "assignment to undeclared variable: x"},
+		{"if (true) { z = 1; }", "assignment to undeclared variable: z"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestConstDeclarations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"const x = 5; x;", 5},
+		{"const x int = 5; x * 2;", 10},
+		{"const x = 1; if (true) { sprout x = 2; x; }", 2},
+		{"const x = 1; if (true) { const x = 3; x; }", 3},
+		{"const x = 1; sprout f = fn(x) { x = x + 1; x; }; f(10);", 11},
+		{"const a = [1, 2]; a[0] = 9; a[0];", 9},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestConstErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		// declared after the function, so only the evaluator can catch it
+		{"sprout f = fn() { rate = 0.5; }; const rate = 0.2; f();", "cannot assign to constant rate"},
+		{"const rate = 0.2; if (true) { rate = 0.5; }", "cannot assign to constant rate"},
+		{"const rate = 0.2; sprout rate = 0.5;", "cannot redeclare constant rate"},
+		{"const x float = true;", "type mismatch: cannot assign BOOLEAN to float variable x"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+
+	// the constant keeps its value after a failed assignment
+	env := NewEnvironment()
+	Eval(parser.New(lexer.New("const rate = 0.2; rate = 0.5;")).ParseProgram(), env)
+	testFloatObject(t, Eval(parser.New(lexer.New("rate")).ParseProgram(), env), 0.2)
+}
+
 func TestComplexExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -336,7 +550,704 @@ func TestComplexExpressions(t *testing.T) {
 	}
 }
 
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{"if (10 > 1) { if (10 > 1) { return 10; } return 1; }", 10},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) { x + 2; };"
+
+	evaluated := testEval(input)
+	fn, ok := evaluated.(*Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(fn.Parameters) != 1 || fn.Parameters[0].Value != "x" {
+		t.Fatalf("function has wrong parameters. Parameters=%+v", fn.Parameters)
+	}
+
+	if fn.Body.String() != "{ (x + 2) }" {
+		t.Fatalf("body is not %q. got=%q", "{ (x + 2) }", fn.Body.String())
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"sprout identity = fn(x) { x; }; identity(5);", 5},
+		{"sprout identity = fn(x) { return x; }; identity(5);", 5},
+		{"sprout double = fn(x) { x * 2; }; double(5);", 10},
+		{"sprout add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"sprout add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+		{"sprout f = func() { return 7; }; f();", 7},
+		{"sprout fact = fn(n) { if (n <= 1) { return 1; } return n * fact(n - 1); }; fact(5);", 120},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	input := `
+	sprout newAdder = fn(x) {
+		fn(y) { x + y };
+	};
+	sprout addTwo = newAdder(2);
+	addTwo(2);
+	`
+
+	testIntegerObject(t, testEval(input), 4)
+}
+
+func TestFunctionErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"sprout f = fn(x) { x; }; f(1, 2);", "wrong number of arguments: want=1, got=2"},
+		{"sprout x = 5; x(1);", "not a function: INTEGER"},
+		{"sprout f = fn() { y; }; f();", "identifier not found: y"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestWhileLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"sprout i = 0; while (i < 10) { i = i + 1; } i;", 10},
+		{"sprout i = 0; while (true) { i = i + 1; if (i == 3) { break; } } i;", 3},
+		{`sprout i = 0; sprout sum = 0;
+		while (i < 10) {
+			i = i + 1;
+			if (i % 2 == 0) { continue; }
+			sum = sum + i;
+		}
+		sum;`, 25},
+		{`sprout f = fn() { sprout i = 0; while (true) { i = i + 1; if (i == 4) { return i; } } };
+		f();`, 4},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestForLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"sprout sum = 0; for (sprout i = 1; i <= 4; i = i + 1) { sum = sum + i; } sum;", 10},
+		{"sprout sum = 0; for (sprout i = 0; i < 10; i = i + 1) { if (i == 5) { break; } sum = sum + i; } sum;", 10},
+		{"sprout sum = 0; for (sprout i = 0; i < 5; i = i + 1) { if (i == 2) { continue; } sum = sum + i; } sum;", 8},
+		{"sprout n = 0; for (;;) { n = n + 1; if (n > 6) { break; } } n;", 7},
+		{`sprout count = 0;
+		for (sprout i = 0; i < 3; i = i + 1) {
+			for (sprout j = 0; j < 3; j = j + 1) {
+				if (j == 1) { break; }
+				count = count + 1;
+			}
+		}
+		count;`, 3},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestLoopValueIsNull(t *testing.T) {
+	testNullObject(t, testEval("sprout i = 0; while (i < 2) { i = i + 1; }"))
+	testNullObject(t, testEval("for (sprout i = 0; i < 2; i = i + 1) { i; }"))
+}
+
+func TestArrayLiterals(t *testing.T) {
+	evaluated := testEval("[1, 2 * 2, 3 + 3]")
+
+	result, ok := evaluated.(*Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong num of elements. got=%d", len(result.Elements))
+	}
+
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+
+	if inspected := testEval(`[1, "two", [true]]`).Inspect(); inspected != `[1, "two", [true]]` {
+		t.Errorf("wrong Inspect output. got=%s", inspected)
+	}
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][2]", 3},
+		{"sprout i = 0; [1][i];", 1},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"sprout a = [1, 2, 3]; a[2];", 3},
+		{"sprout a = [1, 2, 3]; a[0] + a[1] + a[2];", 6},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-3]", 1},
+		{"sprout a = [1, 2, 3]; a[1] = 20; a[1];", 20},
+		{"sprout a = [1, 2, 3]; a[-1] = 30; a[2];", 30},
+		{"sprout a = [[1, 2], [3, 4]]; a[1][0] = 7; a[1][0];", 7},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestArraySliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3, 4][1:3]", "[2, 3]"},
+		{"[1, 2, 3, 4][:2]", "[1, 2]"},
+		{"[1, 2, 3, 4][2:]", "[3, 4]"},
+		{"[1, 2, 3, 4][:]", "[1, 2, 3, 4]"},
+		{"[1, 2, 3, 4][-2:]", "[3, 4]"},
+		{"[1, 2, 3, 4][1:-1]", "[2, 3]"},
+		{"[1, 2, 3][1:1]", "[]"},
+		{"sprout a = [1, 2, 3]; sprout b = a[:]; b[0] = 9; a;", "[1, 2, 3]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if _, ok := evaluated.(*Array); !ok {
+			t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong slice for %q. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestArrayErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+		line, column    int
+	}{
+		{"[1, 2, 3][3]", "index out of range: 3 (length 3)", 1, 10},
+		{"[1, 2, 3][-4]", "index out of range: -4 (length 3)", 1, 10},
+		{"sprout a = [1];\na[1] = 2;", "index out of range: 1 (length 1)", 2, 2},
+		{"[1, 2][1:5]", "slice bounds out of range: [1:5] (length 2)", 1, 7},
+		{"[1, 2][\"a\"]", "array index must be INTEGER, got STRING", 1, 7},
+		{"5[0]", "index operator not supported: INTEGER", 1, 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+		if errObj.Line != tt.line || errObj.Column != tt.column {
+			t.Errorf("wrong error position for %q. expected=%d:%d, got=%d:%d",
+				tt.input, tt.line, tt.column, errObj.Line, errObj.Column)
+		}
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `sprout two = "two";
+	sprout m = {
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	};
+	m;`
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := map[HashKey]int64{
+		(&String{Value: "one"}).HashKey():   1,
+		(&String{Value: "two"}).HashKey():   2,
+		(&String{Value: "three"}).HashKey(): 3,
+		(&Integer{Value: 4}).HashKey():      4,
+		TRUE.HashKey():                      5,
+		FALSE.HashKey():                     6,
+	}
+
+	if len(result.Pairs) != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	}
+
+	for expectedKey, expectedValue := range expected {
+		pair, ok := result.Pairs[expectedKey]
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+			continue
+		}
+		testIntegerObject(t, pair.Value, expectedValue)
+	}
+
+	if inspected := result.Inspect(); inspected != `{"one": 1, "two": 2, "three": 3, 4: 4, true: 5, false: 6}` {
+		t.Errorf("wrong Inspect output. got=%s", inspected)
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`sprout m = {"foo": 5}; m["foo"]`, 5},
+		{`sprout m = {"foo": 5}; m["bar"]`, nil},
+		{`sprout key = "foo"; sprout m = {"foo": 5}; m[key]`, 5},
+		{`sprout v = {}["foo"]; v;`, nil},
+		{`sprout v = {5: 5}[5]; v;`, 5},
+		{`sprout v = {true: 5}[true]; v;`, 5},
+		{`sprout m = {"a": 1}; m["b"] = 2; m["a"] + m["b"];`, 3},
+		{`sprout m = {"a": 1}; m["a"] = 7; m["a"];`, 7},
+		{`sprout m = {"a": 1, "b": 2}; delete m["a"]; m["a"];`, nil},
+		{`sprout m = {"a": 1, "b": 2}; delete m["zzz"]; m["b"];`, 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestHashOrderAfterUpdates(t *testing.T) {
+	input := `sprout m = {"a": 1, "b": 2, "c": 3};
+	m["a"] = 10;
+	delete m["b"];
+	m["d"] = 4;
+	m;`
+
+	if inspected := testEval(input).Inspect(); inspected != `{"a": 10, "c": 3, "d": 4}` {
+		t.Errorf("wrong Inspect output. got=%s", inspected)
+	}
+}
+
+func TestHashErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`sprout m = {"name": "Sprout"}; m[fn(x) { x }];`, "unusable as hash key: FUNCTION"},
+		{`sprout m = {[1]: 2};`, "unusable as hash key: ARRAY"},
+		{`sprout m = {}; m[[1]] = 2;`, "unusable as hash key: ARRAY"},
+		{`sprout a = [1]; delete a[0];`, "delete not supported: ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestTypedDeclarations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"sprout x int = 5; x;", int64(5)},
+		{"sprout x float = 2.5; x;", 2.5},
+		{"sprout x float = 2; x;", 2.0},
+		{"sprout x float = 1.5; x = 3; x;", 3.0},
+		{`sprout s string = "hi"; s = "bye"; s;`, "bye"},
+		{"sprout b bool = true; b = false; b;", false},
+		{`sprout x int = 1; sprout x = "now dynamic"; x = 2; x;`, int64(2)},
+		{`sprout x = 1; x = "dynamic"; x;`, "dynamic"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int64:
+			testIntegerObject(t, evaluated, expected)
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*String)
+			if !ok || str.Value != expected {
+				t.Errorf("expected string %q, got=%T (%+v)", expected, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestTypedDeclarationErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+		line, column    int
+	}{
+		{`sprout x int = "hello";`, "type mismatch: cannot assign STRING to int variable x", 1, 8},
+		{`sprout x int = 1.5;`, "type mismatch: cannot assign FLOAT to int variable x", 1, 8},
+		{"sprout x int = 1;\nx = 2.5;", "type mismatch: cannot assign FLOAT to int variable x", 2, 1},
+		{"sprout b bool = true;\nb = 1;", "type mismatch: cannot assign INTEGER to bool variable b", 2, 1},
+		{"sprout s string = \"a\";\nif (true) { s = 5; }", "type mismatch: cannot assign INTEGER to string variable s", 2, 13},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+		if errObj.Line != tt.line || errObj.Column != tt.column {
+			t.Errorf("wrong error position for %q. expected=%d:%d, got=%d:%d",
+				tt.input, tt.line, tt.column, errObj.Line, errObj.Column)
+		}
+	}
+}
+
 // helper functions
+func TestBuiltins(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("double", func(args ...Object) Object {
+		if len(args) != 1 {
+			return &Error{Message: "double: want 1 argument"}
+		}
+		n, ok := args[0].(*Integer)
+		if !ok {
+			return &Error{Message: "double: argument must be INTEGER"}
+		}
+		return &Integer{Value: n.Value * 2}
+	})
+	registry.Register("noop", func(args ...Object) Object { return nil })
+
+	run := func(input string) Object {
+		env := NewEnvironment()
+		env.SetBuiltins(registry)
+		return Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+	}
+
+	testIntegerObject(t, run("double(21);"), 42)
+	testIntegerObject(t, run("sprout f = fn(x) { double(x) + 1 }; f(2);"), 5)
+	testIntegerObject(t, run("sprout g = double; g(4);"), 8)
+	testNullObject(t, run("noop();"))
+	// script variables shadow builtins
+	testIntegerObject(t, run("sprout double = fn(x) { x }; double(3);"), 3)
+
+	if result := run("double;"); result.Inspect() != "builtin double" {
+		t.Errorf("wrong inspect, got=%q", result.Inspect())
+	}
+
+	errObj, ok := run("sprout x = 1;\ndouble(true);").(*Error)
+	if !ok {
+		t.Fatalf("expected error from builtin")
+	}
+	if errObj.Message != "double: argument must be INTEGER" || errObj.Line != 2 || errObj.Column != 7 {
+		t.Errorf("wrong builtin error: %+v", errObj)
+	}
+
+	// environments without a registry do not see builtins
+	if _, ok := testEval("double(1);").(*Error); !ok {
+		t.Errorf("expected identifier not found without a registry")
+	}
+
+	if names := registry.Names(); len(names) != 2 || names[0] != "double" || names[1] != "noop" {
+		t.Errorf("wrong names, got=%v", names)
+	}
+	if !registry.Unregister("noop") || registry.Unregister("noop") {
+		t.Errorf("unregister should succeed once")
+	}
+}
+
+func TestEchoWritesToExecContext(t *testing.T) {
+	var out bytes.Buffer
+	env := NewEnvironment()
+	env.SetExecContext(NewExecContext(&out, io.Discard))
+
+	input := `
+	echo "start";
+	sprout f = fn(x) { echo x * 2; };
+	for (sprout i = 1; i <= 2; i = i + 1) { f(i); }
+	echo [1, "a"];
+	`
+	Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+
+	expected := "start\n2\n4\n[1, \"a\"]\n"
+	if out.String() != expected {
+		t.Errorf("wrong output. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		limits   Limits
+		code     ErrorCode
+		expected string
+	}{
+		{"while (true) { }", Limits{MaxSteps: 1000}, STEP_LIMIT_EXCEEDED, "step limit exceeded: 1000"},
+		{"sprout f = fn(n) { f(n + 1) };\nf(0);", Limits{MaxDepth: 50}, DEPTH_LIMIT_EXCEEDED, "recursion depth limit exceeded: 50"},
+		{"sprout f = fn(n) { return f(n + 1); };\nf(0);", Limits{}, DEPTH_LIMIT_EXCEEDED, "recursion depth limit exceeded: 10000"},
+		{"sprout a = [];\nwhile (true) { a = [a]; }", Limits{MaxObjects: 100}, OBJECT_LIMIT_EXCEEDED, "object limit exceeded: 100"},
+		{`sprout s = ""; while (true) { s = s + "x"; }`, Limits{MaxObjects: 100}, OBJECT_LIMIT_EXCEEDED, "object limit exceeded: 100"},
+	}
+
+	for _, tt := range tests {
+		env := NewEnvironment()
+		env.ExecContext().Limits = tt.limits
+		result := Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env)
+
+		errObj, ok := result.(*Error)
+		if !ok {
+			t.Errorf("%q: expected error, got=%T (%+v)", tt.input, result, result)
+			continue
+		}
+		if errObj.Code != tt.code || errObj.Message != tt.expected {
+			t.Errorf("%q: wrong error. expected=%s %q, got=%s %q", tt.input, tt.code, tt.expected, errObj.Code, errObj.Message)
+		}
+	}
+}
+
+func TestLimitsResetPerProgram(t *testing.T) {
+	env := NewEnvironment()
+	env.ExecContext().Limits = Limits{MaxSteps: 200, MaxDepth: 3}
+
+	// each run gets the full budget, and calls that return free their depth
+	input := "sprout f = fn(n) { if (n > 0) { f(n - 1) } else { 0 } };\nf(2); f(2); f(2);"
+	for i := 0; i < 3; i++ {
+		if result := Eval(parser.New(lexer.New(input)).ParseProgram(), env); isError(result) {
+			t.Fatalf("run %d: unexpected error: %s", i, result.Inspect())
+		}
+	}
+}
+
+func TestEvalContextCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	env := NewEnvironment()
+	result := EvalContext(ctx, parser.New(lexer.New("while (true) { }")).ParseProgram(), env)
+	errObj, ok := result.(*Error)
+	if !ok || errObj.Code != CANCELLED {
+		t.Fatalf("expected CANCELLED error, got=%+v", result)
+	}
+	if errObj.Message != "execution cancelled: context canceled" {
+		t.Errorf("wrong message, got=%q", errObj.Message)
+	}
+
+	// the context only applies to that call
+	testIntegerObject(t, Eval(parser.New(lexer.New("1 + 1")).ParseProgram(), env), 2)
+}
+
+// records what the evaluator tells a debugger
+type recordingHook struct {
+	events []string
+	stopAt int // line whose statement stops the run, 0 for none
+}
+
+func (h *recordingHook) Statement(stmt ast.Statement, env *Environment) *Error {
+	h.events = append(h.events, fmt.Sprintf("line %d", stmt.Pos().Line))
+	if stmt.Pos().Line == h.stopAt {
+		return &Error{Message: "stopped", Code: CANCELLED}
+	}
+	return nil
+}
+
+func (h *recordingHook) EnterFunction(name string, call token.Token, env *Environment) {
+	h.events = append(h.events, fmt.Sprintf("enter %s from line %d with %v", name, call.Line, env.Names()))
+}
+
+func (h *recordingHook) LeaveFunction() {
+	h.events = append(h.events, "leave")
+}
+
+func TestHook(t *testing.T) {
+	input := `sprout f = fn(n) {
+	return n * 2;
+};
+if (true) {
+	echo f(1);
+}
+echo fn() { 3 }();`
+	hook := &recordingHook{}
+	env := NewEnvironment()
+	env.SetExecContext(NewExecContext(io.Discard, io.Discard))
+	env.ExecContext().Hook = hook
+	Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+
+	expected := []string{
+		"line 1", "line 4", "line 5",
+		"enter f from line 5 with [n]", "line 2", "leave",
+		"line 7", "enter  from line 7 with []", "line 7", "leave",
+	}
+	if strings.Join(hook.events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected %q, got=%q", expected, hook.events)
+	}
+
+	// an error from the hook ends the run before the statement
+	hook = &recordingHook{stopAt: 2}
+	var out bytes.Buffer
+	env = NewEnvironment()
+	env.SetExecContext(NewExecContext(&out, io.Discard))
+	env.ExecContext().Hook = hook
+	result := Eval(parser.New(lexer.New("echo 1;\necho 2;\necho 3;")).ParseProgram(), env)
+	if errObj, ok := result.(*Error); !ok || errObj.Code != CANCELLED {
+		t.Fatalf("expected the hook's error, got=%+v", result)
+	}
+	if out.String() != "1\n" {
+		t.Errorf("expected only the first statement to run, got=%q", out.String())
+	}
+}
+
+func TestEnvironmentSlots(t *testing.T) {
+	outer := NewEnvironment()
+	// enough bindings to switch the scope to its name index
+	names := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}
+	for i, name := range names {
+		outer.Declare(name, &Integer{Value: int64(i)}, "", false)
+	}
+	outer.Declare("c", &Integer{Value: 42}, "int", true)
+
+	if got := outer.Names(); strings.Join(got, "") != strings.Join(names, "") {
+		t.Fatalf("expected names in slot order, got=%v", got)
+	}
+	if !outer.IsLocalConst("c") || outer.TypeOf("c") != "int" {
+		t.Errorf("redeclaration lost its attributes")
+	}
+
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("x", &Integer{Value: 7})
+
+	tests := []struct {
+		depth, index int
+		name         string
+		expected     int64
+	}{
+		{0, 0, "x", 7},
+		{1, 2, "c", 42},
+		{1, 9, "j", 9},
+		// a stale slot falls back to a lookup by name
+		{1, 0, "j", 9},
+		{0, 5, "x", 7},
+		{3, 0, "a", 0},
+	}
+
+	for _, tt := range tests {
+		val, ok := inner.GetSlot(tt.depth, tt.index, tt.name)
+		if !ok {
+			t.Errorf("slot (%d, %d) %s: not found", tt.depth, tt.index, tt.name)
+			continue
+		}
+		testIntegerObject(t, val, tt.expected)
+	}
+
+	if _, ok := inner.GetSlot(0, 0, "missing"); ok {
+		t.Errorf("expected a missing name to stay missing")
+	}
+}
+
+func TestErrorDiagnostic(t *testing.T) {
+	tests := []struct {
+		input    string
+		code     string
+		line     int
+		column   int
+		expected string
+	}{
+		{"sprout x = 1;\nx / 0;", RUNTIME_ERROR, 2, 3, "division by zero"},
+		{"-true;", RUNTIME_ERROR, 0, 0, "unknown operator: -BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*Error)
+		if !ok {
+			t.Fatalf("%q: expected an error", tt.input)
+		}
+		d := errObj.Diagnostic()
+		if d.Code != tt.code || d.Message != tt.expected ||
+			d.Span.Start.Line != tt.line || d.Span.Start.Column != tt.column {
+			t.Errorf("%q: wrong diagnostic, got=%+v", tt.input, d)
+		}
+	}
+
+	stopped := &Error{Message: "step limit exceeded: 1", Code: STEP_LIMIT_EXCEEDED}
+	if d := stopped.Diagnostic(); d.Code != string(STEP_LIMIT_EXCEEDED) {
+		t.Errorf("expected the limit code, got=%s", d.Code)
+	}
+}
+
 func testEval(input string) Object {
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -0,0 +1,144 @@
+package evaluator
+
+import (
+	"context"
+	"io"
+	"lexicon/src/ast"
+	"lexicon/src/token"
+	"os"
+)
+
+// per-run settings shared by every scope of an environment
+type ExecContext struct {
+	Out    io.Writer // echo output
+	Err    io.Writer // diagnostics
+	Limits Limits
+	Hook   Hook // follows the run for a debugger, nil when not debugging
+
+	ctx     context.Context
+	steps   int
+	depth   int
+	objects int
+}
+
+// Hook is told where a program run is so that a debugger can pause it. the
+// evaluator calls Statement before each statement of a program or block and
+// EnterFunction and LeaveFunction around each call of a Sprout function.
+// Statement blocks for as long as the program is paused, returning an error
+// stops the run with that error
+type Hook interface {
+	Statement(stmt ast.Statement, env *Environment) *Error
+	EnterFunction(name string, call token.Token, env *Environment)
+	LeaveFunction()
+}
+
+// caps on a single program run, zero means unlimited except for the call
+// depth, which falls back to DEFAULT_MAX_DEPTH
+type Limits struct {
+	MaxSteps   int // evaluated nodes
+	MaxDepth   int // nested function calls
+	MaxObjects int // allocated values, booleans and null are shared and not counted
+}
+
+// the call depth allowed when Limits.MaxDepth is zero. runaway recursion
+// ends with a DEPTH_LIMIT_EXCEEDED error long before the evaluator overflows
+// the Go stack or the vm exhausts memory
+const DEFAULT_MAX_DEPTH = 10000
+
+// creates an execution context writing to the given streams
+func NewExecContext(out, errOut io.Writer) *ExecContext {
+	return &ExecContext{Out: out, Err: errOut}
+}
+
+// creates an execution context writing to stdout and stderr
+func defaultExecContext() *ExecContext {
+	return NewExecContext(os.Stdout, os.Stderr)
+}
+
+// evaluates node like Eval, stopping with a CANCELLED error once ctx is done
+func EvalContext(ctx context.Context, node ast.Node, env *Environment) Object {
+	exec := env.ExecContext()
+	prev := exec.SetContext(ctx)
+	defer exec.SetContext(prev)
+	return Eval(node, env)
+}
+
+// sets the context checked for cancellation and returns the previous one
+func (c *ExecContext) SetContext(ctx context.Context) context.Context {
+	prev := c.ctx
+	c.ctx = ctx
+	return prev
+}
+
+// tells the hook, if any, that stmt is about to run in env
+func pause(stmt ast.Statement, env *Environment) *Error {
+	exec := env.ExecContext()
+	if exec.Hook == nil {
+		return nil
+	}
+	return exec.Hook.Statement(stmt, env)
+}
+
+// clears the counters at the start of a program run
+func (c *ExecContext) Reset() {
+	c.steps = 0
+	c.depth = 0
+	c.objects = 0
+}
+
+// counts one evaluation step and checks cancellation
+func (c *ExecContext) Step() *Error {
+	if c.ctx != nil {
+		select {
+		case <-c.ctx.Done():
+			return newLimitError(CANCELLED, "execution cancelled: %s", c.ctx.Err())
+		default:
+		}
+	}
+
+	c.steps++
+	if c.Limits.MaxSteps > 0 && c.steps > c.Limits.MaxSteps {
+		return newLimitError(STEP_LIMIT_EXCEEDED, "step limit exceeded: %d", c.Limits.MaxSteps)
+	}
+	return nil
+}
+
+// counts a newly allocated value, passing it through when within the limit
+func (c *ExecContext) Track(obj Object) Object {
+	switch obj.(type) {
+	case *Boolean, *Null, *Error:
+		return obj
+	}
+
+	c.objects++
+	if c.Limits.MaxObjects > 0 && c.objects > c.Limits.MaxObjects {
+		return newLimitError(OBJECT_LIMIT_EXCEEDED, "object limit exceeded: %d", c.Limits.MaxObjects)
+	}
+	return obj
+}
+
+// enters a function call, callers must Leave() when it returns
+func (c *ExecContext) Enter(tok token.Token) *Error {
+	limit := c.Limits.MaxDepth
+	if limit <= 0 {
+		limit = DEFAULT_MAX_DEPTH
+	}
+	if c.depth >= limit {
+		err := newErrorWithToken("recursion depth limit exceeded: %d", tok, limit)
+		err.Code = DEPTH_LIMIT_EXCEEDED
+		return err
+	}
+	c.depth++
+	return nil
+}
+
+func (c *ExecContext) Leave() {
+	c.depth--
+}
+
+// helper: creates an error carrying a limit code
+func newLimitError(code ErrorCode, format string, a ...interface{}) *Error {
+	err := newError(format, a...)
+	err.Code = code
+	return err
+}
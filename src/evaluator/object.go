@@ -1,6 +1,13 @@
 package evaluator
 
-import "fmt"
+import (
+	"fmt"
+	"hash/fnv"
+	"lexicon/src/ast"
+	"lexicon/src/diagnostic"
+	"strconv"
+	"strings"
+)
 
 // object system for runtime values
 type ObjectType string
@@ -12,6 +19,15 @@ const (
 	STRING_OBJ  = "STRING"
 	NULL_OBJ    = "NULL"
 	ERROR_OBJ   = "ERROR"
+
+	ARRAY_OBJ = "ARRAY"
+	HASH_OBJ  = "HASH"
+
+	FUNCTION_OBJ     = "FUNCTION"
+	BUILTIN_OBJ      = "BUILTIN"
+	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
 )
 
 type Object interface {
@@ -62,8 +78,19 @@ type Error struct {
 	Message string
 	Line    int
 	Column  int
+	Code    ErrorCode // set when execution was stopped by a limit or cancellation
 }
 
+// distinguishes errors that stop a run from ordinary runtime errors
+type ErrorCode string
+
+const (
+	STEP_LIMIT_EXCEEDED   ErrorCode = "STEP_LIMIT_EXCEEDED"
+	DEPTH_LIMIT_EXCEEDED  ErrorCode = "DEPTH_LIMIT_EXCEEDED"
+	OBJECT_LIMIT_EXCEEDED ErrorCode = "OBJECT_LIMIT_EXCEEDED"
+	CANCELLED             ErrorCode = "CANCELLED"
+)
+
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string {
 	if e.Line > 0 {
@@ -72,9 +99,176 @@ func (e *Error) Inspect() string {
 	return "ERROR: " + e.Message
 }
 
-// singleton null and boolean objects for efficiency
+// RUNTIME_ERROR is the diagnostic code of errors without an ErrorCode
+const RUNTIME_ERROR = "RUNTIME_ERROR"
+
+// converts the error to a diagnostic, runtime errors only know where they start
+func (e *Error) Diagnostic() diagnostic.Diagnostic {
+	code := string(e.Code)
+	if code == "" {
+		code = RUNTIME_ERROR
+	}
+	return diagnostic.At(diagnostic.Error, code, e.Line, e.Column, e.Message)
+}
+
+// array object
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() ObjectType { return ARRAY_OBJ }
+func (a *Array) Inspect() string {
+	elements := make([]string, 0, len(a.Elements))
+	for _, el := range a.Elements {
+		elements = append(elements, inspectElement(el))
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// quotes strings nested inside collections so ["1"] and [1] look different
+func inspectElement(obj Object) string {
+	if str, ok := obj.(*String); ok {
+		return strconv.Quote(str.Value)
+	}
+	return obj.Inspect()
+}
+
+// hash key, equal values of the same type produce equal keys
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+// implemented by objects usable as hash keys
+type Hashable interface {
+	HashKey() HashKey
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// hash object, remembers insertion order so output is stable
+type Hash struct {
+	Pairs map[HashKey]HashPair
+	Order []HashKey
+}
+
+func NewHash() *Hash {
+	return &Hash{Pairs: make(map[HashKey]HashPair)}
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string {
+	pairs := make([]string, 0, len(h.Order))
+	for _, key := range h.Order {
+		pair := h.Pairs[key]
+		pairs = append(pairs, inspectElement(pair.Key)+": "+inspectElement(pair.Value))
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// looks up the value stored under key
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	pair, ok := h.Pairs[key.HashKey()]
+	return pair.Value, ok
+}
+
+// stores value under key, keeping the original position of existing keys
+func (h *Hash) Set(key Object, value Object) {
+	hashKey := key.(Hashable).HashKey()
+	if _, ok := h.Pairs[hashKey]; !ok {
+		h.Order = append(h.Order, hashKey)
+	}
+	h.Pairs[hashKey] = HashPair{Key: key, Value: value}
+}
+
+// removes key and reports whether it was present
+func (h *Hash) Delete(key Hashable) bool {
+	hashKey := key.HashKey()
+	if _, ok := h.Pairs[hashKey]; !ok {
+		return false
+	}
+	delete(h.Pairs, hashKey)
+	for i, k := range h.Order {
+		if k == hashKey {
+			h.Order = append(h.Order[:i], h.Order[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// function object, closes over the environment it was defined in
+type Function struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+func (f *Function) Inspect() string {
+	params := make([]string, 0, len(f.Parameters))
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+	return "fn(" + strings.Join(params, ", ") + ") " + f.Body.String()
+}
+
+// native function supplied by the host
+type BuiltinFunction func(args ...Object) Object
+
+type Builtin struct {
+	Name string
+	Fn   BuiltinFunction
+}
+
+func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+func (b *Builtin) Inspect() string  { return "builtin " + b.Name }
+
+// wraps the value of a return statement while it unwinds to the call site
+type ReturnValue struct {
+	Value Object
+}
+
+func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
+func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
+
+// loop control signals, unwound by the innermost enclosing loop
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
+// singleton null, boolean and loop control objects for efficiency
 var (
-	NULL  = &Null{}
-	TRUE  = &Boolean{Value: true}
-	FALSE = &Boolean{Value: false}
+	NULL     = &Null{}
+	TRUE     = &Boolean{Value: true}
+	FALSE    = &Boolean{Value: false}
+	BREAK    = &Break{}
+	CONTINUE = &Continue{}
 )
@@ -0,0 +1,31 @@
+package evaluator
+
+import "lexicon/src/token"
+
+// exported forms of the evaluator's operators, the vm package runs them so
+// that both engines produce the same values and errors
+
+// applies a binary operator such as + or <
+func InfixOperation(operator string, left, right Object, tok token.Token) Object {
+	return evalInfixExpression(operator, left, right, tok)
+}
+
+// applies a unary operator, ! or -
+func PrefixOperation(operator string, right Object) Object {
+	return evalPrefixExpression(operator, right)
+}
+
+// reads left[index]
+func IndexOperation(left, index Object, tok token.Token) Object {
+	return evalIndexExpression(left, index, tok)
+}
+
+// reports whether obj counts as true in a condition
+func IsTruthy(obj Object) bool {
+	return isTruthy(obj)
+}
+
+// returns the shared boolean object for b
+func NativeBool(b bool) *Boolean {
+	return nativeBoolToBooleanObject(b)
+}
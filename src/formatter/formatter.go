@@ -0,0 +1,509 @@
+package formatter
+
+import (
+	"lexicon/src/ast"
+	"lexicon/src/diagnostic"
+	"lexicon/src/lexer"
+	"lexicon/src/parser"
+	"lexicon/src/token"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// the canonical style indents blocks by four spaces, ends every simple
+// statement with a semicolon, keeps at most one blank line between statements
+// and puts only the parentheses the parser needs around expressions
+const indentation = "    "
+
+// ParseError is returned for source that does not parse, it is never
+// formatted since the program the parser recovered is incomplete
+type ParseError struct {
+	Diagnostics []diagnostic.Diagnostic
+}
+
+func (e *ParseError) Error() string {
+	return "parse error: " + strings.Join(diagnostic.Strings(e.Diagnostics), "; ")
+}
+
+// parses source and prints it in the canonical style, strings are copied as
+// they were written so their escapes stay the same
+func Format(source string) (string, error) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return "", &ParseError{Diagnostics: p.Diagnostics()}
+	}
+
+	pr := &printer{source: source, comments: program.Comments}
+	pr.program(program)
+	return pr.out.String(), nil
+}
+
+// prints a parsed program with its comments in the canonical style
+func Print(program *ast.Program) string {
+	pr := &printer{comments: program.Comments}
+	pr.program(program)
+	return pr.out.String()
+}
+
+type printer struct {
+	out    strings.Builder
+	source string // original text, empty when only the tree is known
+	indent int
+
+	comments []*ast.Comment
+	next     int // first comment not printed yet
+
+	lineStart  bool // nothing written on the current output line
+	lastLine   int  // source line the last statement or comment ended on
+	blockStart bool // nothing printed yet in the current block
+}
+
+func (p *printer) write(s string) {
+	if p.lineStart {
+		p.out.WriteString(strings.Repeat(indentation, p.indent))
+		p.lineStart = false
+	}
+	p.out.WriteString(s)
+}
+
+func (p *printer) newline() {
+	p.out.WriteString("\n")
+	p.lineStart = true
+}
+
+// keeps one blank line before something that had at least one above it
+func (p *printer) separate(line int) {
+	if !p.blockStart && line > p.lastLine+1 {
+		p.newline()
+	}
+	p.blockStart = false
+}
+
+// prints the comments that start before offset, each on its own line
+func (p *printer) commentsBefore(offset int) {
+	for p.next < len(p.comments) && p.comments[p.next].Token.Offset < offset {
+		c := p.comments[p.next]
+		p.separate(c.Token.Line)
+		p.write(strings.TrimRight(c.Token.Literal, " \t\r"))
+		p.newline()
+		p.lastLine = c.Token.Line
+		p.next++
+	}
+}
+
+// appends a comment that shares line with what was just printed, as long as
+// it starts before offset
+func (p *printer) trailingComment(line, offset int) {
+	if p.next < len(p.comments) {
+		c := p.comments[p.next]
+		if c.Token.Line == line && c.Token.Offset < offset {
+			p.write("  " + strings.TrimRight(c.Token.Literal, " \t\r"))
+			p.next++
+		}
+	}
+}
+
+func (p *printer) program(program *ast.Program) {
+	p.lineStart = true
+	p.blockStart = true
+	p.statements(program.Statements, math.MaxInt)
+	p.commentsBefore(math.MaxInt)
+}
+
+// prints statements each on its own line, limit is the offset where the
+// enclosing block ends
+func (p *printer) statements(statements []ast.Statement, limit int) {
+	for i, stmt := range statements {
+		pos := stmt.Pos()
+		p.commentsBefore(pos.Offset)
+		p.separate(pos.Line)
+		p.statement(stmt)
+
+		// a comment after the next statement on the same line belongs to that one
+		next := limit
+		if i+1 < len(statements) {
+			next = statements[i+1].Pos().Offset
+		}
+		end := stmt.End()
+		p.trailingComment(end.Line, next)
+		p.newline()
+		p.lastLine = end.Line
+	}
+}
+
+func (p *printer) block(block *ast.BlockStatement) {
+	end := block.End()
+	p.write("{")
+	if len(block.Statements) == 0 && (p.next >= len(p.comments) || p.comments[p.next].Token.Offset >= end.Offset) {
+		p.write("}")
+		return
+	}
+
+	first := end.Offset
+	if len(block.Statements) > 0 {
+		first = block.Statements[0].Pos().Offset
+	}
+	p.trailingComment(block.Token.Line, first)
+	p.newline()
+
+	p.indent++
+	p.blockStart = true
+	p.lastLine = block.Token.Line
+	p.statements(block.Statements, end.Offset)
+	p.commentsBefore(end.Offset)
+	p.indent--
+
+	p.write("}")
+	p.blockStart = false
+}
+
+func (p *printer) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.IfExpression:
+		p.ifStatement(stmt)
+	case *ast.BlockStatement:
+		p.block(stmt)
+	case *ast.WhileStatement:
+		p.write("while (")
+		p.expression(stmt.Condition)
+		p.write(") ")
+		p.block(stmt.Body)
+	case *ast.ForStatement:
+		p.write("for (")
+		if stmt.Init != nil {
+			p.simpleStatement(stmt.Init)
+		}
+		p.write(";")
+		if stmt.Condition != nil {
+			p.write(" ")
+			p.expression(stmt.Condition)
+		}
+		p.write(";")
+		if stmt.Post != nil {
+			p.write(" ")
+			p.simpleStatement(stmt.Post)
+		}
+		p.write(") ")
+		p.block(stmt.Body)
+	case *ast.PrintStatement:
+		p.write("echo ")
+		p.expression(stmt.Value)
+		p.write(";")
+	case *ast.ReturnStatement:
+		p.write("return")
+		if stmt.ReturnValue != nil {
+			p.write(" ")
+			p.expression(stmt.ReturnValue)
+		}
+		p.write(";")
+	case *ast.BreakStatement:
+		p.write("break;")
+	case *ast.ContinueStatement:
+		p.write("continue;")
+	case *ast.DeleteStatement:
+		p.write("delete ")
+		p.expression(stmt.Target)
+		p.write(";")
+	default:
+		p.simpleStatement(stmt)
+		p.write(";")
+	}
+}
+
+// statements that can also be a for loop's init or post clause, printed
+// without their semicolon
+func (p *printer) simpleStatement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.VariableDeclaration:
+		if stmt.IsConstant() {
+			p.write("const ")
+		} else if !stmt.IsAssignment() {
+			p.write("sprout ")
+		}
+		p.write(stmt.Name.Value)
+		if stmt.Type != nil {
+			p.write(" " + stmt.Type.Value)
+		}
+		p.write(" = ")
+		p.expression(stmt.Value)
+	case *ast.IndexAssignment:
+		p.expression(stmt.Target)
+		p.write(" = ")
+		p.expression(stmt.Value)
+	case *ast.ExpressionStatement:
+		// a { at statement start would open a block
+		p.operand(stmt.Expression, leading(stmt.Expression) == '{')
+	default:
+		p.write(stmt.String())
+	}
+}
+
+func (p *printer) ifStatement(stmt *ast.IfExpression) {
+	p.write("if (")
+	p.expression(stmt.Condition)
+	p.write(") ")
+	p.block(stmt.Consequence)
+	if stmt.Alternative != nil {
+		p.write(" else ")
+		p.block(stmt.Alternative)
+	}
+}
+
+func (p *printer) operand(e ast.Expression, parens bool) {
+	if parens {
+		p.write("(")
+		p.expression(e)
+		p.write(")")
+		return
+	}
+	p.expression(e)
+}
+
+func (p *printer) expression(e ast.Expression) {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		p.write(e.Value)
+	case *ast.IntegerLiteral:
+		p.write(literal(e.Token, strconv.FormatInt(e.Value, 10)))
+	case *ast.FloatLiteral:
+		p.write(literal(e.Token, formatFloat(e.Value)))
+	case *ast.BooleanLiteral:
+		p.write(strconv.FormatBool(e.Value))
+	case *ast.StringLiteral:
+		p.write(p.stringLiteral(e))
+	case *ast.PrefixExpression:
+		p.write(e.Operator)
+		// - -x must not read as --x
+		if right, ok := e.Right.(*ast.PrefixExpression); ok && right.Operator == e.Operator {
+			p.write(" ")
+		}
+		p.operand(e.Right, precedence(e.Right) < parser.PREFIX)
+	case *ast.InfixExpression:
+		p.binary(e.Left, e.Operator, e.Right)
+	case *ast.LogicalExpression:
+		p.binary(e.Left, e.Operator, e.Right)
+	case *ast.CallExpression:
+		p.operand(e.Function, precedence(e.Function) < parser.CALL)
+		p.list(e.Token, ")", e.End(), e.Arguments)
+	case *ast.IndexExpression:
+		p.operand(e.Left, precedence(e.Left) < parser.CALL)
+		p.write("[")
+		p.expression(e.Index)
+		p.write("]")
+	case *ast.SliceExpression:
+		p.operand(e.Left, precedence(e.Left) < parser.CALL)
+		p.write("[")
+		if e.Low != nil {
+			p.expression(e.Low)
+		}
+		p.write(":")
+		if e.High != nil {
+			p.expression(e.High)
+		}
+		p.write("]")
+	case *ast.ArrayLiteral:
+		p.list(e.Token, "]", e.End(), e.Elements)
+	case *ast.HashLiteral:
+		span := func(i int) (token.Position, token.Position) { return e.Keys[i].Pos(), e.Values[i].End() }
+		p.items(e.Token, "}", e.End(), len(e.Keys), span, func(i int) {
+			p.expression(e.Keys[i])
+			p.write(": ")
+			p.expression(e.Values[i])
+		})
+	case *ast.FunctionLiteral:
+		params := make([]string, len(e.Parameters))
+		for i, param := range e.Parameters {
+			params[i] = param.Value
+		}
+		p.write("fn(" + strings.Join(params, ", ") + ") ")
+		p.block(e.Body)
+	case *ast.IfExpression:
+		p.ifStatement(e)
+	default:
+		p.write(e.String())
+	}
+}
+
+func (p *printer) binary(left ast.Expression, operator string, right ast.Expression) {
+	prec := parser.Precedence(token.TokenType(operator))
+	p.operand(left, wrapsLeft(prec, operator, left))
+	p.write(" " + operator + " ")
+	p.operand(right, wrapsRight(prec, operator, right))
+}
+
+func (p *printer) list(open token.Token, closing string, end token.Position, expressions []ast.Expression) {
+	span := func(i int) (token.Position, token.Position) { return expressions[i].Pos(), expressions[i].End() }
+	p.items(open, closing, end, len(expressions), span, func(i int) { p.expression(expressions[i]) })
+}
+
+// prints n comma separated items between open and closing, which ends at
+// end. Items are kept on one line unless comments are written between them,
+// then each item gets its own line so every comment stays where it was
+func (p *printer) items(open token.Token, closing string, end token.Position, n int, span func(int) (token.Position, token.Position), item func(int)) {
+	p.write(open.Literal)
+	if !p.commentWithin(open.Offset, end.Offset) {
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				p.write(", ")
+			}
+			item(i)
+		}
+		p.write(closing)
+		return
+	}
+
+	next := func(i int) int {
+		if i < n {
+			start, _ := span(i)
+			return start.Offset
+		}
+		return end.Offset
+	}
+	p.trailingComment(open.Line, next(0))
+	p.newline()
+
+	p.indent++
+	p.blockStart = true
+	p.lastLine = open.Line
+	for i := 0; i < n; i++ {
+		start, stop := span(i)
+		p.commentsBefore(start.Offset)
+		p.separate(start.Line)
+		item(i)
+		if i+1 < n {
+			p.write(",")
+		}
+		p.trailingComment(stop.Line, next(i+1))
+		p.newline()
+		p.lastLine = stop.Line
+	}
+	p.commentsBefore(end.Offset)
+	p.indent--
+
+	p.write(closing)
+	p.blockStart = false
+}
+
+// reports whether a comment not printed yet lies between the offsets
+func (p *printer) commentWithin(from, to int) bool {
+	for i := p.next; i < len(p.comments) && p.comments[i].Token.Offset < to; i++ {
+		if p.comments[i].Token.Offset > from {
+			return true
+		}
+	}
+	return false
+}
+
+// the string as written when the source is known, so escapes are kept
+func (p *printer) stringLiteral(e *ast.StringLiteral) string {
+	tok := e.Token
+	if p.source != "" && tok.EndOffset <= len(p.source) && tok.Offset < tok.EndOffset {
+		return p.source[tok.Offset:tok.EndOffset]
+	}
+	return quote(e.Value)
+}
+
+// number literals keep their spelling, 1.50 stays 1.50
+func literal(tok token.Token, fallback string) string {
+	if tok.Literal != "" {
+		return tok.Literal
+	}
+	return fallback
+}
+
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
+// quotes s with the escapes the lexer understands
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// binds tighter than any operator
+const atom = parser.INDEX + 1
+
+// how tightly e holds together, as the parser's precedence levels
+func precedence(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(token.TokenType(e.Operator))
+	case *ast.LogicalExpression:
+		return parser.Precedence(token.TokenType(e.Operator))
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.CallExpression:
+		return parser.CALL
+	case *ast.IndexExpression, *ast.SliceExpression:
+		return parser.INDEX
+	}
+	return atom
+}
+
+// operators are left associative apart from **
+func wrapsLeft(prec int, operator string, left ast.Expression) bool {
+	return precedence(left) < prec || precedence(left) == prec && operator == "**"
+}
+
+func wrapsRight(prec int, operator string, right ast.Expression) bool {
+	return precedence(right) < prec || precedence(right) == prec && operator != "**"
+}
+
+// first character printed for e, 0 for anything but ( and {
+func leading(e ast.Expression) byte {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		if wrapsLeft(precedence(e), e.Operator, e.Left) {
+			return '('
+		}
+		return leading(e.Left)
+	case *ast.LogicalExpression:
+		if wrapsLeft(precedence(e), e.Operator, e.Left) {
+			return '('
+		}
+		return leading(e.Left)
+	case *ast.CallExpression:
+		if precedence(e.Function) < parser.CALL {
+			return '('
+		}
+		return leading(e.Function)
+	case *ast.IndexExpression:
+		if precedence(e.Left) < parser.CALL {
+			return '('
+		}
+		return leading(e.Left)
+	case *ast.SliceExpression:
+		if precedence(e.Left) < parser.CALL {
+			return '('
+		}
+		return leading(e.Left)
+	case *ast.HashLiteral:
+		return '{'
+	}
+	return 0
+}
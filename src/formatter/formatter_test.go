@@ -0,0 +1,190 @@
+package formatter
+
+import (
+	"bytes"
+	"errors"
+	"lexicon/src/evaluator"
+	"lexicon/src/lexer"
+	"lexicon/src/parser"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"sprout x=1;x=x+1", "sprout x = 1;\nx = x + 1;\n"},
+		{"const  k int =  2 ;", "const k int = 2;\n"},
+		{"echo 1.50;", "echo 1.50;\n"},
+		{`echo "a\t\"b\"";`, "echo \"a\\t\\\"b\\\"\";\n"},
+		{"echo (a + b) * c;", "echo (a + b) * c;\n"},
+		{"echo a * (b + c);", "echo a * (b + c);\n"},
+		{"echo a - (b - c);", "echo a - (b - c);\n"},
+		{"echo (a * b) + c;", "echo a * b + c;\n"},
+		{"echo (2 ** 3) ** 2;", "echo (2 ** 3) ** 2;\n"},
+		{"echo 2 ** (3 ** 2);", "echo 2 ** 3 ** 2;\n"},
+		{"echo -(a + b);", "echo -(a + b);\n"},
+		{"echo not a and b or c;", "echo !a && b || c;\n"},
+		{"echo (f)(1)[0:];", "echo f(1)[0:];\n"},
+		{"echo a + ((b - c) * d);", "echo a + (b - c) * d;\n"},
+		{"echo 1 + (a)[0] - -(f)(1);", "echo 1 + a[0] - -f(1);\n"},
+		{"echo - -a; echo -(-a); echo !!a;", "echo - -a;\necho - -a;\necho ! !a;\n"},
+		{"({\"k\": 1} == {});", "({\"k\": 1} == {});\n"},
+		{"sprout f = func(a, b) { a + b };", "sprout f = fn(a, b) {\n    a + b;\n};\n"},
+		{"if (x) { } else { echo 1 }", "if (x) {} else {\n    echo 1;\n}\n"},
+		{"for (;;) { break }", "for (;;) {\n    break;\n}\n"},
+		{"for (sprout i = 0; i < 3; i = i + 1) { continue; }", "for (sprout i = 0; i < 3; i = i + 1) {\n    continue;\n}\n"},
+		{"m[\"k\"]=[1,2];delete m[\"k\"];", "m[\"k\"] = [1, 2];\ndelete m[\"k\"];\n"},
+		{"while (true) { return; }", "while (true) {\n    return;\n}\n"},
+	}
+
+	for _, tt := range tests {
+		got, err := Format(tt.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.input, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("%q: expected\n%s\ngot\n%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `# header
+
+
+sprout a = 1; sprout b = 2;   # about b
+if (a < b) {   # compare
+
+
+    echo a;
+    # closing
+}
+# footer`
+
+	expected := `# header
+
+sprout a = 1;
+sprout b = 2;  # about b
+if (a < b) {  # compare
+    echo a;
+    # closing
+}
+# footer
+`
+
+	got, err := Format(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+}
+
+// comments between the items of a literal or call stay with their items
+func TestCommentsInsideLists(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"sprout a = [1, # one\n 2];", "sprout a = [\n    1,  # one\n    2\n];\n"},
+		{"sprout h = {\n# first\n\"a\": 1, \"b\": 2 # two\n};", "sprout h = {\n    # first\n    \"a\": 1,\n    \"b\": 2  # two\n};\n"},
+		{"echo f(1, [2, # two\n3]);", "echo f(\n    1,\n    [\n        2,  # two\n        3\n    ]\n);\n"},
+		{"sprout a = [1, 2]; # after\necho a;", "sprout a = [1, 2];  # after\necho a;\n"},
+	}
+
+	for _, tt := range tests {
+		once, err := Format(tt.input)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tt.input, err)
+		}
+		if once != tt.expected {
+			t.Errorf("%q: expected\n%s\ngot\n%s", tt.input, tt.expected, once)
+		}
+		if twice, _ := Format(once); twice != once {
+			t.Errorf("%q: formatting again changed\n%s\ninto\n%s", tt.input, once, twice)
+		}
+	}
+}
+
+func TestFormatIsIdempotent(t *testing.T) {
+	inputs := []string{
+		"sprout h = {\n\"a\": 1, # first\n\"b\": 2};\necho h;",
+		"sprout f = fn(n) {\n  if (n < 2) { return n; }\n\n\n  return f(n - 1) + f(n - 2);\n};\necho f(10);",
+		"echo a + (b - c) * 2;",
+	}
+
+	for _, input := range inputs {
+		once, err := Format(input)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", input, err)
+		}
+		twice, err := Format(once)
+		if err != nil {
+			t.Fatalf("%q: formatted source does not parse: %v", once, err)
+		}
+		if once != twice {
+			t.Errorf("%q: formatting again changed\n%s\ninto\n%s", input, once, twice)
+		}
+	}
+}
+
+// formatted programs print the same and give the same result
+func TestFormattedProgramsRunUnchanged(t *testing.T) {
+	tests := []string{
+		"sprout a = 2; sprout b = 3; echo a + (b - 1) * 2; echo (a - b) * 2 ** 2;",
+		"echo -2 ** 2; echo 2 ** 3 ** 2; echo 10 - (4 - 1);",
+		"sprout f = fn(x) { x * 2 }; echo f(21);",
+		"sprout s = \"tab\\there\"; echo s + \"\\n\" + \"q\\\"\";",
+		"sprout total = 0; for (sprout i = 0; i < 5; i = i + 1) { if (i == 3) { continue; } total = total + i; } echo total;",
+		"sprout m = {\"k\": [1, 2, 3]}; m[\"j\"] = m[\"k\"][1:]; echo m;",
+		"echo not true or (1 < 2 and 2 > 3);",
+	}
+
+	for _, input := range tests {
+		formatted, err := Format(input)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", input, err)
+		}
+		wantOut, want := run(t, input)
+		gotOut, got := run(t, formatted)
+		if want != got || wantOut != gotOut {
+			t.Errorf("%q formatted as %q: expected %q (%s), got %q (%s)", input, formatted, wantOut, want, gotOut, got)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	_, err := Format("sprout = 1;\necho 2;")
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("expected *ParseError, got=%T (%v)", err, err)
+	}
+	if len(parseErr.Diagnostics) != 1 || parseErr.Diagnostics[0].Code != parser.EXPECTED_TOKEN {
+		t.Errorf("wrong diagnostics: %+v", parseErr.Diagnostics)
+	}
+}
+
+func TestPrintWithoutSource(t *testing.T) {
+	p := parser.New(lexer.New("echo \"a\\nb\"; # note"))
+	program := p.ParseProgram()
+	if got := Print(program); got != "echo \"a\\nb\";  # note\n" {
+		t.Errorf("wrong output, got=%q", got)
+	}
+}
+
+func run(t *testing.T, input string) (string, string) {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	var out bytes.Buffer
+	env := evaluator.NewEnvironment()
+	env.SetExecContext(evaluator.NewExecContext(&out, &out))
+	return out.String(), evaluator.Eval(program, env).Inspect()
+}
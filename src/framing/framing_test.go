@@ -0,0 +1,43 @@
+package framing
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	for _, msg := range []interface{}{map[string]int{"seq": 1}, "é", nil} {
+		if err := Write(&buf, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := bufio.NewReader(&buf)
+	for _, expected := range []string{`{"seq":1}`, `"é"`, `null`} {
+		body, err := Read(r)
+		if err != nil || string(body) != expected {
+			t.Errorf("expected %s, got %s (%v)", expected, body, err)
+		}
+	}
+	if _, err := Read(r); !errors.Is(err, io.EOF) {
+		t.Errorf("expected EOF after the last message, got %v", err)
+	}
+}
+
+func TestInvalidHeaders(t *testing.T) {
+	for _, input := range []string{
+		"Content-Length: x\r\n\r\n{}",
+		"Content-Length: -1\r\n\r\n",
+		"Content-Type: application/json\r\n\r\n{}",
+		"Content-Length: 10\r\n\r\n{}",
+	} {
+		if _, err := Read(bufio.NewReader(strings.NewReader(input))); err == nil {
+			t.Errorf("%q: expected an error", input)
+		}
+	}
+}
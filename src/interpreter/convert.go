@@ -0,0 +1,110 @@
+package interpreter
+
+import (
+	"fmt"
+	"lexicon/src/evaluator"
+	"reflect"
+)
+
+// ToObject converts a Go value into a Sprout object.
+//
+//	nil                       -> null
+//	bool                      -> bool
+//	signed/unsigned integers  -> int
+//	float32, float64          -> float
+//	string                    -> string
+//	slices and arrays         -> array
+//	maps with int/string/bool keys -> hash
+//	evaluator.Object          -> itself
+func ToObject(value interface{}) (evaluator.Object, error) {
+	if value == nil {
+		return evaluator.NULL, nil
+	}
+	if obj, ok := value.(evaluator.Object); ok {
+		return obj, nil
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return evaluator.TRUE, nil
+		}
+		return evaluator.FALSE, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &evaluator.Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &evaluator.Integer{Value: int64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &evaluator.Float{Value: v.Float()}, nil
+	case reflect.String:
+		return &evaluator.String{Value: v.String()}, nil
+	case reflect.Slice, reflect.Array:
+		elements := make([]evaluator.Object, v.Len())
+		for i := range elements {
+			el, err := ToObject(v.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = el
+		}
+		return &evaluator.Array{Elements: elements}, nil
+	case reflect.Map:
+		hash := evaluator.NewHash()
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := ToObject(iter.Key().Interface())
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := key.(evaluator.Hashable); !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+			val, err := ToObject(iter.Value().Interface())
+			if err != nil {
+				return nil, err
+			}
+			hash.Set(key, val)
+		}
+		return hash, nil
+	}
+
+	return nil, fmt.Errorf("cannot convert %T to a Sprout value", value)
+}
+
+// FromObject converts a Sprout object into a Go value.
+//
+//	int -> int64, float -> float64, string -> string, bool -> bool, null -> nil
+//	array -> []interface{}
+//	hash  -> map[interface{}]interface{} keyed by int64, string or bool
+//
+// objects without a Go equivalent, such as functions, are returned unchanged
+func FromObject(obj evaluator.Object) interface{} {
+	switch obj := obj.(type) {
+	case nil, *evaluator.Null:
+		return nil
+	case *evaluator.Integer:
+		return obj.Value
+	case *evaluator.Float:
+		return obj.Value
+	case *evaluator.String:
+		return obj.Value
+	case *evaluator.Boolean:
+		return obj.Value
+	case *evaluator.Array:
+		values := make([]interface{}, len(obj.Elements))
+		for i, el := range obj.Elements {
+			values[i] = FromObject(el)
+		}
+		return values
+	case *evaluator.Hash:
+		values := make(map[interface{}]interface{}, len(obj.Pairs))
+		for _, key := range obj.Order {
+			pair := obj.Pairs[key]
+			values[FromObject(pair.Key)] = FromObject(pair.Value)
+		}
+		return values
+	default:
+		return obj
+	}
+}
@@ -0,0 +1,150 @@
+package interpreter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"lexicon/src/diagnostic"
+	"lexicon/src/evaluator"
+	"lexicon/src/lexer"
+	"lexicon/src/optimizer"
+	"lexicon/src/parser"
+	"lexicon/src/resolver"
+	"os"
+	"strings"
+)
+
+// Interpreter runs Sprout source for a Go host. Globals persist between runs,
+// so a host can set inputs, run a script and read results back.
+type Interpreter struct {
+	env      *evaluator.Environment
+	builtins *evaluator.Registry
+}
+
+// New creates an interpreter with an empty global environment and its own
+// builtin registry
+func New() *Interpreter {
+	env := evaluator.NewEnvironment()
+	builtins := evaluator.NewRegistry()
+	env.SetBuiltins(builtins)
+	env.SetExecContext(evaluator.NewExecContext(os.Stdout, os.Stderr))
+	return &Interpreter{env: env, builtins: builtins}
+}
+
+// ParseError is returned when the source does not parse
+type ParseError struct {
+	Errors      []string
+	Diagnostics []diagnostic.Diagnostic // the same errors with codes and spans
+}
+
+func (e *ParseError) Error() string {
+	return "parse error: " + strings.Join(e.Errors, "; ")
+}
+
+// RuntimeError is returned when evaluation fails
+type RuntimeError struct {
+	Message string
+	Line    int
+	Column  int
+	Code    evaluator.ErrorCode // set when a limit or cancellation stopped the run
+}
+
+func (e *RuntimeError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("runtime error [Line %d:%d]: %s", e.Line, e.Column, e.Message)
+	}
+	return "runtime error: " + e.Message
+}
+
+// Diagnostic returns the error in the form the command line tools render
+func (e *RuntimeError) Diagnostic() diagnostic.Diagnostic {
+	err := &evaluator.Error{Message: e.Message, Line: e.Line, Column: e.Column, Code: e.Code}
+	return err.Diagnostic()
+}
+
+// Run parses and evaluates src, returning the value of the last statement
+// converted to a Go value (see FromObject)
+func (i *Interpreter) Run(src string) (interface{}, error) {
+	return i.RunContext(context.Background(), src)
+}
+
+// RunContext is Run with cancellation, evaluation stops once ctx is done
+func (i *Interpreter) RunContext(ctx context.Context, src string) (interface{}, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, &ParseError{Errors: p.Errors(), Diagnostics: p.Diagnostics()}
+	}
+	globals := i.env.Names()
+	optimizer.Optimize(program, globals)
+	// globals from earlier runs are unused as far as one snippet can tell, so
+	// only the slots are kept
+	resolver.Resolve(program, globals)
+
+	result := evaluator.EvalContext(ctx, program, i.env)
+	if errObj, ok := result.(*evaluator.Error); ok {
+		return nil, &RuntimeError{
+			Message: errObj.Message,
+			Line:    errObj.Line,
+			Column:  errObj.Column,
+			Code:    errObj.Code,
+		}
+	}
+	return FromObject(result), nil
+}
+
+// RunFile reads and runs a Sprout source file
+func (i *Interpreter) RunFile(path string) (interface{}, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return i.Run(string(src))
+}
+
+// SetGlobal declares or replaces a global variable, converting value with ToObject
+func (i *Interpreter) SetGlobal(name string, value interface{}) error {
+	obj, err := ToObject(value)
+	if err != nil {
+		return fmt.Errorf("global %s: %w", name, err)
+	}
+	i.env.Declare(name, obj, "", false)
+	return nil
+}
+
+// GetGlobal returns a global variable converted with FromObject
+func (i *Interpreter) GetGlobal(name string) (interface{}, bool) {
+	obj, ok := i.env.Get(name)
+	if !ok {
+		return nil, false
+	}
+	return FromObject(obj), true
+}
+
+// Register exposes a Go function to scripts under name. Builtins are private
+// to this interpreter and are shadowed by script variables of the same name.
+func (i *Interpreter) Register(name string, fn evaluator.BuiltinFunction) {
+	i.builtins.Register(name, fn)
+}
+
+// SetOutput redirects echo output to out and diagnostics to errOut
+func (i *Interpreter) SetOutput(out, errOut io.Writer) {
+	exec := i.env.ExecContext()
+	exec.Out = out
+	exec.Err = errOut
+}
+
+// SetLimits caps the steps, call depth and allocations of each run
+func (i *Interpreter) SetLimits(limits evaluator.Limits) {
+	i.env.ExecContext().Limits = limits
+}
+
+// Builtins returns the interpreter's builtin registry
+func (i *Interpreter) Builtins() *evaluator.Registry {
+	return i.builtins
+}
+
+// Environment exposes the global environment for hosts that work with objects directly
+func (i *Interpreter) Environment() *evaluator.Environment {
+	return i.env
+}
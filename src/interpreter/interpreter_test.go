@@ -0,0 +1,214 @@
+package interpreter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"lexicon/src/evaluator"
+	"lexicon/src/parser"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"5 + 5", int64(10)},
+		{"2.5 * 2", 5.0},
+		{`"a" + "b"`, "ab"},
+		{"1 < 2", true},
+		{"if (false) { 1 }", nil},
+		{"[1, \"two\", [3.0]]", []interface{}{int64(1), "two", []interface{}{3.0}}},
+		{`sprout m = {"k": 1, 2: false}; m;`, map[interface{}]interface{}{"k": int64(1), int64(2): false}},
+	}
+
+	for _, tt := range tests {
+		result, err := New().Run(tt.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("%q: expected=%#v, got=%#v", tt.input, tt.expected, result)
+		}
+	}
+}
+
+func TestGlobalsPersistBetweenRuns(t *testing.T) {
+	interp := New()
+
+	if _, err := interp.Run("sprout total = 1;"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := interp.Run("total = total + 41;"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	total, ok := interp.GetGlobal("total")
+	if !ok || total != int64(42) {
+		t.Errorf("expected total=42, got=%v (found=%t)", total, ok)
+	}
+
+	if _, ok := interp.GetGlobal("missing"); ok {
+		t.Errorf("expected missing global to be absent")
+	}
+}
+
+func TestSetGlobal(t *testing.T) {
+	interp := New()
+
+	globals := map[string]interface{}{
+		"count":  3,
+		"rate":   float32(0.5),
+		"name":   "sprout",
+		"flag":   true,
+		"nums":   []int{1, 2, 3},
+		"config": map[string]interface{}{"region": "eu", "retries": uint8(2)},
+		"none":   nil,
+	}
+	for name, value := range globals {
+		if err := interp.SetGlobal(name, value); err != nil {
+			t.Fatalf("SetGlobal(%s): %v", name, err)
+		}
+	}
+
+	result, err := interp.Run(`
+	sprout summary = name + ":" + nums[-1] + ":" + config["region"];
+	if (flag && count * rate == 1.5 && config["retries"] == 2 && none == none) { summary; }
+	`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != "sprout:3:eu" {
+		t.Errorf("wrong result, got=%#v", result)
+	}
+
+	if err := interp.SetGlobal("bad", struct{}{}); err == nil {
+		t.Errorf("expected error converting a struct")
+	}
+	if err := interp.SetGlobal("bad", map[float64]int{1.5: 1}); err == nil {
+		t.Errorf("expected error converting a float keyed map")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	_, err := New().Run("sprout = 5;")
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || len(parseErr.Errors) == 0 {
+		t.Fatalf("expected *ParseError, got=%T (%v)", err, err)
+	}
+	if len(parseErr.Diagnostics) != 1 || parseErr.Diagnostics[0].Code != parser.EXPECTED_TOKEN {
+		t.Errorf("wrong parse diagnostics: %+v", parseErr.Diagnostics)
+	}
+
+	_, err = New().Run("sprout x = 1;\nx + true;")
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected *RuntimeError, got=%T (%v)", err, err)
+	}
+	if runtimeErr.Message != "type mismatch: INTEGER + BOOLEAN" || runtimeErr.Line != 2 {
+		t.Errorf("wrong runtime error: %+v", runtimeErr)
+	}
+	if runtimeErr.Error() != "runtime error [Line 2:3]: type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong error text: %s", runtimeErr.Error())
+	}
+	if d := runtimeErr.Diagnostic(); d.String() != "[Line 2:3] type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong diagnostic: %s", d.String())
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.spr")
+	if err := os.WriteFile(path, []byte("sprout double = fn(x) { x * 2 };\ndouble(21);"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	interp := New()
+	result, err := interp.RunFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != int64(42) {
+		t.Errorf("expected 42, got=%#v", result)
+	}
+
+	// functions have no Go equivalent and come back as objects
+	double, _ := interp.GetGlobal("double")
+	if _, ok := double.(*evaluator.Function); !ok {
+		t.Errorf("expected *evaluator.Function, got=%T", double)
+	}
+
+	if _, err := interp.RunFile(filepath.Join(t.TempDir(), "missing.spr")); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+}
+
+func TestRegisterIsPerInterpreter(t *testing.T) {
+	metrics := []string{}
+	first := New()
+	first.Register("emit", func(args ...evaluator.Object) evaluator.Object {
+		for _, arg := range args {
+			metrics = append(metrics, arg.Inspect())
+		}
+		return evaluator.NULL
+	})
+
+	if _, err := first.Run(`emit("requests", 3);`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(metrics, []string{"requests", "3"}) {
+		t.Errorf("wrong metrics, got=%v", metrics)
+	}
+
+	_, err := New().Run(`emit("requests", 3);`)
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) || runtimeErr.Message != "identifier not found: emit" {
+		t.Errorf("expected emit to be unknown in a second interpreter, got=%v", err)
+	}
+}
+
+func TestSetOutput(t *testing.T) {
+	var first, second bytes.Buffer
+	a, b := New(), New()
+	a.SetOutput(&first, &first)
+	b.SetOutput(&second, &second)
+
+	if _, err := a.Run(`echo "from a";`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := b.Run(`echo "from b";`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if first.String() != "from a\n" || second.String() != "from b\n" {
+		t.Errorf("output leaked between interpreters: a=%q b=%q", first.String(), second.String())
+	}
+}
+
+func TestRunawayScriptIsStopped(t *testing.T) {
+	interp := New()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := interp.RunContext(ctx, "sprout i = 0; while (true) { i = i + 1; }")
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) || runtimeErr.Code != evaluator.CANCELLED {
+		t.Fatalf("expected cancelled runtime error, got=%v", err)
+	}
+
+	interp.SetLimits(evaluator.Limits{MaxSteps: 500})
+	_, err = interp.Run("while (true) { }")
+	if !errors.As(err, &runtimeErr) || runtimeErr.Code != evaluator.STEP_LIMIT_EXCEEDED {
+		t.Fatalf("expected step limit error, got=%v", err)
+	}
+
+	// the interpreter stays usable after a limit stops a run
+	if result, err := interp.Run("1 + 2"); err != nil || result != int64(3) {
+		t.Errorf("expected 3, got=%v (%v)", result, err)
+	}
+}
@@ -13,6 +13,12 @@ type Lexer struct {
 	ch      rune
 	line    int // current line number
 	column  int // current column number
+
+	// position of the character read before ch, the last one of a token once
+	// the lexer has moved past it
+	prevLine   int
+	prevColumn int
+	prevPos    int
 }
 
 func New(input string) *Lexer {
@@ -26,20 +32,22 @@ func New(input string) *Lexer {
 
 // Reads next character
 func (l *Lexer) readChar() {
-	if l.nextPos >= len(l.input) {
-		l.ch = 0 // EOF
-	} else {
-		l.ch = rune(l.input[l.nextPos])
-	}
+	l.prevLine, l.prevColumn, l.prevPos = l.line, l.column, l.currPos
 
-	// Update line and column tracking
+	// a newline ends its own line, the character after it starts the next
 	if l.ch == '\n' {
 		l.line++
-		l.column = 0
+		l.column = 1
 	} else {
 		l.column++
 	}
 
+	if l.nextPos >= len(l.input) {
+		l.ch = 0 // EOF
+	} else {
+		l.ch = rune(l.input[l.nextPos])
+	}
+
 	l.currPos = l.nextPos
 	l.nextPos++
 }
@@ -83,6 +91,37 @@ func (l *Lexer) readComment() string {
 	return l.input[start:l.currPos]
 }
 
+// Directive splits a comment such as "# lint:ignore rule other" into its
+// directive, "lint:ignore", and the arguments after it, separated by spaces or
+// commas. ok is false for an ordinary comment, a directive is two lowercase
+// words joined by a colon
+func Directive(comment string) (directive string, args []string, ok bool) {
+	fields := strings.FieldsFunc(strings.TrimPrefix(comment, "#"), func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	if len(fields) == 0 {
+		return "", nil, false
+	}
+
+	tool, name, found := strings.Cut(fields[0], ":")
+	if !found || !isLowerWord(tool) || !isLowerWord(name) {
+		return "", nil, false
+	}
+	return fields[0], fields[1:], true
+}
+
+func isLowerWord(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < 'a' || r > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
 // for multi character tokens like !=, ==
 func (l *Lexer) peekChar() rune {
 	if l.nextPos >= len(l.input) {
@@ -93,23 +132,31 @@ func (l *Lexer) peekChar() rune {
 
 // creates token.Token to reduce code duplication
 func (l *Lexer) newToken(tokenType token.TokenType, ch string) token.Token {
-	return token.Token{
-		Type:    tokenType,
-		Literal: ch,
-		Line:    l.line,
-		Column:  l.column,
-	}
+	return token.Token{Type: tokenType, Literal: ch}
 }
 
 func (l *Lexer) NextToken() token.Token {
+	l.skipWhitespace()
+	line, column, offset := l.line, l.column, l.currPos
 
+	tok := l.readToken()
+	tok.Line, tok.Column, tok.Offset = line, column, offset
+	if tok.Type == token.EOF {
+		tok.EndLine, tok.EndColumn, tok.EndOffset = line, column, offset
+	} else {
+		tok.EndLine, tok.EndColumn, tok.EndOffset = l.prevLine, l.prevColumn+1, l.prevPos+1
+	}
+	return tok
+}
+
+// scans the token starting at the current character, NextToken fills in its span
+func (l *Lexer) readToken() token.Token {
 	var tok token.Token
-	l.skipWhitespace()
 
 	switch l.ch {
 	case '#':
-		comment := l.readComment()
-		tok = token.Token{Type: token.COMMENT, Literal: comment}
+		// the newline is left for the next token
+		return l.newToken(token.COMMENT, l.readComment())
 	case '=':
 		if l.peekChar() == '=' {
 			ch := l.ch
@@ -182,6 +229,10 @@ func (l *Lexer) NextToken() token.Token {
 		tok = l.newToken(token.LBRACE, "{")
 	case '}':
 		tok = l.newToken(token.RBRACE, "}")
+	case '[':
+		tok = l.newToken(token.LBRACKET, "[")
+	case ']':
+		tok = l.newToken(token.RBRACKET, "]")
 	case ',':
 		tok = l.newToken(token.COMMA, ",")
 	case ';':
@@ -193,16 +244,11 @@ func (l *Lexer) NextToken() token.Token {
 	case '"':
 		return l.readString()
 	case 0:
-		tok.Literal = ""
-		tok.Type = token.EOF
+		tok = l.newToken(token.EOF, "")
 	default:
 		if unicode.IsLetter(rune(l.ch)) {
-			tokLine := l.line
-			tokCol := l.column
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal) // Efficient keyword check
-			tok.Line = tokLine
-			tok.Column = tokCol
 
 			// Handle boolean literals
 			if tok.Literal == "true" {
@@ -213,11 +259,7 @@ func (l *Lexer) NextToken() token.Token {
 
 			return tok
 		} else if unicode.IsDigit(rune(l.ch)) {
-			tokLine := l.line
-			tokCol := l.column
 			tok.Literal = l.readNumber()
-			tok.Line = tokLine
-			tok.Column = tokCol
 			// check if it's a float (contains a decimal point)
 			if strings.Contains(tok.Literal, ".") {
 				tok.Type = token.FLOAT
@@ -235,8 +277,6 @@ func (l *Lexer) NextToken() token.Token {
 }
 
 func (l *Lexer) readString() token.Token {
-	tokLine := l.line
-	tokCol := l.column
 	l.readChar()
 
 	var value strings.Builder
@@ -276,8 +316,6 @@ func (l *Lexer) readString() token.Token {
 		return token.Token{
 			Type:    token.ILLEGAL,
 			Literal: "Unterminated string",
-			Line:    tokLine,
-			Column:  tokCol,
 		}
 	}
 
@@ -285,7 +323,5 @@ func (l *Lexer) readString() token.Token {
 	return token.Token{
 		Type:    token.STRING,
 		Literal: value.String(),
-		Line:    tokLine,
-		Column:  tokCol,
 	}
 }
@@ -77,3 +77,118 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestFunctionTokens(t *testing.T) {
+	input := `sprout add = fn(a, b) { return a + b; };
+	func() {};`
+
+	expectedTokens := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.SPROUT, "sprout"},
+		{token.IDENT, "add"},
+		{token.ASSIGN, "="},
+		{token.FUNCTION, "fn"},
+		{token.LPAREN, "("},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.IDENT, "b"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.RETURN, "return"},
+		{token.IDENT, "a"},
+		{token.PLUS, "+"},
+		{token.IDENT, "b"},
+		{token.SEMICOLON, ";"},
+		{token.RBRACE, "}"},
+		{token.SEMICOLON, ";"},
+		{token.FUNCTION, "func"},
+		{token.LPAREN, "("},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	lexer := New(input)
+
+	for i, expected := range expectedTokens {
+		tok := lexer.NextToken()
+
+		if tok.Type != expected.expectedType {
+			t.Fatalf("tests[%d] - token type wrong. expected=%q, got=%q",
+				i, expected.expectedType, tok.Type)
+		}
+
+		if tok.Literal != expected.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, expected.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestTokenSpans(t *testing.T) {
+	input := "x == 10; # note\n\"hi\\n\" ** 2.5\n"
+
+	tests := []struct {
+		expectedType token.TokenType
+		start        token.Position
+		end          token.Position
+	}{
+		{token.IDENT, token.Position{Offset: 0, Line: 1, Column: 1}, token.Position{Offset: 1, Line: 1, Column: 2}},
+		{token.EQ, token.Position{Offset: 2, Line: 1, Column: 3}, token.Position{Offset: 4, Line: 1, Column: 5}},
+		{token.INT, token.Position{Offset: 5, Line: 1, Column: 6}, token.Position{Offset: 7, Line: 1, Column: 8}},
+		{token.SEMICOLON, token.Position{Offset: 7, Line: 1, Column: 8}, token.Position{Offset: 8, Line: 1, Column: 9}},
+		{token.COMMENT, token.Position{Offset: 9, Line: 1, Column: 10}, token.Position{Offset: 15, Line: 1, Column: 16}},
+		{token.STRING, token.Position{Offset: 16, Line: 2, Column: 1}, token.Position{Offset: 22, Line: 2, Column: 7}},
+		{token.EXP, token.Position{Offset: 23, Line: 2, Column: 8}, token.Position{Offset: 25, Line: 2, Column: 10}},
+		{token.FLOAT, token.Position{Offset: 26, Line: 2, Column: 11}, token.Position{Offset: 29, Line: 2, Column: 14}},
+		{token.EOF, token.Position{Offset: 30, Line: 3, Column: 1}, token.Position{Offset: 30, Line: 3, Column: 1}},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - token type wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Pos() != tt.start || tok.End() != tt.end {
+			t.Errorf("tests[%d] %s - wrong span. expected=%+v-%+v, got=%+v-%+v", i, tok.Type, tt.start, tt.end, tok.Pos(), tok.End())
+		}
+		if tok.Type != token.EOF && input[tok.Offset:tok.EndOffset] == "" {
+			t.Errorf("tests[%d] %s - empty source text", i, tok.Type)
+		}
+	}
+}
+
+func TestDirective(t *testing.T) {
+	tests := []struct {
+		comment   string
+		directive string
+		args      []string
+		ok        bool
+	}{
+		{"# lint:ignore unused_assignment", "lint:ignore", []string{"unused_assignment"}, true},
+		{"#lint:ignore a, b\tc", "lint:ignore", []string{"a", "b", "c"}, true},
+		{"# lint:ignore", "lint:ignore", []string{}, true},
+		{"# TODO: fix this", "", nil, false},
+		{"# see http://example.com", "", nil, false},
+		{"# just words", "", nil, false},
+		{"#", "", nil, false},
+	}
+
+	for _, tt := range tests {
+		directive, args, ok := Directive(tt.comment)
+		if directive != tt.directive || ok != tt.ok || len(args) != len(tt.args) {
+			t.Errorf("%q: expected (%q, %q, %t), got=(%q, %q, %t)", tt.comment, tt.directive, tt.args, tt.ok, directive, args, ok)
+			continue
+		}
+		for i := range args {
+			if args[i] != tt.args[i] {
+				t.Errorf("%q: expected args %q, got=%q", tt.comment, tt.args, args)
+			}
+		}
+	}
+}
@@ -0,0 +1,451 @@
+package lint
+
+import (
+	"fmt"
+	"lexicon/src/ast"
+	"lexicon/src/diagnostic"
+	"lexicon/src/evaluator"
+	"lexicon/src/lexer"
+	"lexicon/src/token"
+	"lexicon/src/typecheck"
+	"sort"
+	"strings"
+)
+
+// codes of the rules the linter checks, also the names a
+// "# lint:ignore rule" comment takes
+const (
+	UNUSED_ASSIGNMENT       = "UNUSED_ASSIGNMENT"
+	REDECLARED_VARIABLE     = "REDECLARED_VARIABLE"
+	CONSTANT_CONDITION      = "CONSTANT_CONDITION"
+	INCOMPATIBLE_COMPARISON = "INCOMPATIBLE_COMPARISON"
+	UNREACHABLE_ELSE        = "UNREACHABLE_ELSE"
+	SHADOWED_VARIABLE       = "SHADOWED_VARIABLE"
+)
+
+// the directive that suppresses findings on its own line and the next one
+const ignoreDirective = "lint:ignore"
+
+// variable declared in a scope
+type variable struct {
+	name     string
+	tok      token.Token // first declaration
+	declared bool        // the walk has reached its declaration
+	read     bool
+	param    bool
+}
+
+type scope struct {
+	vars  map[string]*variable
+	order []*variable
+}
+
+// Linter walks a program and reports code that runs but is likely a mistake.
+// It mirrors the scopes the evaluator creates, as the resolver does: the
+// program, every block, every function call and the init clause of a for
+// loop.
+type Linter struct {
+	scopes   []*scope
+	types    *typecheck.Checker
+	findings []diagnostic.Diagnostic
+}
+
+func New() *Linter {
+	return &Linter{}
+}
+
+// lints a program and returns its findings
+func Lint(program *ast.Program) []diagnostic.Diagnostic {
+	return New().Lint(program)
+}
+
+// returns the findings for program sorted by position, leaving out those a
+// "# lint:ignore rule" comment suppresses
+func (l *Linter) Lint(program *ast.Program) []diagnostic.Diagnostic {
+	l.types = typecheck.New()
+	l.types.Check(program)
+	l.findings = nil
+
+	s := l.openScope()
+	l.predeclare(s, program.Statements)
+	l.statements(program.Statements)
+	l.closeScope()
+
+	findings := suppress(l.findings, program.Comments)
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i].Span.Start, findings[j].Span.Start
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return findings
+}
+
+func (l *Linter) statements(statements []ast.Statement) {
+	for _, stmt := range statements {
+		l.statement(stmt)
+	}
+}
+
+func (l *Linter) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.VariableDeclaration:
+		l.expression(stmt.Value)
+		if stmt.Name == nil {
+			return
+		}
+		if stmt.IsAssignment() {
+			l.lookup(stmt.Name.Value)
+			return
+		}
+		l.declare(stmt)
+
+	case *ast.PrintStatement:
+		l.expression(stmt.Value)
+
+	case *ast.ExpressionStatement:
+		l.expression(stmt.Expression)
+
+	case *ast.ReturnStatement:
+		l.expression(stmt.ReturnValue)
+
+	case *ast.IfExpression:
+		l.expression(stmt.Condition)
+		if truthy, ok := constant(stmt.Condition); ok {
+			l.report(CONSTANT_CONDITION, stmt.Condition, "if condition is always %t", truthy)
+			if truthy && stmt.Alternative != nil {
+				l.report(UNREACHABLE_ELSE, stmt.Alternative, "else branch never runs, the condition is always true")
+			}
+		}
+		l.block(stmt.Consequence)
+		l.block(stmt.Alternative)
+
+	case *ast.BlockStatement:
+		l.block(stmt)
+
+	case *ast.WhileStatement:
+		l.expression(stmt.Condition)
+		l.loopCondition("while", stmt.Condition)
+		l.block(stmt.Body)
+
+	case *ast.ForStatement:
+		s := l.openScope()
+		l.predeclare(s, []ast.Statement{stmt.Init, stmt.Post})
+		if stmt.Init != nil {
+			l.statement(stmt.Init)
+		}
+		if stmt.Condition != nil {
+			l.expression(stmt.Condition)
+			l.loopCondition("for", stmt.Condition)
+		}
+		l.block(stmt.Body)
+		if stmt.Post != nil {
+			l.statement(stmt.Post)
+		}
+		l.closeScope()
+
+	case *ast.IndexAssignment:
+		if stmt.Target != nil {
+			l.expression(stmt.Target)
+		}
+		l.expression(stmt.Value)
+
+	case *ast.DeleteStatement:
+		if stmt.Target != nil {
+			l.expression(stmt.Target)
+		}
+	}
+}
+
+// a literal true is how an endless loop is written, any other constant is not
+func (l *Linter) loopCondition(loop string, condition ast.Expression) {
+	if b, ok := condition.(*ast.BooleanLiteral); ok && b.Value {
+		return
+	}
+	if truthy, ok := constant(condition); ok {
+		l.report(CONSTANT_CONDITION, condition, "%s condition is always %t", loop, truthy)
+	}
+}
+
+func (l *Linter) block(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+	s := l.openScope()
+	l.predeclare(s, block.Statements)
+	l.statements(block.Statements)
+	l.closeScope()
+}
+
+func (l *Linter) expression(expr ast.Expression) {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		if v := l.lookup(expr.Value); v != nil {
+			v.read = true
+		}
+
+	case *ast.PrefixExpression:
+		l.expression(expr.Right)
+
+	case *ast.InfixExpression:
+		l.expression(expr.Left)
+		l.expression(expr.Right)
+		l.comparison(expr)
+
+	case *ast.LogicalExpression:
+		l.expression(expr.Left)
+		l.expression(expr.Right)
+
+	case *ast.FunctionLiteral:
+		l.function(expr)
+
+	case *ast.CallExpression:
+		l.expression(expr.Function)
+		for _, arg := range expr.Arguments {
+			l.expression(arg)
+		}
+
+	case *ast.ArrayLiteral:
+		for _, el := range expr.Elements {
+			l.expression(el)
+		}
+
+	case *ast.IndexExpression:
+		l.expression(expr.Left)
+		l.expression(expr.Index)
+
+	case *ast.SliceExpression:
+		l.expression(expr.Left)
+		l.expression(expr.Low)
+		l.expression(expr.High)
+
+	case *ast.HashLiteral:
+		for i, key := range expr.Keys {
+			l.expression(key)
+			l.expression(expr.Values[i])
+		}
+	}
+}
+
+// parameters and the body share one scope
+func (l *Linter) function(fn *ast.FunctionLiteral) {
+	s := l.openScope()
+	for _, param := range fn.Parameters {
+		v := l.declareIn(s, param.Value, param.Token)
+		v.declared = true
+		v.param = true
+	}
+	if fn.Body != nil {
+		l.predeclare(s, fn.Body.Statements)
+		l.statements(fn.Body.Statements)
+	}
+	l.closeScope()
+}
+
+// reports a comparison with a literal whose operands can never be alike
+func (l *Linter) comparison(expr *ast.InfixExpression) {
+	switch expr.Operator {
+	case "==", "!=", "<", ">", "<=", ">=":
+	default:
+		return
+	}
+	if !isLiteral(expr.Left) && !isLiteral(expr.Right) {
+		return
+	}
+
+	left, right := l.types.TypeOf(expr.Left), l.types.TypeOf(expr.Right)
+	if left == typecheck.UNKNOWN || right == typecheck.UNKNOWN || comparable(left, right) {
+		return
+	}
+	l.report(INCOMPATIBLE_COMPARISON, expr, "comparing %s with %s using %s", left, right, expr.Operator)
+}
+
+// reports a redeclaration in the same scope or one that hides a variable of
+// an enclosing scope
+func (l *Linter) declare(stmt *ast.VariableDeclaration) {
+	name := stmt.Name.Value
+	v := l.current().vars[name]
+
+	if v.declared {
+		l.findings = append(l.findings, diagnostic.New(diagnostic.Warning, REDECLARED_VARIABLE, stmt.Name.Token,
+			"%s is already declared in this scope at line %d:%d", name, v.tok.Line, v.tok.Column).
+			WithHint("assign with %s = ... to change the existing variable", name))
+		return
+	}
+	v.declared = true
+
+	for i := len(l.scopes) - 2; i >= 0; i-- {
+		if outer, ok := l.scopes[i].vars[name]; ok && outer.declared {
+			l.findings = append(l.findings, diagnostic.New(diagnostic.Warning, SHADOWED_VARIABLE, stmt.Name.Token,
+				"%s shadows the variable declared at line %d:%d", name, outer.tok.Line, outer.tok.Column))
+			return
+		}
+	}
+}
+
+// finds the nearest variable called name, nil for builtins and unknown names
+func (l *Linter) lookup(name string) *variable {
+	for i := len(l.scopes) - 1; i >= 0; i-- {
+		if v, ok := l.scopes[i].vars[name]; ok {
+			return v
+		}
+	}
+	return nil
+}
+
+// declares the names a scope's own statements introduce, so closures can read
+// variables declared after them
+func (l *Linter) predeclare(s *scope, statements []ast.Statement) {
+	for _, stmt := range statements {
+		if decl, ok := stmt.(*ast.VariableDeclaration); ok && decl != nil && decl.Name != nil && !decl.IsAssignment() {
+			l.declareIn(s, decl.Name.Value, decl.Name.Token)
+		}
+	}
+}
+
+func (l *Linter) declareIn(s *scope, name string, tok token.Token) *variable {
+	if v, ok := s.vars[name]; ok {
+		return v
+	}
+	v := &variable{name: name, tok: tok}
+	s.vars[name] = v
+	s.order = append(s.order, v)
+	return v
+}
+
+func (l *Linter) openScope() *scope {
+	s := &scope{vars: make(map[string]*variable)}
+	l.scopes = append(l.scopes, s)
+	return s
+}
+
+// leaves the innermost scope, reporting the variables it never read
+func (l *Linter) closeScope() {
+	for _, v := range l.current().order {
+		if v.declared && !v.read && !v.param {
+			l.findings = append(l.findings, diagnostic.New(diagnostic.Warning, UNUSED_ASSIGNMENT, v.tok,
+				"%s is assigned but never read", v.name))
+		}
+	}
+	l.scopes = l.scopes[:len(l.scopes)-1]
+}
+
+func (l *Linter) current() *scope {
+	return l.scopes[len(l.scopes)-1]
+}
+
+func (l *Linter) report(code string, node ast.Node, format string, args ...interface{}) {
+	l.findings = append(l.findings, diagnostic.Diagnostic{
+		Severity: diagnostic.Warning,
+		Code:     code,
+		Span:     diagnostic.PositionSpan(node.Pos(), node.End()),
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// drops the findings a lint:ignore comment names, on the finding's line or
+// the line above it. a directive without rules ignores every rule
+func suppress(findings []diagnostic.Diagnostic, comments []*ast.Comment) []diagnostic.Diagnostic {
+	ignored := map[int][]string{}
+	for _, c := range comments {
+		directive, rules, ok := lexer.Directive(c.Token.Literal)
+		if !ok || directive != ignoreDirective {
+			continue
+		}
+		if len(rules) == 0 {
+			rules = []string{"all"}
+		}
+		ignored[c.Token.Line] = append(ignored[c.Token.Line], rules...)
+	}
+
+	kept := findings[:0]
+	for _, d := range findings {
+		line := d.Span.Start.Line
+		if !matches(ignored[line], d.Code) && !matches(ignored[line-1], d.Code) {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
+
+func matches(rules []string, code string) bool {
+	for _, rule := range rules {
+		if rule == "all" || strings.EqualFold(rule, code) {
+			return true
+		}
+	}
+	return false
+}
+
+// truthiness of a condition built only from literals
+func constant(expr ast.Expression) (truthy bool, ok bool) {
+	value, ok := constantValue(expr)
+	if !ok {
+		return false, false
+	}
+	return evaluator.IsTruthy(value), true
+}
+
+func constantValue(expr ast.Expression) (evaluator.Object, bool) {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral:
+		return &evaluator.Integer{Value: expr.Value}, true
+	case *ast.FloatLiteral:
+		return &evaluator.Float{Value: expr.Value}, true
+	case *ast.StringLiteral:
+		return &evaluator.String{Value: expr.Value}, true
+	case *ast.BooleanLiteral:
+		return evaluator.NativeBool(expr.Value), true
+
+	case *ast.PrefixExpression:
+		right, ok := constantValue(expr.Right)
+		if !ok {
+			return nil, false
+		}
+		return valueOf(evaluator.PrefixOperation(expr.Operator, right))
+
+	case *ast.InfixExpression:
+		left, leftOK := constantValue(expr.Left)
+		right, rightOK := constantValue(expr.Right)
+		if !leftOK || !rightOK {
+			return nil, false
+		}
+		return valueOf(evaluator.InfixOperation(expr.Operator, left, right, expr.Token))
+
+	case *ast.LogicalExpression:
+		left, leftOK := constantValue(expr.Left)
+		right, rightOK := constantValue(expr.Right)
+		if !leftOK || !rightOK {
+			return nil, false
+		}
+		if expr.Operator == "&&" {
+			return evaluator.NativeBool(evaluator.IsTruthy(left) && evaluator.IsTruthy(right)), true
+		}
+		return evaluator.NativeBool(evaluator.IsTruthy(left) || evaluator.IsTruthy(right)), true
+	}
+	return nil, false
+}
+
+// an operation that fails is left to report its error at runtime
+func valueOf(obj evaluator.Object) (evaluator.Object, bool) {
+	if obj == nil || obj.Type() == evaluator.ERROR_OBJ {
+		return nil, false
+	}
+	return obj, true
+}
+
+func isLiteral(expr ast.Expression) bool {
+	switch expr.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.BooleanLiteral,
+		*ast.ArrayLiteral, *ast.HashLiteral:
+		return true
+	}
+	return false
+}
+
+// numbers compare across int and float, anything else only with its own type
+func comparable(a, b typecheck.Type) bool {
+	numeric := func(t typecheck.Type) bool { return t == typecheck.INT || t == typecheck.FLOAT }
+	return a == b || numeric(a) && numeric(b)
+}
@@ -0,0 +1,117 @@
+package lint
+
+import (
+	"lexicon/src/ast"
+	"lexicon/src/lexer"
+	"lexicon/src/parser"
+	"strings"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		// assigned but never read
+		{"sprout x = 1;\nx = 2;", []string{"UNUSED_ASSIGNMENT 1:8 x is assigned but never read"}},
+		{"sprout x = 1; echo x;", nil},
+		{"sprout f = fn(a, b) { return a; }; echo f;", nil},
+		{"sprout fib = fn(n) { return fib(n - 1); }; echo fib;", nil},
+		{"sprout later = fn() { return helper(); };\nsprout helper = 1; echo later;", nil},
+		// redeclaration
+		{"sprout x = 1;\nsprout x = 2; echo x;", []string{"REDECLARED_VARIABLE 2:8 x is already declared in this scope at line 1:8"}},
+		{"sprout f = fn(a) { sprout a = 2; return a; }; echo f;", []string{"REDECLARED_VARIABLE 1:27 a is already declared in this scope at line 1:15"}},
+		// constant conditions
+		{"if (1 > 2) { echo 1; }", []string{"CONSTANT_CONDITION 1:5 if condition is always false"}},
+		{`if ("" && !false) { echo 1; }`, []string{"CONSTANT_CONDITION 1:5 if condition is always true"}},
+		{"while (false) { }", []string{"CONSTANT_CONDITION 1:8 while condition is always false"}},
+		{"for (; 0; ) { }", []string{"CONSTANT_CONDITION 1:8 for condition is always true"}},
+		{"while (true) { break; }", nil},
+		{"if (1 / 0) { echo 1; }", nil},
+		// comparisons
+		{`if ("a" == 1) { echo 1; }`, []string{
+			"INCOMPATIBLE_COMPARISON 1:5 comparing string with int using ==",
+			"CONSTANT_CONDITION 1:5 if condition is always false",
+		}},
+		{"sprout n = 5; echo n != \"5\";", []string{"INCOMPATIBLE_COMPARISON 1:20 comparing int with string using !="}},
+		{"sprout n = 5; echo n < 2.5; echo [1] == [1];", nil},
+		// unreachable else
+		{"if (true) { echo 1; } else { echo 2; }", []string{
+			"CONSTANT_CONDITION 1:5 if condition is always true",
+			"UNREACHABLE_ELSE 1:28 else branch never runs, the condition is always true",
+		}},
+		// shadowing
+		{"sprout x = 1; { sprout x = 2; echo x; } echo x;", []string{"SHADOWED_VARIABLE 1:24 x shadows the variable declared at line 1:8"}},
+		{"sprout x = 1; sprout f = fn() { sprout x = 2; return x; }; echo f; echo x;", []string{"SHADOWED_VARIABLE 1:40 x shadows the variable declared at line 1:8"}},
+		{"for (sprout i = 0; i < 2; i = i + 1) { for (sprout i = 0; i < 2; i = i + 1) { } }", []string{"SHADOWED_VARIABLE 1:52 i shadows the variable declared at line 1:13"}},
+		{"for (sprout i = 0; i < 2; sprout j = 1) { echo i; i = i + 1; }", []string{"UNUSED_ASSIGNMENT 1:34 j is assigned but never read"}},
+		{"for (sprout i = 0; i < 2; sprout i = i + 1) { echo i; }", []string{"REDECLARED_VARIABLE 1:34 i is already declared in this scope at line 1:13"}},
+		// a name declared later in the enclosing scope does not exist yet
+		{"{ sprout x = 1; echo x; } sprout x = 2; echo x;", nil},
+	}
+
+	for _, tt := range tests {
+		got := findings(t, tt.input)
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%q:\nexpected %q\ngot      %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestIgnoreComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"sprout x = 1; # lint:ignore unused_assignment", nil},
+		{"# lint:ignore UNUSED_ASSIGNMENT\nsprout x = 1;", nil},
+		{"# lint:ignore shadowed_variable, unused_assignment\nsprout x = 1;", nil},
+		{"sprout x = 1; # lint:ignore", nil},
+		// only the named rule is suppressed
+		{"sprout x = 1; # lint:ignore shadowed_variable", []string{"UNUSED_ASSIGNMENT 1:8 x is assigned but never read"}},
+		// and only near the comment
+		{"# lint:ignore unused_assignment\n\nsprout x = 1;", []string{"UNUSED_ASSIGNMENT 3:8 x is assigned but never read"}},
+		// an ordinary comment is no directive
+		{"sprout x = 1; # lint ignore unused_assignment", []string{"UNUSED_ASSIGNMENT 1:8 x is assigned but never read"}},
+	}
+
+	for _, tt := range tests {
+		got := findings(t, tt.input)
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%q:\nexpected %q\ngot      %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestSpans(t *testing.T) {
+	diagnostics := Lint(parse(t, "if (1 > 2) { echo 1; }"))
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected 1 finding, got=%d", len(diagnostics))
+	}
+	if span := diagnostics[0].Span; span.Start.Column != 5 || span.End.Column != 9 {
+		t.Errorf("expected the condition to be covered, got=%+v", span)
+	}
+}
+
+func findings(t *testing.T, input string) []string {
+	t.Helper()
+	var out []string
+	for _, d := range Lint(parse(t, input)) {
+		out = append(out, d.Code+" "+strings.TrimPrefix(d.String(), "[Line "))
+	}
+	for i, s := range out {
+		out[i] = strings.Replace(s, "] ", " ", 1)
+	}
+	return out
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
@@ -58,6 +58,11 @@ func (l *Logger) SetLevel(level LogLevel) {
 	l.level = level
 }
 
+// SetOutput sets the writer log and trace messages go to
+func (l *Logger) SetOutput(output io.Writer) {
+	l.output = output
+}
+
 // SetTraceMode enables or disables trace mode
 func (l *Logger) SetTraceMode(enabled bool) {
 	l.traceMode = enabled
@@ -170,3 +175,7 @@ func DecreaseIndent() {
 func SetLevel(level LogLevel) {
 	defaultLogger.SetLevel(level)
 }
+
+func SetOutput(output io.Writer) {
+	defaultLogger.SetOutput(output)
+}
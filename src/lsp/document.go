@@ -0,0 +1,299 @@
+package lsp
+
+import (
+	"lexicon/src/ast"
+	"lexicon/src/diagnostic"
+	"lexicon/src/lexer"
+	"lexicon/src/lint"
+	"lexicon/src/parser"
+	"lexicon/src/resolver"
+	"lexicon/src/token"
+	"lexicon/src/typecheck"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// document is an open file and everything the server knows about its
+// current text. it is analysed again from scratch on every change
+type document struct {
+	uri   string
+	text  string
+	lines []int // byte offset where each line starts
+
+	program     *ast.Program
+	checker     *typecheck.Checker
+	resolver    *resolver.Resolver
+	diagnostics []diagnostic.Diagnostic
+
+	// how each declaring token of the program declares its name, keyed by
+	// the token's offset
+	declarations map[int]declaration
+}
+
+type declaration struct {
+	name  string
+	kind  string // variable, constant, function or parameter
+	token token.Token
+}
+
+func newDocument(uri, text string) *document {
+	d := &document{uri: uri, text: text, lines: []int{0}, declarations: make(map[int]declaration)}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			d.lines = append(d.lines, i+1)
+		}
+	}
+
+	p := parser.New(lexer.New(text))
+	d.program = p.ParseProgram()
+	d.checker = typecheck.New()
+	d.checker.Check(d.program)
+	d.resolver = resolver.New()
+	d.resolver.Resolve(d.program)
+
+	// a program with syntax errors is still analysed so that navigation keeps
+	// working while typing, but only its syntax errors are reported. the
+	// resolver's unused variable warnings are left out, lint covers them
+	d.diagnostics = p.Diagnostics()
+	if len(d.diagnostics) == 0 {
+		d.diagnostics = append(d.diagnostics, d.checker.Diagnostics()...)
+		d.diagnostics = append(d.diagnostics, lint.Lint(d.program)...)
+		sort.SliceStable(d.diagnostics, func(i, j int) bool {
+			a, b := d.diagnostics[i].Span.Start, d.diagnostics[j].Span.Start
+			if a.Line != b.Line {
+				return a.Line < b.Line
+			}
+			return a.Column < b.Column
+		})
+	}
+
+	ast.Inspect(d.program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.VariableDeclaration:
+			if !node.IsAssignment() && node.Name != nil {
+				d.declare(node.Name, declarationKind(node))
+			}
+		case *ast.FunctionLiteral:
+			for _, param := range node.Parameters {
+				d.declare(param, "parameter")
+			}
+		}
+		return true
+	})
+	return d
+}
+
+func (d *document) declare(name *ast.Identifier, kind string) {
+	d.declarations[name.Token.Offset] = declaration{name: name.Value, kind: kind, token: name.Token}
+}
+
+func declarationKind(decl *ast.VariableDeclaration) string {
+	if _, ok := decl.Value.(*ast.FunctionLiteral); ok {
+		return "function"
+	}
+	if decl.IsConstant() {
+		return "constant"
+	}
+	return "variable"
+}
+
+// converts a protocol position to a byte offset, clamped to the text
+func (d *document) offset(pos Position) int {
+	if pos.Line < 0 {
+		return 0
+	}
+	if pos.Line >= len(d.lines) {
+		return len(d.text)
+	}
+	offset := d.lines[pos.Line]
+	for units := 0; offset < len(d.text) && d.text[offset] != '\n'; {
+		r, size := utf8.DecodeRuneInString(d.text[offset:])
+		units += utf16Length(r)
+		if units > pos.Character {
+			break
+		}
+		offset += size
+	}
+	return offset
+}
+
+// converts a byte offset to a protocol position. a character that starts
+// before offset is counted whole
+func (d *document) position(offset int) Position {
+	if offset > len(d.text) {
+		offset = len(d.text)
+	}
+	line := sort.Search(len(d.lines), func(i int) bool { return d.lines[i] > offset }) - 1
+	character := 0
+	for i := d.lines[line]; i < offset; {
+		r, size := utf8.DecodeRuneInString(d.text[i:])
+		character += utf16Length(r)
+		i += size
+	}
+	return Position{Line: line, Character: character}
+}
+
+// number of UTF-16 code units needed for r
+func utf16Length(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+// byte offset of a 1-based line and byte column
+func (d *document) lineColumn(line, column int) int {
+	if line < 1 {
+		return 0
+	}
+	if line > len(d.lines) {
+		return len(d.text)
+	}
+	offset := d.lines[line-1] + column - 1
+	if offset > len(d.text) {
+		return len(d.text)
+	}
+	return offset
+}
+
+// range covered by source positions, end being just past the last character
+func (d *document) rangeOf(start, end token.Position) Range {
+	return Range{Start: d.position(start.Offset), End: d.position(end.Offset)}
+}
+
+// range covered by a token
+func (d *document) tokenRange(tok token.Token) Range {
+	return d.rangeOf(tok.Pos(), tok.End())
+}
+
+// range covered by a diagnostic span, whose end column is inclusive
+func (d *document) spanRange(span diagnostic.Span) Range {
+	start := d.lineColumn(span.Start.Line, span.Start.Column)
+	end := d.lineColumn(span.End.Line, span.End.Column) + 1
+	if end <= start {
+		end = start + 1
+	}
+	if end > len(d.text) {
+		end = len(d.text)
+	}
+	return Range{Start: d.position(start), End: d.position(end)}
+}
+
+// range covering the whole text
+func (d *document) fullRange() Range {
+	return Range{End: d.position(len(d.text))}
+}
+
+// returns the innermost identifier under offset, an offset just past the
+// end of a name still counts so that the cursor may sit after it
+func (d *document) identifierAt(offset int) *ast.Identifier {
+	var found *ast.Identifier
+	ast.Inspect(d.program, func(node ast.Node) bool {
+		if _, isProgram := node.(*ast.Program); !isProgram && !contains(node, offset) {
+			return false
+		}
+		if ident, ok := node.(*ast.Identifier); ok {
+			found = ident
+		}
+		return true
+	})
+	return found
+}
+
+func contains(node ast.Node, offset int) bool {
+	return node != nil && node.Pos().Offset <= offset && offset <= node.End().Offset
+}
+
+// names visible at offset in the order they would be shadowed, a name
+// declared in an inner scope replacing the same name of an outer one
+func (d *document) namesAt(offset int) []declaration {
+	var names []declaration
+	index := make(map[string]int)
+	add := func(decl declaration) {
+		if i, ok := index[decl.name]; ok {
+			names[i] = decl
+			return
+		}
+		index[decl.name] = len(names)
+		names = append(names, decl)
+	}
+	addStatements := func(statements []ast.Statement) {
+		for _, stmt := range statements {
+			if decl, ok := stmt.(*ast.VariableDeclaration); ok && !decl.IsAssignment() && decl.Name != nil && decl.Pos().Offset < offset {
+				add(d.declarations[decl.Name.Token.Offset])
+			}
+		}
+	}
+
+	ast.Inspect(d.program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Program:
+			addStatements(node.Statements)
+			return true
+		}
+		if !contains(node, offset) {
+			return false
+		}
+		switch node := node.(type) {
+		case *ast.BlockStatement:
+			addStatements(node.Statements)
+		case *ast.FunctionLiteral:
+			for _, param := range node.Parameters {
+				add(d.declarations[param.Token.Offset])
+			}
+		case *ast.ForStatement:
+			if node.Init != nil {
+				addStatements([]ast.Statement{node.Init})
+			}
+		}
+		return true
+	})
+	return names
+}
+
+// symbols declared below node, the declarations inside a function are the
+// children of the function's symbol
+func (d *document) symbols(node ast.Node) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	ast.Inspect(node, func(n ast.Node) bool {
+		decl, ok := n.(*ast.VariableDeclaration)
+		if !ok || decl.IsAssignment() || decl.Name == nil {
+			return true
+		}
+		symbol := DocumentSymbol{
+			Name:           decl.Name.Value,
+			Kind:           SYMBOL_VARIABLE,
+			Range:          d.rangeOf(decl.Pos(), decl.End()),
+			SelectionRange: d.tokenRange(decl.Name.Token),
+		}
+		switch kind := declarationKind(decl); kind {
+		case "function":
+			fn := decl.Value.(*ast.FunctionLiteral)
+			symbol.Kind = SYMBOL_FUNCTION
+			symbol.Detail = signature(fn)
+			if fn.Body != nil {
+				symbol.Children = d.symbols(fn.Body)
+			}
+		case "constant":
+			symbol.Kind = SYMBOL_CONSTANT
+		}
+		if typ := d.checker.VariableType(decl.Name.Value); typ != typecheck.UNKNOWN && symbol.Detail == "" {
+			symbol.Detail = string(typ)
+		}
+		symbols = append(symbols, symbol)
+		// a function's declarations belong to it, any other value is
+		// searched for functions declared inside it
+		return symbol.Kind != SYMBOL_FUNCTION
+	})
+	return symbols
+}
+
+// parameter list of a function, such as fn(a, b)
+func signature(fn *ast.FunctionLiteral) string {
+	params := make([]string, len(fn.Parameters))
+	for i, param := range fn.Parameters {
+		params[i] = param.Value
+	}
+	return "fn(" + strings.Join(params, ", ") + ")"
+}
@@ -0,0 +1,327 @@
+// Package lsp implements a Language Server Protocol server for Sprout. It
+// speaks JSON-RPC over a pair of streams, normally the standard input and
+// output of the sprout-lsp binary, and answers from a fresh analysis of each
+// open document: the parser, the type checker, the resolver and the linter.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"lexicon/src/diagnostic"
+	"lexicon/src/formatter"
+	"lexicon/src/framing"
+	"lexicon/src/token"
+	"lexicon/src/typecheck"
+)
+
+// Server answers the requests of one editor session
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	initialized bool
+	shutdown    bool
+	documents   map[string]*document
+}
+
+// creates a server reading requests from in and writing replies to out
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		documents: make(map[string]*document),
+	}
+}
+
+// Run serves requests until the client sends exit. it returns an error when
+// the stream breaks or the client exits without asking for a shutdown first
+func (s *Server) Run() error {
+	for {
+		body, err := framing.Read(s.in)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return errors.New("connection closed before exit")
+			}
+			return err
+		}
+
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			if err := s.reply(nil, nil, &responseError{Code: PARSE_ERROR, Message: err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit without shutdown")
+			}
+			return nil
+		}
+
+		result, rpcErr := s.handle(msg)
+		if msg.ID == nil {
+			// notifications get no reply, even when they fail
+			continue
+		}
+		if err := s.reply(msg.ID, result, rpcErr); err != nil {
+			return err
+		}
+	}
+}
+
+// dispatches a request or notification and returns its result
+func (s *Server) handle(msg message) (interface{}, *responseError) {
+	switch {
+	case msg.Method == "initialize":
+		s.initialized = true
+		return s.initialize(), nil
+	case !s.initialized:
+		return nil, &responseError{Code: SERVER_NOT_INITIALIZED, Message: "server not initialized"}
+	case s.shutdown:
+		return nil, &responseError{Code: INVALID_REQUEST, Message: "server is shutting down"}
+	}
+
+	switch msg.Method {
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := decode(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		return nil, s.open(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := decode(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		// the server asks for full syncs, so the last change holds the whole text
+		if len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		return nil, s.open(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := decode(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		delete(s.documents, params.TextDocument.URI)
+		return nil, s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		})
+
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		if err := decode(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.withDocument(params.TextDocument.URI, func(doc *document) (interface{}, *responseError) {
+			return hover(doc, params.Position), nil
+		})
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		if err := decode(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.withDocument(params.TextDocument.URI, func(doc *document) (interface{}, *responseError) {
+			return definition(doc, params.Position), nil
+		})
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		if err := decode(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.withDocument(params.TextDocument.URI, func(doc *document) (interface{}, *responseError) {
+			return doc.symbols(doc.program), nil
+		})
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+		if err := decode(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.withDocument(params.TextDocument.URI, func(doc *document) (interface{}, *responseError) {
+			return completion(doc, params.Position), nil
+		})
+	case "textDocument/formatting":
+		var params DocumentFormattingParams
+		if err := decode(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.withDocument(params.TextDocument.URI, func(doc *document) (interface{}, *responseError) {
+			return format(doc), nil
+		})
+	}
+
+	return nil, &responseError{Code: METHOD_NOT_FOUND, Message: fmt.Sprintf("method not found: %s", msg.Method)}
+}
+
+func (s *Server) initialize() interface{} {
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"textDocumentSync":           1, // full text on every change
+			"hoverProvider":              true,
+			"definitionProvider":         true,
+			"documentSymbolProvider":     true,
+			"completionProvider":         map[string]interface{}{},
+			"documentFormattingProvider": true,
+		},
+		"serverInfo": map[string]interface{}{"name": "sprout-lsp"},
+	}
+}
+
+// analyses the text of a document and publishes its diagnostics
+func (s *Server) open(uri, text string) *responseError {
+	doc := newDocument(uri, text)
+	s.documents[uri] = doc
+
+	diagnostics := make([]Diagnostic, 0, len(doc.diagnostics))
+	for _, d := range doc.diagnostics {
+		diagnostics = append(diagnostics, convertDiagnostic(doc, d))
+	}
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+}
+
+func (s *Server) withDocument(uri string, f func(*document) (interface{}, *responseError)) (interface{}, *responseError) {
+	doc, ok := s.documents[uri]
+	if !ok {
+		return nil, &responseError{Code: INVALID_PARAMS, Message: fmt.Sprintf("document not open: %s", uri)}
+	}
+	return f(doc)
+}
+
+func (s *Server) reply(id *json.RawMessage, result interface{}, rpcErr *responseError) error {
+	msg := message{JSONRPC: "2.0", ID: id, Error: rpcErr}
+	if id == nil {
+		null := json.RawMessage("null")
+		msg.ID = &null
+	}
+	if rpcErr == nil {
+		encoded, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		msg.Result = encoded
+	}
+	return framing.Write(s.out, msg)
+}
+
+func (s *Server) notify(method string, params interface{}) *responseError {
+	encoded, err := json.Marshal(params)
+	if err == nil {
+		err = framing.Write(s.out, message{JSONRPC: "2.0", Method: method, Params: encoded})
+	}
+	if err != nil {
+		return &responseError{Code: INVALID_REQUEST, Message: err.Error()}
+	}
+	return nil
+}
+
+func decode(params json.RawMessage, v interface{}) *responseError {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &responseError{Code: INVALID_PARAMS, Message: err.Error()}
+	}
+	return nil
+}
+
+func convertDiagnostic(doc *document, d diagnostic.Diagnostic) Diagnostic {
+	severity := SEVERITY_ERROR
+	switch d.Severity {
+	case diagnostic.Warning:
+		severity = SEVERITY_WARNING
+	case diagnostic.Info:
+		severity = SEVERITY_INFORMATION
+	}
+	message := d.Message
+	if d.Hint != "" {
+		message += "\nhint: " + d.Hint
+	}
+	return Diagnostic{
+		Range:    doc.spanRange(d.Span),
+		Severity: severity,
+		Code:     d.Code,
+		Source:   "sprout",
+		Message:  message,
+	}
+}
+
+// the inferred type of the identifier under the cursor, such as
+// (variable) x: int
+func hover(doc *document, pos Position) *Hover {
+	ident := doc.identifierAt(doc.offset(pos))
+	if ident == nil {
+		return nil
+	}
+	kind := "variable"
+	if tok, ok := doc.resolver.Definition(ident); ok {
+		if decl, ok := doc.declarations[tok.Offset]; ok {
+			kind = decl.kind
+		}
+	} else if _, declared := doc.declarations[ident.Token.Offset]; !declared {
+		// a name the program never declares, such as a builtin
+		return nil
+	}
+
+	text := fmt.Sprintf("(%s) %s", kind, ident.Value)
+	if typ := doc.checker.VariableType(ident.Value); typ != typecheck.UNKNOWN {
+		text += ": " + string(typ)
+	}
+	return &Hover{
+		Contents: MarkupContent{Kind: "plaintext", Value: text},
+		Range:    doc.tokenRange(ident.Token),
+	}
+}
+
+// the declaration of the identifier under the cursor
+func definition(doc *document, pos Position) []Location {
+	ident := doc.identifierAt(doc.offset(pos))
+	if ident == nil {
+		return []Location{}
+	}
+	tok, ok := doc.resolver.Definition(ident)
+	if !ok {
+		return []Location{}
+	}
+	return []Location{{URI: doc.uri, Range: doc.tokenRange(tok)}}
+}
+
+// the keywords of the language followed by the names in scope at the cursor
+func completion(doc *document, pos Position) []CompletionItem {
+	items := []CompletionItem{}
+	for _, keyword := range token.Keywords() {
+		items = append(items, CompletionItem{Label: keyword, Kind: COMPLETION_KEYWORD, Detail: "keyword"})
+	}
+	for _, decl := range doc.namesAt(doc.offset(pos)) {
+		item := CompletionItem{Label: decl.name, Kind: COMPLETION_VARIABLE, Detail: decl.kind}
+		switch decl.kind {
+		case "function":
+			item.Kind = COMPLETION_FUNCTION
+		case "constant":
+			item.Kind = COMPLETION_CONSTANT
+		}
+		if typ := doc.checker.VariableType(decl.name); typ != typecheck.UNKNOWN {
+			item.Detail += " " + string(typ)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// a single edit replacing the document with its canonical form, none when it
+// is already formatted or does not parse
+func format(doc *document) []TextEdit {
+	formatted, err := formatter.Format(doc.text)
+	if err != nil || formatted == doc.text {
+		return []TextEdit{}
+	}
+	return []TextEdit{{Range: doc.fullRange(), NewText: formatted}}
+}
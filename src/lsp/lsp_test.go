@@ -0,0 +1,457 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"lexicon/src/framing"
+	"strings"
+	"testing"
+)
+
+// client drives a server over in-memory pipes the way an editor would
+type client struct {
+	t      *testing.T
+	in     *io.PipeWriter
+	out    *bufio.Reader
+	nextID int
+	done   chan error
+
+	// notifications received while waiting for responses, oldest first
+	notifications []message
+}
+
+func newClient(t *testing.T) *client {
+	t.Helper()
+	clientToServer, serverIn := io.Pipe()
+	serverOut, serverToClient := io.Pipe()
+	c := &client{t: t, in: serverIn, out: bufio.NewReader(serverOut), done: make(chan error, 1)}
+	go func() {
+		err := NewServer(clientToServer, serverToClient).Run()
+		serverToClient.Close()
+		c.done <- err
+	}()
+	t.Cleanup(func() { c.in.Close() })
+
+	c.request("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}}, nil)
+	c.send("initialized", nil, nil)
+	return c
+}
+
+func (c *client) send(method string, id *int, params interface{}) {
+	c.t.Helper()
+	msg := map[string]interface{}{"jsonrpc": "2.0", "method": method}
+	if id != nil {
+		msg["id"] = *id
+	}
+	if params != nil {
+		msg["params"] = params
+	}
+	if err := framing.Write(c.in, msg); err != nil {
+		c.t.Fatalf("writing %s: %v", method, err)
+	}
+}
+
+func (c *client) receive() message {
+	c.t.Helper()
+	body, err := framing.Read(c.out)
+	if err != nil {
+		c.t.Fatalf("reading message: %v", err)
+	}
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		c.t.Fatalf("decoding %s: %v", body, err)
+	}
+	return msg
+}
+
+// sends a request and decodes its result into result, returning the error
+// the server answered with
+func (c *client) request(method string, params interface{}, result interface{}) *responseError {
+	c.t.Helper()
+	c.nextID++
+	id := c.nextID
+	c.send(method, &id, params)
+	for {
+		msg := c.receive()
+		if msg.ID == nil {
+			c.notifications = append(c.notifications, msg)
+			continue
+		}
+		if string(*msg.ID) != itoa(id) {
+			c.t.Fatalf("%s: response to id %s, expected %d", method, *msg.ID, id)
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result != nil {
+			if err := json.Unmarshal(msg.Result, result); err != nil {
+				c.t.Fatalf("%s: decoding result %s: %v", method, msg.Result, err)
+			}
+		}
+		return nil
+	}
+}
+
+// opens a document and returns the diagnostics published for it
+func (c *client) open(uri, text string) []Diagnostic {
+	c.t.Helper()
+	c.send("textDocument/didOpen", nil, map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "languageId": "sprout", "version": 1, "text": text},
+	})
+	return c.diagnostics(uri)
+}
+
+// waits for the next diagnostics published for uri
+func (c *client) diagnostics(uri string) []Diagnostic {
+	c.t.Helper()
+	for {
+		var msg message
+		if len(c.notifications) > 0 {
+			msg, c.notifications = c.notifications[0], c.notifications[1:]
+		} else {
+			msg = c.receive()
+		}
+		if msg.Method != "textDocument/publishDiagnostics" {
+			c.t.Fatalf("expected diagnostics, got %+v", msg)
+		}
+		var params PublishDiagnosticsParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			c.t.Fatal(err)
+		}
+		if params.URI == uri {
+			return params.Diagnostics
+		}
+	}
+}
+
+func itoa(n int) string {
+	b, _ := json.Marshal(n)
+	return string(b)
+}
+
+func position(line, character int) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": testURI},
+		"position":     map[string]interface{}{"line": line, "character": character},
+	}
+}
+
+const testURI = "file:///test.spr"
+
+func TestLifecycle(t *testing.T) {
+	c := newClient(t)
+	if err := c.request("textDocument/unknown", map[string]interface{}{}, nil); err == nil || err.Code != METHOD_NOT_FOUND {
+		t.Errorf("expected method not found, got %v", err)
+	}
+	if err := c.request("shutdown", nil, nil); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	c.send("exit", nil, nil)
+	if err := <-c.done; err != nil {
+		t.Errorf("expected clean exit, got %v", err)
+	}
+}
+
+func TestExitWithoutShutdown(t *testing.T) {
+	c := newClient(t)
+	c.send("exit", nil, nil)
+	if err := <-c.done; err == nil {
+		t.Error("expected an error when exiting without shutdown")
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	c := newClient(t)
+
+	// syntax errors alone are reported while the program does not parse
+	got := c.open(testURI, "sprout x = ;\nsprout y = 1")
+	if len(got) == 0 || got[0].Severity != SEVERITY_ERROR || got[0].Source != "sprout" {
+		t.Fatalf("expected a syntax error, got %+v", got)
+	}
+	if got[0].Range.Start.Line != 0 {
+		t.Errorf("expected the error on the first line, got %+v", got[0].Range)
+	}
+
+	// type errors and lint findings once it does
+	c.send("textDocument/didChange", nil, map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": testURI, "version": 2},
+		"contentChanges": []map[string]interface{}{{"text": "sprout s = \"é\" - 1;\nsprout unused = 2;\n"}},
+	})
+	got = c.diagnostics(testURI)
+	codes := []string{}
+	for _, d := range got {
+		codes = append(codes, d.Code)
+	}
+	expected := "UNUSED_ASSIGNMENT TYPE_MISMATCH UNUSED_ASSIGNMENT"
+	if strings.Join(codes, " ") != expected {
+		t.Fatalf("expected %s, got %+v", expected, got)
+	}
+	if got[0].Severity != SEVERITY_WARNING || got[1].Severity != SEVERITY_ERROR {
+		t.Errorf("unexpected severities %+v", got)
+	}
+	// the name on line 2 covers characters 7 to 13
+	if r := got[2].Range; r.Start != (Position{1, 7}) || r.End != (Position{1, 13}) {
+		t.Errorf("expected the range of unused, got %+v", r)
+	}
+
+	c.send("textDocument/didClose", nil, map[string]interface{}{"textDocument": map[string]interface{}{"uri": testURI}})
+	if got := c.diagnostics(testURI); len(got) != 0 {
+		t.Errorf("expected diagnostics to be cleared on close, got %+v", got)
+	}
+}
+
+const program = `sprout total int = 0;
+const rate = 0.5;
+sprout add = fn(a, b) {
+    sprout sum = a + b;
+    return sum;
+};
+total = add(1, 2);
+echo total * rate;
+`
+
+func TestHover(t *testing.T) {
+	c := newClient(t)
+	c.open(testURI, program)
+
+	tests := []struct {
+		line, character int
+		expected        string
+	}{
+		{0, 8, "(variable) total: int"},
+		{1, 7, "(constant) rate: float"},
+		{2, 7, "(function) add: function"},
+		{3, 17, "(parameter) a"},
+		{6, 9, "(function) add: function"},
+		{7, 16, "(constant) rate: float"},
+		{7, 8, "(variable) total: int"},
+	}
+	for _, tt := range tests {
+		var got *Hover
+		if err := c.request("textDocument/hover", position(tt.line, tt.character), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got == nil || got.Contents.Value != tt.expected {
+			t.Errorf("%d:%d: expected %q, got %+v", tt.line, tt.character, tt.expected, got)
+		}
+	}
+
+	var got *Hover
+	c.request("textDocument/hover", position(7, 11), &got)
+	if got != nil {
+		t.Errorf("expected no hover over an operator, got %+v", got)
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	c := newClient(t)
+	c.open(testURI, program)
+
+	tests := []struct {
+		line, character int
+		expected        Range
+	}{
+		{6, 1, Range{Position{0, 7}, Position{0, 12}}},   // total = ...
+		{6, 10, Range{Position{2, 7}, Position{2, 10}}},  // add(...)
+		{4, 12, Range{Position{3, 11}, Position{3, 14}}}, // return sum
+		{3, 21, Range{Position{2, 19}, Position{2, 20}}}, // b in a + b
+	}
+	for _, tt := range tests {
+		var got []Location
+		if err := c.request("textDocument/definition", position(tt.line, tt.character), &got); err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got[0].URI != testURI || got[0].Range != tt.expected {
+			t.Errorf("%d:%d: expected %+v, got %+v", tt.line, tt.character, tt.expected, got)
+		}
+	}
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	c := newClient(t)
+	c.open(testURI, program)
+
+	var got []DocumentSymbol
+	if err := c.request("textDocument/documentSymbol", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": testURI},
+	}, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	var out []string
+	var list func(prefix string, symbols []DocumentSymbol)
+	list = func(prefix string, symbols []DocumentSymbol) {
+		for _, s := range symbols {
+			out = append(out, prefix+s.Name+" "+itoa(s.Kind)+" "+s.Detail)
+			list(prefix+s.Name+".", s.Children)
+		}
+	}
+	list("", got)
+	expected := []string{"total 13 int", "rate 14 float", "add 12 fn(a, b)", "add.sum 13 "}
+	if strings.Join(out, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+	if r := got[2].Range; r.Start != (Position{2, 0}) || r.End != (Position{5, 1}) {
+		t.Errorf("expected add to span lines 3 to 6, got %+v", r)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	c := newClient(t)
+	c.open(testURI, program)
+
+	names := func(line, character int) map[string]int {
+		var items []CompletionItem
+		if err := c.request("textDocument/completion", position(line, character), &items); err != nil {
+			t.Fatal(err)
+		}
+		kinds := make(map[string]int)
+		for _, item := range items {
+			kinds[item.Label] = item.Kind
+		}
+		return kinds
+	}
+
+	// inside the function body, after sum is declared
+	got := names(4, 4)
+	for name, kind := range map[string]int{
+		"sprout": COMPLETION_KEYWORD, "while": COMPLETION_KEYWORD, "fn": COMPLETION_KEYWORD,
+		"total": COMPLETION_VARIABLE, "rate": COMPLETION_CONSTANT, "add": COMPLETION_FUNCTION,
+		"a": COMPLETION_VARIABLE, "sum": COMPLETION_VARIABLE,
+	} {
+		if got[name] != kind {
+			t.Errorf("expected %s with kind %d, got %d", name, kind, got[name])
+		}
+	}
+
+	// at the top level the function's names are out of scope
+	got = names(7, 0)
+	for _, name := range []string{"a", "b", "sum"} {
+		if _, ok := got[name]; ok {
+			t.Errorf("%s should not be in scope at the top level", name)
+		}
+	}
+	// and names declared further down do not exist yet
+	got = names(1, 0)
+	if _, ok := got["add"]; ok {
+		t.Error("add should not be offered before its declaration")
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	c := newClient(t)
+	c.open(testURI, "sprout x=1\necho x")
+
+	params := map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": testURI},
+		"options":      map[string]interface{}{"tabSize": 4, "insertSpaces": true},
+	}
+	var got []TextEdit
+	if err := c.request("textDocument/formatting", params, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].NewText != "sprout x = 1;\necho x;\n" || got[0].Range.End != (Position{1, 6}) {
+		t.Fatalf("unexpected edits %+v", got)
+	}
+
+	// nothing to do for formatted or broken documents
+	for _, text := range []string{"sprout x = 1;\necho x;\n", "sprout = ;"} {
+		c.open(testURI, text)
+		if err := c.request("textDocument/formatting", params, &got); err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 0 {
+			t.Errorf("%q: expected no edits, got %+v", text, got)
+		}
+	}
+}
+
+func TestBrokenDocuments(t *testing.T) {
+	c := newClient(t)
+	// every request must survive whatever the parser could recover
+	for _, text := range []string{
+		"sprout", "sprout f = fn(", "if (x", "for (sprout i = 0; i <", "{ sprout a = [1, 2",
+		"sprout m = {\"k\": ", "echo x[1:", "delete", "fn(a) { return a", "😀 sprout x = 1;",
+	} {
+		c.open(testURI, text)
+		for line := 0; line < 2; line++ {
+			for character := 0; character < 20; character += 3 {
+				c.request("textDocument/hover", position(line, character), nil)
+				c.request("textDocument/definition", position(line, character), nil)
+				c.request("textDocument/completion", position(line, character), nil)
+			}
+		}
+		c.request("textDocument/documentSymbol", map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": testURI},
+		}, nil)
+	}
+}
+
+// half typed documents leave partial trees, the server keeps reporting their
+// syntax errors and answering about the names that did parse
+func TestHalfTypedDocuments(t *testing.T) {
+	c := newClient(t)
+	tests := []struct {
+		text  string
+		error string // message of the first diagnostic
+		name  string // declared on line 1, hovered there and completed on line 2
+	}{
+		{"sprout limit = 3;\nif (limit[] > 1) { echo limit; }", "no prefix parse function for ]", "limit"},
+		{"sprout total = 0;\nfor (sprout; total < 3; total = total + 1) { echo total; }", "Expected next token to be IDENT, got ; instead", "total"},
+		{"sprout n = 1;\necho n + 99999999999999999999;", "Could not parse \"99999999999999999999\" as integer", "n"},
+	}
+
+	for _, tt := range tests {
+		got := c.open(testURI, tt.text)
+		if len(got) == 0 || got[0].Message != tt.error {
+			t.Errorf("%q: expected the error %q, got %+v", tt.text, tt.error, got)
+		}
+
+		var hover *Hover
+		if err := c.request("textDocument/hover", position(0, 8), &hover); err != nil || hover == nil || !strings.Contains(hover.Contents.Value, tt.name) {
+			t.Errorf("%q: expected hover on %s, got %+v (%v)", tt.text, tt.name, hover, err)
+		}
+		for character := 0; character < 40; character++ {
+			if err := c.request("textDocument/hover", position(1, character), nil); err != nil {
+				t.Errorf("%q: hover at 1:%d failed: %v", tt.text, character, err)
+			}
+		}
+
+		var items []CompletionItem
+		if err := c.request("textDocument/completion", position(1, 0), &items); err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, item := range items {
+			found = found || item.Label == tt.name
+		}
+		if !found {
+			t.Errorf("%q: expected %s to be completed", tt.text, tt.name)
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+	doc := newDocument(testURI, "sprout s = \"😀é\";\necho s;")
+	tests := []struct {
+		offset   int
+		expected Position
+	}{
+		{0, Position{0, 0}},
+		{12, Position{0, 12}},
+		{16, Position{0, 14}}, // past the emoji, two UTF-16 units
+		{18, Position{0, 15}},
+		{21, Position{1, 0}},
+		{len(doc.text), Position{1, 7}},
+	}
+	for _, tt := range tests {
+		got := doc.position(tt.offset)
+		if got != tt.expected {
+			t.Errorf("position(%d): expected %+v, got %+v", tt.offset, tt.expected, got)
+		}
+		if back := doc.offset(got); back != tt.offset {
+			t.Errorf("offset(%+v): expected %d, got %d", got, tt.offset, back)
+		}
+	}
+}
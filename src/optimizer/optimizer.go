@@ -0,0 +1,304 @@
+package optimizer
+
+import (
+	"fmt"
+	"lexicon/src/ast"
+	"lexicon/src/evaluator"
+	"lexicon/src/token"
+	"lexicon/src/typecheck"
+	"strconv"
+)
+
+// Optimizer rewrites a program in place before it runs. Constant operator
+// subtrees are folded with the evaluator's own operators, so a folded program
+// computes exactly what the original would. Anything that would fail, such as
+// a literal division by zero, is left in the tree to fail at runtime at its
+// original position.
+type Optimizer struct {
+	types   *typecheck.Checker
+	globals map[string]bool
+}
+
+// creates an optimizer for a program run in an environment that already holds
+// globals, their types are unknown to the program so no identity relies on them
+func New(globals ...string) *Optimizer {
+	o := &Optimizer{globals: make(map[string]bool, len(globals))}
+	for _, name := range globals {
+		o.globals[name] = true
+	}
+	return o
+}
+
+// optimizes a program run in a fresh environment, or one holding globals
+func Optimize(program *ast.Program, globals []string) *ast.Program {
+	return New(globals...).Optimize(program)
+}
+
+// folds constants, prunes if statements with literal conditions and removes
+// identities such as x + 0 where x is provably numeric
+func (o *Optimizer) Optimize(program *ast.Program) *ast.Program {
+	o.types = typecheck.New()
+	o.types.Check(program)
+	program.Statements = o.statements(program.Statements)
+	return program
+}
+
+func (o *Optimizer) statements(statements []ast.Statement) []ast.Statement {
+	out := statements[:0]
+	for i, stmt := range statements {
+		_, isIf := stmt.(*ast.IfExpression)
+		stmt = o.statement(stmt)
+		// a pruned if that runs nothing can go, unless it gives the list its value
+		if block, ok := stmt.(*ast.BlockStatement); ok && isIf && len(block.Statements) == 0 && i < len(statements)-1 {
+			continue
+		}
+		out = append(out, stmt)
+	}
+	return out
+}
+
+func (o *Optimizer) statement(stmt ast.Statement) ast.Statement {
+	switch stmt := stmt.(type) {
+	case *ast.VariableDeclaration:
+		stmt.Value = o.expression(stmt.Value)
+
+	case *ast.PrintStatement:
+		stmt.Value = o.expression(stmt.Value)
+
+	case *ast.ExpressionStatement:
+		stmt.Expression = o.expression(stmt.Expression)
+
+	case *ast.ReturnStatement:
+		stmt.ReturnValue = o.expression(stmt.ReturnValue)
+
+	case *ast.IfExpression:
+		return o.ifStatement(stmt)
+
+	case *ast.BlockStatement:
+		o.block(stmt)
+
+	case *ast.WhileStatement:
+		stmt.Condition = o.expression(stmt.Condition)
+		o.block(stmt.Body)
+
+	case *ast.ForStatement:
+		if stmt.Init != nil {
+			stmt.Init = o.statement(stmt.Init)
+		}
+		stmt.Condition = o.expression(stmt.Condition)
+		if stmt.Post != nil {
+			stmt.Post = o.statement(stmt.Post)
+		}
+		o.block(stmt.Body)
+
+	case *ast.IndexAssignment:
+		stmt.Target.Left = o.expression(stmt.Target.Left)
+		stmt.Target.Index = o.expression(stmt.Target.Index)
+		stmt.Value = o.expression(stmt.Value)
+
+	case *ast.DeleteStatement:
+		stmt.Target.Left = o.expression(stmt.Target.Left)
+		stmt.Target.Index = o.expression(stmt.Target.Index)
+	}
+	return stmt
+}
+
+func (o *Optimizer) block(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+	block.Statements = o.statements(block.Statements)
+}
+
+// a literal condition picks its branch now. the branch stays a block, which
+// gets the same scope the if would have given it
+func (o *Optimizer) ifStatement(stmt *ast.IfExpression) ast.Statement {
+	stmt.Condition = o.expression(stmt.Condition)
+	o.block(stmt.Consequence)
+	o.block(stmt.Alternative)
+
+	value, ok := literalValue(stmt.Condition)
+	if !ok {
+		return stmt
+	}
+	if evaluator.IsTruthy(value) {
+		return stmt.Consequence
+	}
+	if stmt.Alternative != nil {
+		return stmt.Alternative
+	}
+	// evaluates to null like an if without a taken branch
+	return &ast.BlockStatement{Token: stmt.Token}
+}
+
+func (o *Optimizer) expression(expr ast.Expression) ast.Expression {
+	switch expr := expr.(type) {
+	case *ast.PrefixExpression:
+		expr.Right = o.expression(expr.Right)
+		return o.foldPrefix(expr)
+
+	case *ast.InfixExpression:
+		expr.Left = o.expression(expr.Left)
+		expr.Right = o.expression(expr.Right)
+		return o.foldInfix(expr)
+
+	case *ast.LogicalExpression:
+		expr.Left = o.expression(expr.Left)
+		expr.Right = o.expression(expr.Right)
+
+	case *ast.FunctionLiteral:
+		o.block(expr.Body)
+
+	case *ast.CallExpression:
+		expr.Function = o.expression(expr.Function)
+		for i, arg := range expr.Arguments {
+			expr.Arguments[i] = o.expression(arg)
+		}
+
+	case *ast.ArrayLiteral:
+		for i, el := range expr.Elements {
+			expr.Elements[i] = o.expression(el)
+		}
+
+	case *ast.IndexExpression:
+		expr.Left = o.expression(expr.Left)
+		expr.Index = o.expression(expr.Index)
+
+	case *ast.SliceExpression:
+		expr.Left = o.expression(expr.Left)
+		expr.Low = o.expression(expr.Low)
+		expr.High = o.expression(expr.High)
+
+	case *ast.HashLiteral:
+		for i, key := range expr.Keys {
+			expr.Keys[i] = o.expression(key)
+			expr.Values[i] = o.expression(expr.Values[i])
+		}
+	}
+	return expr
+}
+
+func (o *Optimizer) foldPrefix(expr *ast.PrefixExpression) ast.Expression {
+	right, ok := literalValue(expr.Right)
+	if !ok {
+		return expr
+	}
+	if lit := toLiteral(evaluator.PrefixOperation(expr.Operator, right), expr.Token); lit != nil {
+		return lit
+	}
+	return expr
+}
+
+func (o *Optimizer) foldInfix(expr *ast.InfixExpression) ast.Expression {
+	left, leftOK := literalValue(expr.Left)
+	right, rightOK := literalValue(expr.Right)
+	if leftOK && rightOK {
+		if lit := toLiteral(evaluator.InfixOperation(expr.Operator, left, right, expr.Token), expr.Token); lit != nil {
+			return lit
+		}
+		return expr
+	}
+
+	switch {
+	case rightOK && o.isIdentity(expr.Operator, expr.Left, right, false):
+		return expr.Left
+	case leftOK && o.isIdentity(expr.Operator, expr.Right, left, true):
+		return expr.Right
+	}
+	return expr
+}
+
+// reports whether operand op constant (or constant op operand, when the
+// constant is on the left) always equals operand. the operand must be proven
+// numeric, and an int operand only keeps its type with an int constant
+func (o *Optimizer) isIdentity(op string, operand ast.Expression, constant evaluator.Object, constantLeft bool) bool {
+	typ := o.types.TypeOf(operand)
+	if typ != typecheck.INT && typ != typecheck.FLOAT {
+		return false
+	}
+	if typ == typecheck.INT && constant.Type() != evaluator.INTEGER_OBJ {
+		return false
+	}
+	if o.usesGlobal(operand) {
+		return false
+	}
+
+	var n float64
+	switch c := constant.(type) {
+	case *evaluator.Integer:
+		n = float64(c.Value)
+	case *evaluator.Float:
+		n = c.Value
+	default:
+		return false
+	}
+
+	switch op {
+	case "+":
+		// -0.0 + 0 is 0.0, so only ints drop an added zero
+		return n == 0 && typ == typecheck.INT
+	case "*":
+		return n == 1
+	case "-":
+		return n == 0 && !constantLeft
+	case "/":
+		return n == 1 && !constantLeft
+	}
+	return false
+}
+
+// reports whether expr reads a name the program did not declare itself
+func (o *Optimizer) usesGlobal(expr ast.Expression) bool {
+	if len(o.globals) == 0 {
+		return false
+	}
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		return o.globals[expr.Value]
+	case *ast.PrefixExpression:
+		return o.usesGlobal(expr.Right)
+	case *ast.InfixExpression:
+		return o.usesGlobal(expr.Left) || o.usesGlobal(expr.Right)
+	}
+	// other expressions are never proven numeric
+	return false
+}
+
+// returns the value of a literal operand
+func literalValue(expr ast.Expression) (evaluator.Object, bool) {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral:
+		return &evaluator.Integer{Value: expr.Value}, true
+	case *ast.FloatLiteral:
+		return &evaluator.Float{Value: expr.Value}, true
+	case *ast.StringLiteral:
+		return &evaluator.String{Value: expr.Value}, true
+	case *ast.BooleanLiteral:
+		return evaluator.NativeBool(expr.Value), true
+	}
+	return nil, false
+}
+
+// turns a folded value back into a literal at the position of the expression
+// it replaces, nil when the value has no literal form or is an error
+func toLiteral(obj evaluator.Object, at token.Token) ast.Expression {
+	tok := token.Token{Line: at.Line, Column: at.Column}
+	switch obj := obj.(type) {
+	case *evaluator.Integer:
+		tok.Type, tok.Literal = token.INT, strconv.FormatInt(obj.Value, 10)
+		return &ast.IntegerLiteral{Token: tok, Value: obj.Value}
+	case *evaluator.Float:
+		tok.Type, tok.Literal = token.FLOAT, fmt.Sprint(obj.Value)
+		return &ast.FloatLiteral{Token: tok, Value: obj.Value}
+	case *evaluator.String:
+		tok.Type, tok.Literal = token.STRING, obj.Value
+		return &ast.StringLiteral{Token: tok, Value: obj.Value}
+	case *evaluator.Boolean:
+		tok.Type, tok.Literal = token.FALSE, "false"
+		if obj.Value {
+			tok.Type, tok.Literal = token.TRUE, "true"
+		}
+		return &ast.BooleanLiteral{Token: tok, Value: obj.Value}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package optimizer
+
+import (
+	"bytes"
+	"lexicon/src/ast"
+	"lexicon/src/evaluator"
+	"lexicon/src/lexer"
+	"lexicon/src/parser"
+	"strings"
+	"testing"
+)
+
+func TestFolding(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"2 ** 8 * 60;", "15360"},
+		{"1 + 2 * 3 - 4;", "3"},
+		{"7 / 2;", "3"},
+		{"7 % 3 + 0.5;", "1.500000"},
+		{"-5 + 2;", "-3"},
+		{"!true;", "false"},
+		{"!!0;", "true"},
+		{`"a" + "b" + 1;`, `"ab1"`},
+		{"1 < 2 == true;", "true"},
+		{"2.5 * 2;", "5.000000"},
+		{"sprout x = 3 * 3;", "sprout x = 9"},
+		{"echo [1 + 1, 2 * 2];", "echo [2, 4]"},
+		{"fn(a) { return a + 2 * 3; };", "fn(a) { return (a + 6); }"},
+	}
+
+	for _, tt := range tests {
+		program := Optimize(parse(t, tt.input), nil)
+		if got := strings.TrimSuffix(program.String(), ";"); got != tt.expected {
+			t.Errorf("%q: expected %q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestFoldingKeepsErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 / 0;", "ERROR [Line 1:3]: division by zero"},
+		{"(2 * 3) / (1 - 1);", "ERROR [Line 1:9]: division by zero"},
+		{"5 + true;", "ERROR [Line 1:3]: type mismatch: INTEGER + BOOLEAN"},
+		{"-\"a\";", "ERROR: unknown operator: -STRING"},
+		{"sprout f = fn() { return 10 % (2 - 2); };\nf();", "ERROR [Line 1:29]: modulo by zero"},
+	}
+
+	for _, tt := range tests {
+		original := run(t, parse(t, tt.input))
+		optimized := run(t, Optimize(parse(t, tt.input), nil))
+
+		if original.Inspect() != tt.expected {
+			t.Fatalf("%q: test expects %q, evaluator gives %q", tt.input, tt.expected, original.Inspect())
+		}
+		if optimized.Inspect() != tt.expected {
+			t.Errorf("%q: expected %q, got=%q", tt.input, tt.expected, optimized.Inspect())
+		}
+	}
+}
+
+func TestPruning(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if (true) { echo 1; } else { echo 2; }", "{ echo 1; }"},
+		{"if (1 > 2) { echo 1; } else { echo 2; }", "{ echo 2; }"},
+		{`if ("") { echo 1; }`, "{ echo 1; }"},
+		{"if (false) { echo 1; }\necho 2;", "echo 2;"},
+		{"echo 2;\nif (false) { echo 1; }", "echo 2;{  }"},
+		{"sprout x = 1;\nif (x) { echo 1; }", "sprout x = 1;if (x) { echo 1; }"},
+		{"while (true) { if (false) { break; } echo 1; }", "while (true) { echo 1; }"},
+	}
+
+	for _, tt := range tests {
+		program := Optimize(parse(t, tt.input), nil)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%q: expected %q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestIdentities(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"sprout x int = 5;\necho x + 0;", "echo x"},
+		{"sprout x = 5;\necho 0 + x;", "echo x"},
+		{"sprout x = 5;\necho x * 1;", "echo x"},
+		{"sprout x = 5;\necho 1 * (x - 0);", "echo x"},
+		{"sprout x = 5;\necho x / 1;", "echo x"},
+		{"sprout x = 1.5;\necho x * 1.0;", "echo x"},
+		// not provably numeric
+		{"sprout x = \"s\";\necho x + 0;", "echo (x + 0)"},
+		{"sprout f = fn(x) { return x + 0; };", "return (x + 0)"},
+		{"sprout x = 5;\nx = \"s\";\necho x * 1;", "echo (x * 1)"},
+		// the value would change
+		{"sprout x = 5;\necho x * 1.0;", "echo (x * 1.000000)"},
+		{"sprout x = 1.5;\necho x + 0;", "echo (x + 0)"},
+		{"sprout x = 5;\necho 0 - x;", "echo (0 - x)"},
+		{"sprout x = 5;\necho 1 / x;", "echo (1 / x)"},
+		{"sprout x = 5;\necho x * 0;", "echo (x * 0)"},
+	}
+
+	for _, tt := range tests {
+		program := Optimize(parse(t, tt.input), nil)
+		if got := program.String(); !strings.Contains(got, tt.expected) {
+			t.Errorf("%q: expected %q in %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestIdentitiesSkipGlobals(t *testing.T) {
+	program := Optimize(parse(t, "sprout x = 5;\necho x + 0;"), []string{"x"})
+	if got := program.String(); !strings.Contains(got, "(x + 0)") {
+		t.Errorf("expected the identity to stay for a global, got=%q", got)
+	}
+}
+
+// optimized programs give the same output and result as the originals
+func TestOptimizedProgramsRunUnchanged(t *testing.T) {
+	tests := []string{
+		"sprout x = 2 ** 10; echo x - 24 * 2;",
+		"sprout total = 0; for (sprout i = 0; i < 10; i = i + 1) { total = total + i * 1; } echo total;",
+		"sprout x = 1; if (true) { sprout x = 2; echo x; } echo x;",
+		"sprout f = fn(n) { if (false) { return 0; } return n * 2 + 0; }; echo f(21);",
+		"sprout s = \"n=\" + 1 + 2; echo s;",
+		"if (false) { echo 1; }",
+		"sprout a = [1 + 1, 2 * 3]; echo a[3 - 2];",
+		"sprout h = {\"k\" + 1: 1 < 2}; echo h[\"k1\"];",
+		"echo 1.0 / 3 * 3;",
+	}
+
+	for _, input := range tests {
+		var wantOut, gotOut bytes.Buffer
+		want := runTo(t, parse(t, input), &wantOut)
+		got := runTo(t, Optimize(parse(t, input), nil), &gotOut)
+
+		if want.Inspect() != got.Inspect() {
+			t.Errorf("%q: result mismatch. original=%s optimized=%s", input, want.Inspect(), got.Inspect())
+		}
+		if wantOut.String() != gotOut.String() {
+			t.Errorf("%q: output mismatch. original=%q optimized=%q", input, wantOut.String(), gotOut.String())
+		}
+	}
+}
+
+func run(t *testing.T, program *ast.Program) evaluator.Object {
+	t.Helper()
+	var out bytes.Buffer
+	return runTo(t, program, &out)
+}
+
+func runTo(t *testing.T, program *ast.Program, out *bytes.Buffer) evaluator.Object {
+	t.Helper()
+	env := evaluator.NewEnvironment()
+	env.SetExecContext(evaluator.NewExecContext(out, out))
+	return evaluator.Eval(program, env)
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors for %q: %s", input, strings.Join(p.Errors(), "; "))
+	}
+	return program
+}
@@ -1,8 +1,8 @@
 package parser
 
 import (
-	"fmt"
 	"lexicon/src/ast"
+	"lexicon/src/diagnostic"
 	"lexicon/src/lexer"
 	"lexicon/src/token"
 	"strconv"
@@ -12,13 +12,29 @@ type Parser struct {
 	l         *lexer.Lexer
 	currToken token.Token
 	peekToken token.Token
-	errors    []string // parsing errors with line numbers
+	errors    []diagnostic.Diagnostic
+	loopDepth int // number of enclosing loops, for break/continue
+
+	// set by a syntax error until the parser has skipped to the next statement,
+	// errors reported meanwhile are follow-on errors and are dropped
+	recovering bool
+	// synchronize stopped on a } that closes the enclosing block
+	closedBlock bool
+	// braces opened and not yet closed up to the current token
+	braceDepth int
+
+	// names declared per open block, true for constants
+	scopes []map[string]bool
+
+	// comments skipped over so far, they are not part of any statement
+	comments []*ast.Comment
 }
 
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
-		errors: []string{},
+		errors: []diagnostic.Diagnostic{},
+		scopes: []map[string]bool{{}},
 	}
 	p.nextToken()
 	p.nextToken()
@@ -28,24 +44,76 @@ func New(l *lexer.Lexer) *Parser {
 func (p *Parser) nextToken() {
 	p.currToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+	for p.peekToken.Type == token.COMMENT {
+		p.comments = append(p.comments, &ast.Comment{Token: p.peekToken})
+		p.peekToken = p.l.NextToken()
+	}
+
+	switch p.currToken.Type {
+	case token.LBRACE:
+		p.braceDepth++
+	case token.RBRACE:
+		p.braceDepth--
+	}
 }
 
 // Errors returns the list of parsing errors
 func (p *Parser) Errors() []string {
+	return diagnostic.Strings(p.errors)
+}
+
+// Diagnostics returns the parsing errors with their codes and spans
+func (p *Parser) Diagnostics() []diagnostic.Diagnostic {
 	return p.errors
 }
 
-// addError adds a formatted error message with line number
-func (p *Parser) addError(format string, args ...interface{}) {
-	msg := fmt.Sprintf(format, args...)
-	p.errors = append(p.errors, msg)
+// codes of the errors the parser reports
+const (
+	EXPECTED_TOKEN            = "EXPECTED_TOKEN"
+	NO_PREFIX_PARSE_FN        = "NO_PREFIX_PARSE_FN"
+	UNCLOSED_BLOCK            = "UNCLOSED_BLOCK"
+	INVALID_NUMBER            = "INVALID_NUMBER"
+	CONST_REDECLARED          = "CONST_REDECLARED"
+	CONST_ASSIGNED            = "CONST_ASSIGNED"
+	LOOP_CONTROL_OUTSIDE_LOOP = "LOOP_CONTROL_OUTSIDE_LOOP"
+	INVALID_DELETE_TARGET     = "INVALID_DELETE_TARGET"
+	MISSING_INDEX             = "MISSING_INDEX"
+)
+
+// addError adds an error at tok, an error already reported at the same place
+// is not repeated
+func (p *Parser) addError(d diagnostic.Diagnostic) {
+	if p.recovering {
+		return
+	}
+	for _, err := range p.errors {
+		if err.String() == d.String() {
+			return
+		}
+	}
+	p.errors = append(p.errors, d)
+}
+
+// creates an error diagnostic covering tok
+func errorAt(code string, tok token.Token, format string, args ...interface{}) diagnostic.Diagnostic {
+	return diagnostic.New(diagnostic.Error, code, tok, format, args...)
+}
+
+// syntaxError adds an error after which the parser no longer knows where it is,
+// it stays quiet until synchronize has found the next statement
+func (p *Parser) syntaxError(d diagnostic.Diagnostic) {
+	p.addError(d)
+	p.recovering = true
 }
 
 // peekError adds an error when expected token doesn't match
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("[Line %d:%d] Expected next token to be %s, got %s instead",
-		p.peekToken.Line, p.peekToken.Column, t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.syntaxError(errorAt(EXPECTED_TOKEN, p.peekToken,
+		"Expected next token to be %s, got %s instead", t, p.peekToken.Type))
+}
+
+func (p *Parser) noPrefixParseFnError(t token.Token) {
+	p.syntaxError(errorAt(NO_PREFIX_PARSE_FN, t, "no prefix parse function for %s", t.Type))
 }
 
 func (p *Parser) expectPeek(t token.TokenType) bool {
@@ -57,6 +125,85 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 	return false
 }
 
+// scope tracking lets the parser reject reassigning a constant it can see
+func (p *Parser) openScope() {
+	p.scopes = append(p.scopes, map[string]bool{})
+}
+
+func (p *Parser) closeScope() {
+	p.scopes = p.scopes[:len(p.scopes)-1]
+}
+
+func (p *Parser) declare(name string, constant bool) {
+	p.scopes[len(p.scopes)-1][name] = constant
+}
+
+// reports whether the nearest visible declaration of name is a constant
+func (p *Parser) isConstant(name string) bool {
+	for i := len(p.scopes) - 1; i >= 0; i-- {
+		if constant, ok := p.scopes[i][name]; ok {
+			return constant
+		}
+	}
+	return false
+}
+
+// statements that start a new statement, synchronize stops in front of them
+var statementKeywords = map[token.TokenType]bool{
+	token.SPROUT:   true,
+	token.CONST:    true,
+	token.ECHO:     true,
+	token.IF:       true,
+	token.RETURN:   true,
+	token.WHILE:    true,
+	token.FOR:      true,
+	token.BREAK:    true,
+	token.CONTINUE: true,
+	token.DELETE:   true,
+}
+
+// synchronize skips the rest of a statement that failed to parse, base is the
+// brace depth the statement started at. it stops on the ; that ends the
+// statement, on the } that closes a block opened within it, or in front of a
+// statement keyword or the } of the enclosing block
+func (p *Parser) synchronize(base int) {
+	p.recovering = false
+
+	for {
+		switch {
+		case p.currToken.Type == token.EOF:
+			return
+		case p.braceDepth < base:
+			// the statement was cut short by the end of its block
+			p.closedBlock = true
+			return
+		case p.braceDepth == base && p.currToken.Type == token.SEMICOLON:
+			return
+		case p.braceDepth == base && p.currToken.Type == token.RBRACE:
+			return
+		case p.braceDepth == base && (p.peekToken.Type == token.RBRACE || statementKeywords[p.peekToken.Type]):
+			return
+		}
+		p.nextToken()
+	}
+}
+
+// parses the next statement, a statement with a syntax error is skipped and
+// dropped
+func (p *Parser) parseNextStatement() ast.Statement {
+	base := p.braceDepth
+	if p.currToken.Type == token.LBRACE {
+		base--
+	}
+
+	stmt := p.parseStatement()
+	if p.recovering {
+		p.synchronize(base)
+		return nil
+	}
+	return stmt
+}
+
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
@@ -68,39 +215,52 @@ func (p *Parser) ParseProgram() *ast.Program {
 			continue
 		}
 
-		stmt := p.parseStatement()
+		stmt := p.parseNextStatement()
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
+		// a stray } at the top level has nothing to close
+		p.closedBlock = false
 		p.nextToken()
 	}
 
+	program.Comments = p.comments
 	return program
 }
 
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.currToken.Type {
-	case token.COMMENT:
-		// skip comments - they don't produce statements
-		return nil
 	case token.IDENT:
 		// check if it's an assignment or expression
 		if p.peekToken.Type == token.ASSIGN {
 			return p.parseAssignment()
 		}
 		return p.parseExpressionStatement()
-	case token.SPROUT:
+	case token.SPROUT, token.CONST:
 		return p.parseVariableDeclaration()
 	case token.ECHO:
 		return p.parsePrintStatement()
 	case token.IF:
 		return p.parseIfExpression()
+	case token.RETURN:
+		return p.parseReturnStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK, token.CONTINUE:
+		return p.parseLoopControl()
+	case token.DELETE:
+		return p.parseDeleteStatement()
+	case token.LBRACE:
+		// a brace at statement start opens a block, in expression position it is a hash
+		return p.parseBlockStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
-// sprout x = 10 | sprout x int = 10
+// sprout x = 10 | sprout x int = 10 | const x = 10
 func (p *Parser) parseVariableDeclaration() *ast.VariableDeclaration {
 	stmt := &ast.VariableDeclaration{Token: p.currToken}
 	if !p.expectPeek(token.IDENT) {
@@ -108,6 +268,12 @@ func (p *Parser) parseVariableDeclaration() *ast.VariableDeclaration {
 	}
 	stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
 
+	if p.scopes[len(p.scopes)-1][stmt.Name.Value] {
+		p.addError(errorAt(CONST_REDECLARED, stmt.Name.Token, "cannot redeclare constant %s", stmt.Name.Value).
+			WithHint("use a different name, constants cannot be declared twice in one scope"))
+	}
+	p.declare(stmt.Name.Value, stmt.IsConstant())
+
 	if p.peekToken.Type == token.TYPE_IDENT {
 		p.nextToken()
 		stmt.Type = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
@@ -127,6 +293,11 @@ func (p *Parser) parseAssignment() *ast.VariableDeclaration {
 	stmt := &ast.VariableDeclaration{Token: p.currToken}
 	stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
 
+	if p.isConstant(stmt.Name.Value) {
+		p.addError(errorAt(CONST_ASSIGNED, stmt.Name.Token, "cannot assign to constant %s", stmt.Name.Value).
+			WithHint("declare %s with sprout instead of const to allow reassignment", stmt.Name.Value))
+	}
+
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
@@ -165,8 +336,110 @@ func (p *Parser) parseIfExpression() *ast.IfExpression {
 	return expr
 }
 
+// while (cond) { }
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Token: p.currToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseLoopBody()
+
+	return stmt
+}
+
+// for (init; cond; post) { }
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	stmt := &ast.ForStatement{Token: p.currToken}
+
+	// the init clause is scoped to the loop
+	p.openScope()
+	defer p.closeScope()
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	if p.currToken.Type != token.SEMICOLON {
+		stmt.Init = p.parseForClause()
+		if !p.expectPeek(token.SEMICOLON) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+	if p.currToken.Type != token.SEMICOLON {
+		stmt.Condition = p.parseExpression(LOWEST)
+		if !p.expectPeek(token.SEMICOLON) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+	if p.currToken.Type != token.RPAREN {
+		stmt.Post = p.parseForClause()
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseLoopBody()
+
+	return stmt
+}
+
+// parses the init or post clause of a for loop, nil when it has a syntax
+// error so that the loop never holds a typed nil statement
+func (p *Parser) parseForClause() ast.Statement {
+	stmt := p.parseStatement()
+	if p.recovering {
+		return nil
+	}
+	return stmt
+}
+
+// parses a block in which break and continue are allowed
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+	return p.parseBlockStatement()
+}
+
+// break | continue
+func (p *Parser) parseLoopControl() ast.Statement {
+	if p.loopDepth == 0 {
+		p.addError(errorAt(LOOP_CONTROL_OUTSIDE_LOOP, p.currToken, "%s outside loop", p.currToken.Literal).
+			WithHint("break and continue only work inside while and for loops of the same function"))
+		return nil
+	}
+
+	if p.currToken.Type == token.BREAK {
+		return &ast.BreakStatement{Token: p.currToken}
+	}
+	return &ast.ContinueStatement{Token: p.currToken}
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.currToken}
+	p.openScope()
+	defer p.closeScope()
+	// recovering from its own statements must not clear an error of the
+	// statement the block belongs to, that statement is still dropped
+	recovering := p.recovering
+	defer func() { p.recovering = p.recovering || recovering }()
 	p.nextToken()
 
 	for p.currToken.Type != token.RBRACE && p.currToken.Type != token.EOF {
@@ -176,13 +449,26 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 			continue
 		}
 
-		stmt := p.parseStatement()
+		stmt := p.parseNextStatement()
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
+		if p.closedBlock {
+			p.closedBlock = false
+			if p.currToken.Type == token.RBRACE {
+				block.Rbrace = p.currToken
+			}
+			return block
+		}
 		p.nextToken()
 	}
 
+	if p.currToken.Type == token.RBRACE {
+		block.Rbrace = p.currToken
+	} else {
+		p.syntaxError(errorAt(UNCLOSED_BLOCK, p.currToken, "Expected next token to be %s, got %s instead", token.RBRACE, token.EOF).
+			WithHint("add } to close the block opened at line %d:%d", block.Token.Line, block.Token.Column))
+	}
 	return block
 }
 
@@ -194,8 +480,37 @@ func (p *Parser) parsePrintStatement() *ast.PrintStatement {
 	return stmt
 }
 
+// return | return x + 1
+func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
+	stmt := &ast.ReturnStatement{Token: p.currToken}
+
+	// bare return yields null
+	if p.peekToken.Type == token.SEMICOLON || p.peekToken.Type == token.RBRACE ||
+		p.peekToken.Type == token.EOF {
+		return stmt
+	}
+
+	p.nextToken()
+	stmt.ReturnValue = p.parseExpression(LOWEST)
+	return stmt
+}
+
+// delete m["key"]
+func (p *Parser) parseDeleteStatement() ast.Statement {
+	stmt := &ast.DeleteStatement{Token: p.currToken}
+	p.nextToken()
+
+	target, ok := p.parseExpression(LOWEST).(*ast.IndexExpression)
+	if !ok {
+		p.addError(errorAt(INVALID_DELETE_TARGET, stmt.Token, "delete expects an index expression like m[key]"))
+		return nil
+	}
+	stmt.Target = target
+	return stmt
+}
+
 // expression statement (for standalone expressions like "a;" or "5;")
-func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
+func (p *Parser) parseExpressionStatement() ast.Statement {
 	stmt := &ast.ExpressionStatement{Token: p.currToken}
 	stmt.Expression = p.parseExpression(LOWEST)
 
@@ -204,6 +519,21 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 		return nil
 	}
 
+	// a[i] = v
+	if target, ok := stmt.Expression.(*ast.IndexExpression); ok && p.peekToken.Type == token.ASSIGN {
+		return p.parseIndexAssignment(target)
+	}
+
+	return stmt
+}
+
+// a[i] = v
+func (p *Parser) parseIndexAssignment(target *ast.IndexExpression) ast.Statement {
+	p.nextToken()
+	stmt := &ast.IndexAssignment{Token: p.currToken, Target: target}
+
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
 	return stmt
 }
 
@@ -220,6 +550,8 @@ const (
 	PRODUCT     // *, /, %
 	EXPONENT    // **
 	PREFIX      // -X, not X
+	CALL        // fn(x)
+	INDEX       // a[i]
 )
 
 var precedences = map[token.TokenType]int{
@@ -244,6 +576,9 @@ var precedences = map[token.TokenType]int{
 	token.DIV:   PRODUCT,
 	token.MOD:   PRODUCT,
 	token.EXP:   EXPONENT,
+
+	token.LPAREN:   CALL,
+	token.LBRACKET: INDEX,
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
@@ -264,18 +599,38 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 		leftExp = p.parseBooleanLiteral()
 	case token.LPAREN:
 		leftExp = p.parseGroupedExpression()
+	case token.FUNCTION:
+		leftExp = p.parseFunctionLiteral()
+	case token.LBRACKET:
+		leftExp = p.parseArrayLiteral()
+	case token.LBRACE:
+		leftExp = p.parseHashLiteral()
 	default:
+		p.noPrefixParseFnError(p.currToken)
 		return nil
 	}
 
 	for precedence < p.peekPrecedence() {
+		// an operand that failed to parse leaves the operator nothing to apply
+		// to, the rest of the statement is skipped
+		if leftExp == nil {
+			p.recovering = true
+			return nil
+		}
 		switch p.peekToken.Type {
 		case token.PLUS, token.MINUS, token.MUL, token.DIV, token.MOD, token.EXP,
-			token.EQ, token.NOT_EQ, token.LT, token.GT, token.LTE, token.GTE,
-			token.LOGICAL_AND, token.LOGICAL_OR,
-			token.AND, token.OR:
+			token.EQ, token.NOT_EQ, token.LT, token.GT, token.LTE, token.GTE:
 			p.nextToken()
 			leftExp = p.parseInfixExpression(leftExp)
+		case token.LOGICAL_AND, token.LOGICAL_OR, token.AND, token.OR:
+			p.nextToken()
+			leftExp = p.parseLogicalExpression(leftExp)
+		case token.LPAREN:
+			p.nextToken()
+			leftExp = p.parseCallExpression(leftExp)
+		case token.LBRACKET:
+			p.nextToken()
+			leftExp = p.parseIndexExpression(leftExp)
 		default:
 			return leftExp
 		}
@@ -308,9 +663,6 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	// for right-associative operators like exponentiation
 	if expr.Operator == "**" {
 		expr.Right = p.parseExpression(precedence - 1)
-	} else if p.currToken.Type == token.LPAREN {
-		// to parse parenthesis
-		expr.Right = p.parseGroupedExpression()
 	} else {
 		expr.Right = p.parseExpression(precedence)
 	}
@@ -318,6 +670,21 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expr
 }
 
+// a && b | a || b, kept apart from infix expressions so they can short-circuit
+func (p *Parser) parseLogicalExpression(left ast.Expression) ast.Expression {
+	expr := &ast.LogicalExpression{
+		Token:    p.currToken,
+		Left:     left,
+		Operator: p.normalizeLogicalOperator(p.currToken.Literal),
+	}
+
+	precedence := p.currPrecedence()
+	p.nextToken()
+	expr.Right = p.parseExpression(precedence)
+
+	return expr
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	expr := &ast.PrefixExpression{
 		Token:    p.currToken,
@@ -325,17 +692,181 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 	}
 
 	p.nextToken()
+	expr.Right = p.parseExpression(PREFIX)
 
-	// to parse parenthesis
-	if p.currToken.Type == token.LPAREN {
-		expr.Right = p.parseGroupedExpression()
-	} else {
-		expr.Right = p.parseExpression(PREFIX)
+	return expr
+}
+
+// fn(a, b) { ... }
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	lit := &ast.FunctionLiteral{Token: p.currToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
 	}
+	lit.Parameters = p.parseFunctionParameters()
+	if lit.Parameters == nil {
+		return nil
+	}
+
+	// parameters shadow outer names, including constants
+	p.openScope()
+	defer p.closeScope()
+	for _, param := range lit.Parameters {
+		p.declare(param.Value, false)
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	// break and continue do not cross function boundaries
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
+	lit.Body = p.parseBlockStatement()
+	p.loopDepth = loopDepth
+
+	return lit
+}
+
+func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+	params := []*ast.Identifier{}
+
+	if p.peekToken.Type == token.RPAREN {
+		p.nextToken()
+		return params
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	params = append(params, &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal})
+
+	for p.peekToken.Type == token.COMMA {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		params = append(params, &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal})
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return params
+}
 
+// add(1, 2)
+func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+	expr := &ast.CallExpression{Token: p.currToken, Function: function}
+	expr.Arguments = p.parseExpressionList(token.RPAREN)
+	if expr.Arguments == nil {
+		return nil
+	}
+	expr.Rparen = p.currToken
 	return expr
 }
 
+// [1, 2, 3]
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.currToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if array.Elements == nil {
+		return nil
+	}
+	array.Rbracket = p.currToken
+	return array
+}
+
+// {"a": 1, "b": 2}
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.currToken}
+
+	for p.peekToken.Type != token.RBRACE {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+
+		hash.Keys = append(hash.Keys, key)
+		hash.Values = append(hash.Values, value)
+
+		if p.peekToken.Type != token.RBRACE && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	hash.Rbrace = p.currToken
+	return hash
+}
+
+// a[i] | a[low:high]
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	tok := p.currToken
+
+	var index ast.Expression
+	if p.peekToken.Type != token.COLON {
+		p.nextToken()
+		index = p.parseExpression(LOWEST)
+	}
+
+	if p.peekToken.Type == token.COLON {
+		p.nextToken()
+		slice := &ast.SliceExpression{Token: tok, Left: left, Low: index}
+		if p.peekToken.Type != token.RBRACKET {
+			p.nextToken()
+			slice.High = p.parseExpression(LOWEST)
+		}
+		if !p.expectPeek(token.RBRACKET) {
+			return nil
+		}
+		slice.Rbracket = p.currToken
+		return slice
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	if index == nil {
+		p.addError(errorAt(MISSING_INDEX, tok, "Missing index expression"))
+		return nil
+	}
+	return &ast.IndexExpression{Token: tok, Left: left, Index: index, Rbracket: p.currToken}
+}
+
+// parses comma separated expressions up to the closing token
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	list := []ast.Expression{}
+
+	if p.peekToken.Type == end {
+		p.nextToken()
+		return list
+	}
+
+	p.nextToken()
+	list = append(list, p.parseExpression(LOWEST))
+
+	for p.peekToken.Type == token.COMMA {
+		p.nextToken()
+		p.nextToken()
+		list = append(list, p.parseExpression(LOWEST))
+	}
+
+	if !p.expectPeek(end) {
+		return nil
+	}
+
+	return list
+}
+
 func (p *Parser) parseBooleanLiteral() ast.Expression {
 	return &ast.BooleanLiteral{
 		Token: p.currToken,
@@ -346,8 +877,7 @@ func (p *Parser) parseBooleanLiteral() ast.Expression {
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	value, err := strconv.ParseInt(p.currToken.Literal, 10, 64)
 	if err != nil {
-		p.addError("[Line %d:%d] Could not parse %q as integer",
-			p.currToken.Line, p.currToken.Column, p.currToken.Literal)
+		p.addError(errorAt(INVALID_NUMBER, p.currToken, "Could not parse %q as integer", p.currToken.Literal))
 		return nil
 	}
 	return &ast.IntegerLiteral{Token: p.currToken, Value: value}
@@ -356,8 +886,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 func (p *Parser) parseFloatLiteral() ast.Expression {
 	value, err := strconv.ParseFloat(p.currToken.Literal, 64)
 	if err != nil {
-		p.addError("[Line %d:%d] Could not parse %q as float",
-			p.currToken.Line, p.currToken.Column, p.currToken.Literal)
+		p.addError(errorAt(INVALID_NUMBER, p.currToken, "Could not parse %q as float", p.currToken.Literal))
 		return nil
 	}
 	return &ast.FloatLiteral{
@@ -374,18 +903,21 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.currToken, Value: p.currToken.Literal}
 }
 
-func (p *Parser) currPrecedence() int {
-	if prec, ok := precedences[p.currToken.Type]; ok {
+// Precedence returns how tightly an infix operator binds, LOWEST for any
+// other token
+func Precedence(t token.TokenType) int {
+	if prec, ok := precedences[t]; ok {
 		return prec
 	}
 	return LOWEST
 }
 
+func (p *Parser) currPrecedence() int {
+	return Precedence(p.currToken.Type)
+}
+
 func (p *Parser) peekPrecedence() int {
-	if prec, ok := precedences[p.peekToken.Type]; ok {
-		return prec
-	}
-	return LOWEST
+	return Precedence(p.peekToken.Type)
 }
 
 func (p *Parser) normalizeLogicalOperator(op string) string {
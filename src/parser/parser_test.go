@@ -3,6 +3,8 @@ package parser
 import (
 	"lexicon/src/ast"
 	"lexicon/src/lexer"
+	"lexicon/src/token"
+	"reflect"
 	"testing"
 )
 
@@ -32,6 +34,27 @@ func TestVariableDeclaration(t *testing.T) {
 	if stmt.Name.Value != "x" {
 		t.Errorf("expected variable name 'x', got=%s", stmt.Name.Value)
 	}
+	if got := program.Statements[2].String(); got != "x = 30;" {
+		t.Errorf("assignment printed as %q", got)
+	}
+}
+
+func TestCommentsAreCollected(t *testing.T) {
+	input := "# top\nsprout x = 1; # after x\nsprout y = [1, # inside\n2];"
+	program := parse(t, input)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("expected 2 statements, got=%d", len(program.Statements))
+	}
+	expected := []string{"# top", "# after x", "# inside"}
+	if len(program.Comments) != len(expected) {
+		t.Fatalf("expected %d comments, got=%d", len(expected), len(program.Comments))
+	}
+	for i, c := range program.Comments {
+		if c.String() != expected[i] || input[c.Pos().Offset:c.End().Offset] != expected[i] {
+			t.Errorf("comments[%d]: expected %q, got=%q", i, expected[i], c.String())
+		}
+	}
 }
 
 func TestIfElseParsing(t *testing.T) {
@@ -158,13 +181,13 @@ func TestLogicalExpressions(t *testing.T) {
 		t.Fatalf("expected *ast.VariableDeclaration, got=%T", program.Statements[0])
 	}
 
-	infixExpr, ok := firstStmt.Value.(*ast.InfixExpression)
+	logicalExpr, ok := firstStmt.Value.(*ast.LogicalExpression)
 	if !ok {
-		t.Fatalf("expected infix expression, got=%T", firstStmt.Value)
+		t.Fatalf("expected logical expression, got=%T", firstStmt.Value)
 	}
 
-	if infixExpr.Operator != "&&" {
-		t.Errorf("expected '&&' operator, got=%s", infixExpr.Operator)
+	if logicalExpr.Operator != "&&" {
+		t.Errorf("expected '&&' operator, got=%s", logicalExpr.Operator)
 	}
 
 	// Test logical OR
@@ -173,13 +196,24 @@ func TestLogicalExpressions(t *testing.T) {
 		t.Fatalf("expected *ast.VariableDeclaration, got=%T", program.Statements[1])
 	}
 
-	orInfixExpr, ok := secondStmt.Value.(*ast.InfixExpression)
+	orLogicalExpr, ok := secondStmt.Value.(*ast.LogicalExpression)
 	if !ok {
-		t.Fatalf("expected infix expression, got=%T", secondStmt.Value)
+		t.Fatalf("expected logical expression, got=%T", secondStmt.Value)
 	}
 
-	if orInfixExpr.Operator != "||" {
-		t.Errorf("expected '||' operator, got=%s", orInfixExpr.Operator)
+	if orLogicalExpr.Operator != "||" {
+		t.Errorf("expected '||' operator, got=%s", orLogicalExpr.Operator)
+	}
+
+	// Test alternate spelling
+	thirdStmt, ok := program.Statements[2].(*ast.VariableDeclaration)
+	if !ok {
+		t.Fatalf("expected *ast.VariableDeclaration, got=%T", program.Statements[2])
+	}
+
+	andLogicalExpr, ok := thirdStmt.Value.(*ast.LogicalExpression)
+	if !ok || andLogicalExpr.Operator != "&&" {
+		t.Errorf("expected '&&' logical expression, got=%T (%v)", thirdStmt.Value, thirdStmt.Value)
 	}
 }
 
@@ -218,6 +252,17 @@ func TestGroupedExpression(t *testing.T) {
 		}
 	}
 
+	// helper for logical
+	checkLogicalExpression := func(stmt ast.Statement, expected string) {
+		decl, ok := stmt.(*ast.VariableDeclaration)
+		if !ok {
+			t.Fatalf("expected *ast.VariableDeclaration, got=%T", stmt)
+		}
+		if _, ok := decl.Value.(*ast.LogicalExpression); !ok {
+			t.Errorf("expected logical expression for %s, got=%T", expected, decl.Value)
+		}
+	}
+
 	// helper for prefix
 	checkPrefixExpression := func(stmt ast.Statement, expected string) {
 		decl, ok := stmt.(*ast.VariableDeclaration)
@@ -230,14 +275,564 @@ func TestGroupedExpression(t *testing.T) {
 	}
 
 	checkInfixExpression(program.Statements[0], "(x + y)")
-	checkInfixExpression(program.Statements[1], "(x and y)")
+	checkLogicalExpression(program.Statements[1], "(x and y)")
 	checkInfixExpression(program.Statements[2], "((x + y) * 2)")
-	checkInfixExpression(program.Statements[3], "(x + y) and (a * b)")
+	checkLogicalExpression(program.Statements[3], "(x + y) and (a * b)")
 	checkInfixExpression(program.Statements[4], "(b + c) * d")
 	checkInfixExpression(program.Statements[5], "(b + c) * d")
 	checkInfixExpression(program.Statements[6], "x * (y + 2)")
-	checkInfixExpression(program.Statements[7], "(a + b) and (c * d)")
+	checkLogicalExpression(program.Statements[7], "(a + b) and (c * d)")
 	checkPrefixExpression(program.Statements[8], "not x")
 	checkPrefixExpression(program.Statements[9], "!x")
 	checkPrefixExpression(program.Statements[10], "not (x + y)")
 }
+
+// a group is an ordinary operand, calls and indexes after it bind to the group
+func TestGroupedOperandsTakePostfixOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"echo 1 + (a)[0];", "echo (1 + (a[0]));"},
+		{"echo 10 - (f)(1);", "echo (10 - f(1));"},
+		{"echo (a) || (b)[0];", "echo (a || (b[0]));"},
+		{"echo -(a)[0];", "echo (-(a[0]));"},
+		{"echo 1 + (2) * 3;", "echo (1 + (2 * 3));"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) > 0 {
+			t.Fatalf("%q: parser errors %v", tt.input, p.Errors())
+		}
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%q: expected %q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestFunctionLiteralParsing(t *testing.T) {
+	input := `sprout add = fn(x, y) { return x + y; };`
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+
+	if len(p.Errors()) > 0 {
+		t.Fatalf("unexpected parser errors: %v", p.Errors())
+	}
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("expected 1 statement, got=%d", len(program.Statements))
+	}
+
+	decl, ok := program.Statements[0].(*ast.VariableDeclaration)
+	if !ok {
+		t.Fatalf("expected *ast.VariableDeclaration, got=%T", program.Statements[0])
+	}
+
+	function, ok := decl.Value.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("expected *ast.FunctionLiteral, got=%T", decl.Value)
+	}
+
+	if len(function.Parameters) != 2 {
+		t.Fatalf("expected 2 parameters, got=%d", len(function.Parameters))
+	}
+	if function.Parameters[0].Value != "x" || function.Parameters[1].Value != "y" {
+		t.Errorf("wrong parameters, got=%v", function.Parameters)
+	}
+
+	if len(function.Body.Statements) != 1 {
+		t.Fatalf("expected 1 body statement, got=%d", len(function.Body.Statements))
+	}
+	if _, ok := function.Body.Statements[0].(*ast.ReturnStatement); !ok {
+		t.Errorf("expected *ast.ReturnStatement, got=%T", function.Body.Statements[0])
+	}
+}
+
+func TestCallExpressionParsing(t *testing.T) {
+	input := `add(1, 2 * 3, 4 + 5);`
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("expected 1 statement, got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("expected *ast.ExpressionStatement, got=%T", program.Statements[0])
+	}
+
+	call, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("expected *ast.CallExpression, got=%T", stmt.Expression)
+	}
+
+	if ident, ok := call.Function.(*ast.Identifier); !ok || ident.Value != "add" {
+		t.Errorf("expected function identifier 'add', got=%v", call.Function)
+	}
+
+	if len(call.Arguments) != 3 {
+		t.Fatalf("expected 3 arguments, got=%d", len(call.Arguments))
+	}
+
+	if call.String() != "add(1, (2 * 3), (4 + 5))" {
+		t.Errorf("wrong call string, got=%s", call.String())
+	}
+}
+
+func TestWhileParsing(t *testing.T) {
+	input := `
+	while (x < 10) {
+		x = x + 1;
+		if (x == 5) { break; }
+	}
+	`
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+
+	if len(p.Errors()) > 0 {
+		t.Fatalf("unexpected parser errors: %v", p.Errors())
+	}
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("expected 1 statement, got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("expected *ast.WhileStatement, got=%T", program.Statements[0])
+	}
+
+	if _, ok := stmt.Condition.(*ast.InfixExpression); !ok {
+		t.Errorf("expected infix condition, got=%T", stmt.Condition)
+	}
+
+	if len(stmt.Body.Statements) != 2 {
+		t.Errorf("expected 2 statements in body, got=%d", len(stmt.Body.Statements))
+	}
+}
+
+func TestForParsing(t *testing.T) {
+	tests := []struct {
+		input       string
+		hasInit     bool
+		hasCond     bool
+		hasPost     bool
+		bodyStmtLen int
+	}{
+		{"for (sprout i = 0; i < 10; i = i + 1) { echo i; continue; }", true, true, true, 2},
+		{"for (; i < 10;) { }", false, true, false, 0},
+		{"for (;;) { break; }", false, false, false, 1},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+
+		if len(p.Errors()) > 0 {
+			t.Fatalf("unexpected parser errors for %q: %v", tt.input, p.Errors())
+		}
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("expected 1 statement, got=%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("expected *ast.ForStatement, got=%T", program.Statements[0])
+		}
+
+		if (stmt.Init != nil) != tt.hasInit {
+			t.Errorf("%q: init presence wrong, got=%v", tt.input, stmt.Init)
+		}
+		if (stmt.Condition != nil) != tt.hasCond {
+			t.Errorf("%q: condition presence wrong, got=%v", tt.input, stmt.Condition)
+		}
+		if (stmt.Post != nil) != tt.hasPost {
+			t.Errorf("%q: post presence wrong, got=%v", tt.input, stmt.Post)
+		}
+		if len(stmt.Body.Statements) != tt.bodyStmtLen {
+			t.Errorf("%q: expected %d body statements, got=%d",
+				tt.input, tt.bodyStmtLen, len(stmt.Body.Statements))
+		}
+	}
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []string{
+		"break;",
+		"if (true) { continue; }",
+		"while (true) { sprout f = fn() { break; }; }",
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) != 1 {
+			t.Errorf("expected 1 error for %q, got=%v", input, p.Errors())
+		}
+	}
+}
+
+func TestArrayAndIndexParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2 * 2, 3 + 3]", "[1, (2 * 2), (3 + 3)]"},
+		{"[]", "[]"},
+		{"a[1 + 1]", "(a[(1 + 1)])"},
+		{"a[-1]", "(a[(-1)])"},
+		{"a[1:3]", "(a[1:3])"},
+		{"a[:2]", "(a[:2])"},
+		{"a[1:]", "(a[1:])"},
+		{"a[:]", "(a[:])"},
+		{"a * [1, 2][0]", "(a * ([1, 2][0]))"},
+		{"f(x)[0]", "(f(x)[0])"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		if len(p.Errors()) > 0 {
+			t.Fatalf("unexpected parser errors for %q: %v", tt.input, p.Errors())
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("expected 1 statement for %q, got=%d", tt.input, len(program.Statements))
+		}
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestIndexAssignmentParsing(t *testing.T) {
+	input := `a[0] = 5;`
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("expected 1 statement, got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.IndexAssignment)
+	if !ok {
+		t.Fatalf("expected *ast.IndexAssignment, got=%T", program.Statements[0])
+	}
+
+	if stmt.Target.Left.String() != "a" || stmt.Target.Index.String() != "0" {
+		t.Errorf("wrong target, got=%s", stmt.Target.String())
+	}
+
+	if literal, ok := stmt.Value.(*ast.IntegerLiteral); !ok || literal.Value != 5 {
+		t.Errorf("expected value 5, got=%v", stmt.Value)
+	}
+}
+
+func TestHashLiteralParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`sprout m = {"one": 1, "two": 1 + 1, 3: true};`, `sprout m = {"one": 1, "two": (1 + 1), 3: true};`},
+		{`sprout m = {};`, `sprout m = {};`},
+		{`m["one"] = 2;`, `(m["one"]) = 2;`},
+		{`delete m["one"];`, `delete (m["one"]);`},
+		{`{ sprout x = 1; }`, `{ sprout x = 1; }`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		if len(p.Errors()) > 0 {
+			t.Fatalf("unexpected parser errors for %q: %v", tt.input, p.Errors())
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("expected 1 statement for %q, got=%d", tt.input, len(program.Statements))
+		}
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	l := lexer.New(`{ sprout x = 1; }`)
+	program := New(l).ParseProgram()
+	if _, ok := program.Statements[0].(*ast.BlockStatement); !ok {
+		t.Errorf("expected statement-level brace to be *ast.BlockStatement, got=%T", program.Statements[0])
+	}
+}
+
+func TestConstDeclarationParsing(t *testing.T) {
+	input := `const rate float = 0.2;`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) > 0 {
+		t.Fatalf("unexpected parser errors: %v", p.Errors())
+	}
+
+	stmt, ok := program.Statements[0].(*ast.VariableDeclaration)
+	if !ok {
+		t.Fatalf("expected *ast.VariableDeclaration, got=%T", program.Statements[0])
+	}
+	if !stmt.IsConstant() || stmt.IsAssignment() {
+		t.Errorf("expected constant declaration, got=%s", stmt.String())
+	}
+	if stmt.String() != "const rate float = 0.200000;" {
+		t.Errorf("wrong string, got=%s", stmt.String())
+	}
+}
+
+func TestConstReassignmentErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"const x = 1;\nx = 2;", []string{"[Line 2:1] cannot assign to constant x"}},
+		{"const x = 1;\nif (true) { x = 2; }", []string{"[Line 2:13] cannot assign to constant x"}},
+		{"const x = 1;\nsprout x = 2;", []string{"[Line 2:8] cannot redeclare constant x"}},
+		{"const x = 1;\nsprout f = fn() { x = 2; };", []string{"[Line 2:19] cannot assign to constant x"}},
+		// shadowing hides the constant
+		{"const x = 1;\nif (true) { sprout x = 2; x = 3; }", nil},
+		{"const x = 1;\nsprout f = fn(x) { x = 2; };", nil},
+		{"const x = 1;\nfor (sprout x = 0; x < 2; x = x + 1) { }", nil},
+		// not visible from here, left to the evaluator
+		{"sprout f = fn() { x = 2; };\nconst x = 1;", nil},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) != len(tt.expected) {
+			t.Errorf("%q: expected errors %v, got=%v", tt.input, tt.expected, p.Errors())
+			continue
+		}
+		for i, err := range p.Errors() {
+			if err != tt.expected[i] {
+				t.Errorf("%q: expected error %q, got=%q", tt.input, tt.expected[i], err)
+			}
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+		parsed   string // statements kept after recovery
+	}{
+		{
+			"sprout = 5;\necho 1;\nsprout y 3;\necho 2;",
+			[]string{
+				"[Line 1:8] Expected next token to be IDENT, got = instead",
+				"[Line 3:10] Expected next token to be =, got INT instead",
+			},
+			"echo 1;echo 2;",
+		},
+		{"if (x { echo 1; }\necho 2;", []string{"[Line 1:7] Expected next token to be ), got { instead"}, "echo 2;"},
+		{
+			"if (x) { sprout = 1; }\necho 3 +;",
+			[]string{
+				"[Line 1:17] Expected next token to be IDENT, got = instead",
+				"[Line 2:9] no prefix parse function for ;",
+			},
+			"if (x) {  }",
+		},
+		{"{ echo }\necho 1;", []string{"[Line 1:8] no prefix parse function for }"}, "{  }echo 1;"},
+		{"sprout f = fn(a { return a; };\necho f(1);", []string{"[Line 1:17] Expected next token to be ), got { instead"}, "echo f(1);"},
+		{"for (sprout i = 0; i < 3 i = i + 1) { echo i; }\necho 4;", []string{"[Line 1:26] Expected next token to be ;, got IDENT instead"}, "echo 4;"},
+		{"for (sprout; i < 3; i = i + 1) { echo i; }\necho 5;", []string{"[Line 1:12] Expected next token to be IDENT, got ; instead"}, "echo 5;"},
+		{"for (sprout i = 0; i < 3; sprout) { echo i; }\necho 6;", []string{"[Line 1:33] Expected next token to be IDENT, got ) instead"}, "echo 6;"},
+		{"if (a[] > 1) { echo 1; }\necho 7;", []string{"[Line 1:7] no prefix parse function for ]"}, "echo 7;"},
+		{"echo 1 + a[] * 2;\necho 8;", []string{"[Line 1:12] no prefix parse function for ]"}, "echo 8;"},
+		{"sprout a = [1, 2;\nsprout b = 3;", []string{"[Line 1:17] Expected next token to be ], got ; instead"}, "sprout b = 3;"},
+		{"sprout m = {\"a\" 1};\necho m;", []string{"[Line 1:17] Expected next token to be :, got INT instead"}, "echo m;"},
+		{"if (true) {\necho 1;", []string{"[Line 2:8] Expected next token to be }, got EOF instead"}, ""},
+		{
+			"sprout x = 1 +;\nsprout y = * 2;\necho )",
+			[]string{
+				"[Line 1:15] no prefix parse function for ;",
+				"[Line 2:12] no prefix parse function for *",
+				"[Line 3:6] no prefix parse function for )",
+			},
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+
+		if len(p.Errors()) != len(tt.expected) {
+			t.Errorf("%q: expected errors %v, got=%v", tt.input, tt.expected, p.Errors())
+			continue
+		}
+		for i, err := range p.Errors() {
+			if err != tt.expected[i] {
+				t.Errorf("%q: expected error %q, got=%q", tt.input, tt.expected[i], err)
+			}
+		}
+
+		for _, stmt := range program.Statements {
+			if stmt == nil || reflect.ValueOf(stmt).IsNil() {
+				t.Fatalf("%q: nil statement in program", tt.input)
+			}
+		}
+		if program.String() != tt.parsed {
+			t.Errorf("%q: expected statements %q, got=%q", tt.input, tt.parsed, program.String())
+		}
+	}
+}
+
+// an operand that fails to parse ends the expression instead of becoming the
+// nil left side of an operator
+func TestFailedOperandsEndTheExpression(t *testing.T) {
+	for _, input := range []string{"a[] > 1", "a[] * 2 + 1", "a[](1)", "a[][0]", "(]) && b"} {
+		p := New(lexer.New(input))
+		if expr := p.parseExpression(LOWEST); expr != nil {
+			t.Errorf("%q: expected no expression, got %s", input, expr)
+		}
+		if len(p.Errors()) != 1 {
+			t.Errorf("%q: expected one error, got=%v", input, p.Errors())
+		}
+	}
+}
+
+func TestDiagnosticCodes(t *testing.T) {
+	tests := []struct {
+		input string
+		code  string
+	}{
+		{"sprout = 1;", EXPECTED_TOKEN},
+		{"echo );", NO_PREFIX_PARSE_FN},
+		{"if (true) {", UNCLOSED_BLOCK},
+		{"const x = 1;\nx = 2;", CONST_ASSIGNED},
+		{"const x = 1;\nconst x = 2;", CONST_REDECLARED},
+		{"break;", LOOP_CONTROL_OUTSIDE_LOOP},
+		{"delete x;", INVALID_DELETE_TARGET},
+		{"99999999999999999999;", INVALID_NUMBER},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		diagnostics := p.Diagnostics()
+		if len(diagnostics) != 1 {
+			t.Errorf("%q: expected 1 diagnostic, got=%v", tt.input, p.Errors())
+			continue
+		}
+		if diagnostics[0].Code != tt.code {
+			t.Errorf("%q: expected code %s, got=%s", tt.input, tt.code, diagnostics[0].Code)
+		}
+		if diagnostics[0].String() != p.Errors()[0] {
+			t.Errorf("%q: diagnostic %q does not match error %q", tt.input, diagnostics[0].String(), p.Errors()[0])
+		}
+	}
+}
+
+// every node covers exactly its own source text, without the trailing semicolon
+func TestNodeSpans(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"sprout x int = 1 + 2;", "sprout x int = 1 + 2"},
+		{"x = -y;", "x = -y"},
+		{"  a && b == c;", "a && b == c"},
+		{`echo "hi";`, `echo "hi"`},
+		{"add(1, f(2));", "add(1, f(2))"},
+		{"add();", "add()"},
+		{"[1, [2]];", "[1, [2]]"},
+		{"a[1:];", "a[1:]"},
+		{"a[i][j] = 3;", "a[i][j] = 3"},
+		{`({"k": {}});`, `{"k": {}}`},
+		{"delete m[\"k\"];", "delete m[\"k\"]"},
+		{"if (x) { 1 } else {\n  2\n}", "if (x) { 1 } else {\n  2\n}"},
+		{"while (x) { x = x - 1; }", "while (x) { x = x - 1; }"},
+		{"fn(a) {\n  return;\n}", "fn(a) {\n  return;\n}"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		stmt := program.Statements[0]
+		if got := tt.input[stmt.Pos().Offset:stmt.End().Offset]; got != tt.expected {
+			t.Errorf("%q: expected span %q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	program := parse(t, "sprout a = 1;\n  echo a * 2;")
+	echo := program.Statements[1].(*ast.PrintStatement)
+	if pos, end := echo.Value.Pos(), echo.Value.End(); pos.Line != 2 || pos.Column != 8 || end.Column != 13 {
+		t.Errorf("wrong expression span, got=%+v-%+v", pos, end)
+	}
+	if pos, end := program.Pos(), program.End(); pos.Offset != 0 || end.Offset != 26 {
+		t.Errorf("wrong program span, got=%+v-%+v", pos, end)
+	}
+}
+
+// nodes a parse error left without some of their children fall back to
+// their own token
+func TestPartialNodeSpans(t *testing.T) {
+	op := token.Token{Type: token.PLUS, Literal: "+", Line: 1, Column: 3, Offset: 2, EndLine: 1, EndColumn: 4, EndOffset: 3}
+	nodes := []ast.Node{
+		&ast.InfixExpression{Token: op},
+		&ast.LogicalExpression{Token: op},
+		&ast.PrefixExpression{Token: op},
+		&ast.IndexExpression{Token: op},
+		&ast.SliceExpression{Token: op},
+		&ast.CallExpression{Token: op, Arguments: []ast.Expression{nil}},
+		&ast.ArrayLiteral{Token: op, Elements: []ast.Expression{nil}},
+		&ast.HashLiteral{Token: op, Keys: []ast.Expression{nil}, Values: []ast.Expression{nil}},
+		&ast.FunctionLiteral{Token: op},
+		&ast.IfExpression{Token: op},
+		&ast.WhileStatement{Token: op},
+		&ast.ForStatement{Token: op},
+		&ast.PrintStatement{Token: op},
+		&ast.IndexAssignment{Token: op},
+		&ast.DeleteStatement{Token: op},
+		&ast.VariableDeclaration{Token: op},
+	}
+
+	for _, node := range nodes {
+		if pos, end := node.Pos(), node.End(); pos.Offset != 2 || end.Offset != 3 {
+			t.Errorf("%T: expected the span of its token, got=%+v-%+v", node, pos, end)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
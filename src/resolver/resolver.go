@@ -0,0 +1,318 @@
+package resolver
+
+import (
+	"lexicon/src/ast"
+	"lexicon/src/diagnostic"
+	"lexicon/src/token"
+	"sort"
+)
+
+// variable declared in a scope, index is its slot in the runtime environment
+type variable struct {
+	name     string
+	index    int
+	tok      token.Token // first declaration
+	declared bool        // the walk has reached its declaration
+	used     bool        // read at least once
+	report   bool        // warn when unused, false for parameters and existing globals
+}
+
+// static mirror of one runtime environment
+type scope struct {
+	vars     map[string]*variable
+	order    []*variable
+	function int // function nesting level the scope belongs to
+}
+
+// codes of the warnings the resolver reports
+const (
+	UNUSED_VARIABLE        = "UNUSED_VARIABLE"
+	USE_BEFORE_DECLARATION = "USE_BEFORE_DECLARATION"
+)
+
+// Resolver assigns each identifier the slot of the binding it refers to, using
+// the same scopes the evaluator creates: the program, every block, every
+// function call and the init clause of a for loop. Identifiers that can only
+// be bound at runtime, such as builtins, are left unresolved.
+type Resolver struct {
+	scopes   []*scope
+	function int
+	warnings []diagnostic.Diagnostic
+
+	// declaring token of every identifier bound to a variable of the program
+	definitions map[*ast.Identifier]token.Token
+}
+
+// creates a resolver for a program run in an environment that already holds
+// globals, in slot order
+func New(globals ...string) *Resolver {
+	r := &Resolver{definitions: make(map[*ast.Identifier]token.Token)}
+	root := r.openScope()
+	for _, name := range globals {
+		v := r.declareIn(root, name, token.Token{})
+		v.declared = true
+	}
+	return r
+}
+
+// resolves a program run in a fresh environment, or one holding globals,
+// and returns its warnings
+func Resolve(program *ast.Program, globals []string) []string {
+	return New(globals...).Resolve(program)
+}
+
+// annotates every identifier in program with its slot and returns warnings
+// for variables used before their declaration or never used
+func (r *Resolver) Resolve(program *ast.Program) []string {
+	root := r.scopes[0]
+	r.predeclare(root, program.Statements)
+	r.resolveStatements(program.Statements)
+	r.closeScope()
+	return r.Warnings()
+}
+
+// returns the token that declares the variable ident refers to, false for
+// builtins, globals of the environment and unknown names
+func (r *Resolver) Definition(ident *ast.Identifier) (token.Token, bool) {
+	tok, ok := r.definitions[ident]
+	return tok, ok
+}
+
+// returns the warnings sorted by position
+func (r *Resolver) Warnings() []string {
+	return diagnostic.Strings(r.Diagnostics())
+}
+
+// returns the warnings with their codes and spans, sorted by position
+func (r *Resolver) Diagnostics() []diagnostic.Diagnostic {
+	sort.SliceStable(r.warnings, func(i, j int) bool {
+		a, b := r.warnings[i].Span.Start, r.warnings[j].Span.Start
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return r.warnings
+}
+
+func (r *Resolver) resolveStatements(statements []ast.Statement) {
+	for _, stmt := range statements {
+		r.resolveStatement(stmt)
+	}
+}
+
+func (r *Resolver) resolveStatement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.VariableDeclaration:
+		r.resolveExpression(stmt.Value)
+		if stmt.Name == nil {
+			return
+		}
+		if stmt.IsAssignment() {
+			r.resolveIdentifier(stmt.Name, false)
+			return
+		}
+		// the value is evaluated before the name is bound
+		v := r.current().vars[stmt.Name.Value]
+		v.declared = true
+		stmt.Name.Slot = ast.Slot{Depth: 0, Index: v.index, Resolved: true}
+		if v.tok.Line > 0 {
+			r.definitions[stmt.Name] = v.tok
+		}
+
+	case *ast.PrintStatement:
+		r.resolveExpression(stmt.Value)
+
+	case *ast.ExpressionStatement:
+		r.resolveExpression(stmt.Expression)
+
+	case *ast.ReturnStatement:
+		r.resolveExpression(stmt.ReturnValue)
+
+	case *ast.IfExpression:
+		r.resolveExpression(stmt.Condition)
+		r.resolveBlock(stmt.Consequence)
+		r.resolveBlock(stmt.Alternative)
+
+	case *ast.BlockStatement:
+		r.resolveBlock(stmt)
+
+	case *ast.WhileStatement:
+		r.resolveExpression(stmt.Condition)
+		r.resolveBlock(stmt.Body)
+
+	case *ast.ForStatement:
+		// the init clause gets its own scope, shared by the condition and post
+		// statement, a declaration in either lives there
+		s := r.openScope()
+		r.predeclare(s, []ast.Statement{stmt.Init, stmt.Post})
+		if stmt.Init != nil {
+			r.resolveStatement(stmt.Init)
+		}
+		r.resolveExpression(stmt.Condition)
+		r.resolveBlock(stmt.Body)
+		if stmt.Post != nil {
+			r.resolveStatement(stmt.Post)
+		}
+		r.closeScope()
+
+	case *ast.IndexAssignment:
+		if stmt.Target != nil {
+			r.resolveExpression(stmt.Target)
+		}
+		r.resolveExpression(stmt.Value)
+
+	case *ast.DeleteStatement:
+		if stmt.Target != nil {
+			r.resolveExpression(stmt.Target)
+		}
+	}
+}
+
+func (r *Resolver) resolveBlock(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+	s := r.openScope()
+	r.predeclare(s, block.Statements)
+	r.resolveStatements(block.Statements)
+	r.closeScope()
+}
+
+func (r *Resolver) resolveExpression(expr ast.Expression) {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		r.resolveIdentifier(expr, true)
+
+	case *ast.PrefixExpression:
+		r.resolveExpression(expr.Right)
+
+	case *ast.InfixExpression:
+		r.resolveExpression(expr.Left)
+		r.resolveExpression(expr.Right)
+
+	case *ast.LogicalExpression:
+		r.resolveExpression(expr.Left)
+		r.resolveExpression(expr.Right)
+
+	case *ast.FunctionLiteral:
+		r.resolveFunction(expr)
+
+	case *ast.CallExpression:
+		r.resolveExpression(expr.Function)
+		for _, arg := range expr.Arguments {
+			r.resolveExpression(arg)
+		}
+
+	case *ast.ArrayLiteral:
+		for _, el := range expr.Elements {
+			r.resolveExpression(el)
+		}
+
+	case *ast.IndexExpression:
+		r.resolveExpression(expr.Left)
+		r.resolveExpression(expr.Index)
+
+	case *ast.SliceExpression:
+		r.resolveExpression(expr.Left)
+		r.resolveExpression(expr.Low)
+		r.resolveExpression(expr.High)
+
+	case *ast.HashLiteral:
+		for i, key := range expr.Keys {
+			r.resolveExpression(key)
+			r.resolveExpression(expr.Values[i])
+		}
+	}
+}
+
+// parameters and the body share one scope
+func (r *Resolver) resolveFunction(fn *ast.FunctionLiteral) {
+	r.function++
+	s := r.openScope()
+	for _, param := range fn.Parameters {
+		v := r.declareIn(s, param.Value, param.Token)
+		v.declared = true
+		v.report = false
+		param.Slot = ast.Slot{Depth: 0, Index: v.index, Resolved: true}
+		r.definitions[param] = v.tok
+	}
+	if fn.Body != nil {
+		r.predeclare(s, fn.Body.Statements)
+		r.resolveStatements(fn.Body.Statements)
+	}
+	r.closeScope()
+	r.function--
+}
+
+// binds ident to the nearest scope declaring its name anywhere. a binding
+// declared later in that scope is only found at runtime if it exists by then,
+// which the environment checks when it reads the slot
+func (r *Resolver) resolveIdentifier(ident *ast.Identifier, read bool) {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		s := r.scopes[i]
+		v, ok := s.vars[ident.Value]
+		if !ok {
+			continue
+		}
+
+		ident.Slot = ast.Slot{Depth: len(r.scopes) - 1 - i, Index: v.index, Resolved: true}
+		if v.tok.Line > 0 {
+			r.definitions[ident] = v.tok
+		}
+		if read {
+			v.used = true
+		}
+		// a closure may run after the declaration, a direct use cannot
+		if !v.declared && s.function == r.function {
+			r.warn(USE_BEFORE_DECLARATION, ident.Token, "%s used before declaration", ident.Value)
+		}
+		return
+	}
+	ident.Slot = ast.Slot{}
+}
+
+// declares the names a scope's own statements introduce, in slot order
+func (r *Resolver) predeclare(s *scope, statements []ast.Statement) {
+	for _, stmt := range statements {
+		if decl, ok := stmt.(*ast.VariableDeclaration); ok && decl != nil && decl.Name != nil && !decl.IsAssignment() {
+			r.declareIn(s, decl.Name.Value, decl.Name.Token)
+		}
+	}
+}
+
+// declares name in s, a redeclaration keeps the original slot
+func (r *Resolver) declareIn(s *scope, name string, tok token.Token) *variable {
+	if v, ok := s.vars[name]; ok {
+		return v
+	}
+	v := &variable{name: name, index: len(s.order), tok: tok, report: true}
+	s.vars[name] = v
+	s.order = append(s.order, v)
+	return v
+}
+
+func (r *Resolver) openScope() *scope {
+	s := &scope{vars: make(map[string]*variable), function: r.function}
+	r.scopes = append(r.scopes, s)
+	return s
+}
+
+// leaves the innermost scope, reporting the variables it never read
+func (r *Resolver) closeScope() {
+	s := r.current()
+	for _, v := range s.order {
+		if v.report && v.tok.Line > 0 && !v.used {
+			r.warn(UNUSED_VARIABLE, v.tok, "unused variable %s", v.name)
+		}
+	}
+	r.scopes = r.scopes[:len(r.scopes)-1]
+}
+
+func (r *Resolver) current() *scope {
+	return r.scopes[len(r.scopes)-1]
+}
+
+func (r *Resolver) warn(code string, tok token.Token, format string, args ...interface{}) {
+	r.warnings = append(r.warnings, diagnostic.New(diagnostic.Warning, code, tok, format, args...))
+}
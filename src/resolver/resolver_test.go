@@ -0,0 +1,229 @@
+package resolver
+
+import (
+	"bytes"
+	"fmt"
+	"lexicon/src/ast"
+	"lexicon/src/evaluator"
+	"lexicon/src/lexer"
+	"lexicon/src/parser"
+	"strings"
+	"testing"
+)
+
+func TestSlots(t *testing.T) {
+	program := parse(t, `sprout a = 1;
+sprout b = 2;
+sprout f = fn(x) {
+	sprout y = x + b;
+	{ sprout z = y; echo z + a; }
+	return y;
+};
+echo f(a);`)
+	Resolve(program, nil)
+
+	expected := map[string][]ast.Slot{
+		"a": {{Depth: 0, Index: 0, Resolved: true}, {Depth: 2, Index: 0, Resolved: true}, {Depth: 0, Index: 0, Resolved: true}},
+		"b": {{Depth: 0, Index: 1, Resolved: true}, {Depth: 1, Index: 1, Resolved: true}},
+		"f": {{Depth: 0, Index: 2, Resolved: true}, {Depth: 0, Index: 2, Resolved: true}},
+		"x": {{Depth: 0, Index: 0, Resolved: true}, {Depth: 0, Index: 0, Resolved: true}},
+		"y": {{Depth: 0, Index: 1, Resolved: true}, {Depth: 1, Index: 1, Resolved: true}, {Depth: 0, Index: 1, Resolved: true}},
+		"z": {{Depth: 0, Index: 0, Resolved: true}, {Depth: 0, Index: 0, Resolved: true}},
+	}
+
+	got := map[string][]ast.Slot{}
+	collect(program, func(ident *ast.Identifier) {
+		got[ident.Value] = append(got[ident.Value], ident.Slot)
+	})
+
+	for name, slots := range expected {
+		if len(got[name]) != len(slots) {
+			t.Errorf("%s: expected %d identifiers, got=%v", name, len(slots), got[name])
+			continue
+		}
+		for i, slot := range slots {
+			if got[name][i] != slot {
+				t.Errorf("%s #%d: expected slot %+v, got=%+v", name, i, slot, got[name][i])
+			}
+		}
+	}
+}
+
+func TestBuiltinsStayUnresolved(t *testing.T) {
+	program := parse(t, "echo len([1]);")
+	Resolve(program, nil)
+
+	collect(program, func(ident *ast.Identifier) {
+		if ident.Slot.Resolved {
+			t.Errorf("%s: expected an unresolved identifier, got=%+v", ident.Value, ident.Slot)
+		}
+	})
+}
+
+func TestDefinitions(t *testing.T) {
+	program := parse(t, `sprout x = 1;
+sprout f = fn(x) { return x; };
+x = f(x);
+echo len([x]);`)
+	r := New()
+	r.Resolve(program)
+
+	// line:column of the declaration each identifier refers to, in source order
+	expected := []string{"x 1:8", "f 2:8", "x 2:15", "x 2:15", "x 1:8", "f 2:8", "x 1:8", "len -", "x 1:8"}
+	var got []string
+	collect(program, func(ident *ast.Identifier) {
+		where := "-"
+		if tok, ok := r.Definition(ident); ok {
+			where = fmt.Sprintf("%d:%d", tok.Line, tok.Column)
+		}
+		got = append(got, ident.Value+" "+where)
+	})
+	if strings.Join(got, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("expected %v, got=%v", expected, got)
+	}
+}
+
+func TestGlobalsKeepTheirSlots(t *testing.T) {
+	program := parse(t, "sprout c = a + b;")
+	if warnings := Resolve(program, []string{"a", "b"}); len(warnings) != 1 {
+		t.Fatalf("expected only c to be unused, got=%v", warnings)
+	}
+
+	var slots []ast.Slot
+	collect(program, func(ident *ast.Identifier) {
+		slots = append(slots, ident.Slot)
+	})
+	expected := []ast.Slot{
+		{Depth: 0, Index: 2, Resolved: true},
+		{Depth: 0, Index: 0, Resolved: true},
+		{Depth: 0, Index: 1, Resolved: true},
+	}
+	for i, slot := range expected {
+		if slots[i] != slot {
+			t.Errorf("#%d: expected slot %+v, got=%+v", i, slot, slots[i])
+		}
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"sprout x = 1; echo x;", nil},
+		{"sprout x = 1;", []string{"[Line 1:8] unused variable x"}},
+		{"sprout f = fn(a, b) { return 1; }; f(1, 2);", nil},
+		{"echo y;\nsprout y = 1;", []string{"[Line 1:6] y used before declaration"}},
+		{"sprout f = fn() { return y; };\nsprout y = 1;\necho f();", nil},
+		{"{ sprout x = 1; }\nsprout x = 2; echo x;", []string{"[Line 1:10] unused variable x"}},
+		{"sprout x = 1; x = 2;", []string{"[Line 1:8] unused variable x"}},
+		{"for (sprout i = 0; i < 3; i = i + 1) { sprout j = i; }", []string{"[Line 1:47] unused variable j"}},
+		{"for (sprout i = 0; i < 2; sprout j = 1) { echo i; i = i + 1; }", []string{"[Line 1:34] unused variable j"}},
+		{
+			"sprout b = 1;\necho a;\nsprout a = 2;",
+			[]string{
+				"[Line 1:8] unused variable b",
+				"[Line 2:6] a used before declaration",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		warnings := Resolve(parse(t, tt.input), nil)
+
+		if len(warnings) != len(tt.expected) {
+			t.Errorf("%q: expected %d warnings, got=%v", tt.input, len(tt.expected), warnings)
+			continue
+		}
+		for i, w := range warnings {
+			if w != tt.expected[i] {
+				t.Errorf("%q: wrong warning. expected=%q, got=%q", tt.input, tt.expected[i], w)
+			}
+		}
+	}
+}
+
+// resolved programs must behave exactly like unresolved ones, including when
+// a slot is not filled yet at the time it is read
+func TestResolvedProgramsRunUnchanged(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"sprout y = 1; { sprout f = fn() { return y; }; echo f(); sprout y = 2; echo f(); }", "1\n2\n"},
+		{"sprout a = 1; sprout f = fn(n) { if (n == 0) { return a; } return f(n - 1) + 1; }; echo f(3);", "4\n"},
+		{"sprout make = fn(x) { return fn(y) { return x + y; }; }; sprout addtwo = make(2); echo addtwo(3);", "5\n"},
+		{"sprout s = 0; for (sprout i = 0; i < 4; i = i + 1) { s = s + i; } echo s;", "6\n"},
+		{"sprout x = 1; if (true) { sprout x = 2; echo x; } echo x;", "2\n1\n"},
+		{"for (sprout i = 0; i < 2; sprout j = 1) { echo i; i = i + 1; }", "0\n1\n"},
+		{"sprout a = 1; sprout b = 2; sprout c = 3; sprout d = 4; sprout e = 5; sprout f = 6; sprout g = 7; sprout h = 8; sprout i = 9; echo a + i;", "10\n"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		Resolve(program, nil)
+
+		var out bytes.Buffer
+		env := evaluator.NewEnvironment()
+		env.SetExecContext(evaluator.NewExecContext(&out, &out))
+		if result := evaluator.Eval(program, env); result != nil && result.Type() == evaluator.ERROR_OBJ {
+			t.Errorf("%q: unexpected error %s", tt.input, result.Inspect())
+			continue
+		}
+		if out.String() != tt.expected {
+			t.Errorf("%q: expected output %q, got=%q", tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors for %q: %s", input, strings.Join(p.Errors(), "; "))
+	}
+	return program
+}
+
+// visits the identifiers of a program in source order
+func collect(node ast.Node, visit func(*ast.Identifier)) {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			collect(s, visit)
+		}
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			collect(s, visit)
+		}
+	case *ast.VariableDeclaration:
+		visit(node.Name)
+		collect(node.Value, visit)
+	case *ast.PrintStatement:
+		collect(node.Value, visit)
+	case *ast.ExpressionStatement:
+		collect(node.Expression, visit)
+	case *ast.ReturnStatement:
+		collect(node.ReturnValue, visit)
+	case *ast.Identifier:
+		visit(node)
+	case *ast.InfixExpression:
+		collect(node.Left, visit)
+		collect(node.Right, visit)
+	case *ast.FunctionLiteral:
+		for _, p := range node.Parameters {
+			visit(p)
+		}
+		collect(node.Body, visit)
+	case *ast.CallExpression:
+		collect(node.Function, visit)
+		for _, a := range node.Arguments {
+			collect(a, visit)
+		}
+	case *ast.ArrayLiteral:
+		for _, e := range node.Elements {
+			collect(e, visit)
+		}
+	}
+}
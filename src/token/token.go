@@ -1,12 +1,46 @@
 package token
 
+import "sort"
+
 type TokenType string
 
+// Token is a lexeme with its place in the source. Line and Column locate the
+// first character, EndLine and EndColumn the position just past the last one,
+// so a token always covers [Pos, End)
 type Token struct {
-	Type    TokenType
-	Literal string
-	Line    int
-	Column  int
+	Type      TokenType
+	Literal   string
+	Line      int
+	Column    int
+	Offset    int // byte offset of the first character
+	EndLine   int
+	EndColumn int
+	EndOffset int
+}
+
+// Position is a place in the source, Line and Column are 1-based and Offset
+// counts bytes from the start of the input
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// reports whether the position was set, tokens made outside the lexer have none
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+// position of the token's first character
+func (t Token) Pos() Position {
+	return Position{Offset: t.Offset, Line: t.Line, Column: t.Column}
+}
+
+// position just past the token's last character
+func (t Token) End() Position {
+	if t.EndLine == 0 {
+		// no end recorded, assume the literal sits on one line
+		return Position{Offset: t.Offset + len(t.Literal), Line: t.Line, Column: t.Column + len([]rune(t.Literal))}
+	}
+	return Position{Offset: t.EndOffset, Line: t.EndLine, Column: t.EndColumn}
 }
 
 const (
@@ -63,14 +97,24 @@ const (
 	RPAREN    = ")"
 	LBRACE    = "{"
 	RBRACE    = "}"
+	LBRACKET  = "["
+	RBRACKET  = "]"
 	COLON     = ":"
 	DOT       = "."
 
 	// Keywords
-	ECHO   = "ECHO"
-	SPROUT = "SPROUT"
-	IF     = "IF"
-	ELSE   = "ELSE"
+	ECHO     = "ECHO"
+	SPROUT   = "SPROUT"
+	CONST    = "CONST"
+	IF       = "IF"
+	ELSE     = "ELSE"
+	FUNCTION = "FUNCTION"
+	RETURN   = "RETURN"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	DELETE   = "DELETE"
 
 	COMMENT = "COMMENT"
 )
@@ -78,10 +122,22 @@ const (
 var keywords = map[string]TokenType{
 	"echo":   ECHO,
 	"sprout": SPROUT,
+	"const":  CONST,
 
 	"if":   IF,
 	"else": ELSE,
 
+	"fn":     FUNCTION,
+	"func":   FUNCTION, // alternate for fn
+	"return": RETURN,
+
+	"while":    WHILE,
+	"for":      FOR,
+	"break":    BREAK,
+	"continue": CONTINUE,
+
+	"delete": DELETE,
+
 	"and": LOGICAL_AND, // alternate for &&
 	"or":  LOGICAL_OR,  // alternate for ||
 	"not": LOGICAL_NOT,
@@ -95,6 +151,17 @@ var keywords = map[string]TokenType{
 	"bool":   TYPE_IDENT,
 }
 
+// Keywords returns every reserved word in sorted order, for tools such as
+// completion in editors
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
+
 // To check if the identifier is a keyword or not
 func LookupIdent(ident string) TokenType {
 	if tok, ok := keywords[ident]; ok {
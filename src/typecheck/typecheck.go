@@ -0,0 +1,463 @@
+package typecheck
+
+import (
+	"lexicon/src/ast"
+	"lexicon/src/diagnostic"
+	"lexicon/src/token"
+)
+
+// statically inferred type of an expression
+type Type string
+
+const (
+	UNKNOWN  Type = "unknown" // not provable, any value is accepted
+	INT      Type = "int"
+	FLOAT    Type = "float"
+	STRING   Type = "string"
+	BOOL     Type = "bool"
+	NULL     Type = "null"
+	ARRAY    Type = "array"
+	HASH     Type = "hash"
+	FUNCTION Type = "function"
+)
+
+// Checker walks a parsed program and reports the type errors it can prove
+// before the program runs. Anything it cannot prove is left to the evaluator.
+type Checker struct {
+	errors []diagnostic.Diagnostic
+	types  map[ast.Expression]Type
+
+	// declaration facts gathered before checking, keyed by variable name
+	declarations map[string]int  // number of declaration sites
+	annotations  map[string]Type // declared type of singly declared names
+	reassigned   map[string]bool // names that are the target of x = v
+	inferred     map[string]Type // initializer type of stable untyped names
+}
+
+func New() *Checker {
+	return &Checker{
+		errors:       []diagnostic.Diagnostic{},
+		types:        make(map[ast.Expression]Type),
+		declarations: make(map[string]int),
+		annotations:  make(map[string]Type),
+		reassigned:   make(map[string]bool),
+		inferred:     make(map[string]Type),
+	}
+}
+
+// Check type checks program and returns every error found
+func Check(program *ast.Program) []string {
+	c := New()
+	c.Check(program)
+	return c.Errors()
+}
+
+// Check type checks program, errors are available through Errors
+func (c *Checker) Check(program *ast.Program) {
+	c.collect(program)
+	c.check(program)
+}
+
+// Errors returns the list of type errors
+func (c *Checker) Errors() []string {
+	return diagnostic.Strings(c.errors)
+}
+
+// Diagnostics returns the type errors with their codes and spans
+func (c *Checker) Diagnostics() []diagnostic.Diagnostic {
+	return c.errors
+}
+
+// TypeOf returns the inferred type of an expression seen during Check
+func (c *Checker) TypeOf(expr ast.Expression) Type {
+	if typ, ok := c.types[expr]; ok {
+		return typ
+	}
+	return UNKNOWN
+}
+
+// VariableType returns the type proven for a variable, UNKNOWN when it is
+// declared more than once or reassigned without a declared type
+func (c *Checker) VariableType(name string) Type {
+	return c.variableType(name)
+}
+
+// codes of the errors the checker reports
+const (
+	TYPE_MISMATCH    = "TYPE_MISMATCH"
+	UNKNOWN_OPERATOR = "UNKNOWN_OPERATOR"
+	UNHASHABLE_KEY   = "UNHASHABLE_KEY"
+	NOT_A_FUNCTION   = "NOT_A_FUNCTION"
+	INVALID_INDEX    = "INVALID_INDEX"
+	INVALID_SLICE    = "INVALID_SLICE"
+)
+
+// addError adds an error at tok
+func (c *Checker) addError(code string, tok token.Token, format string, args ...interface{}) {
+	c.errors = append(c.errors, diagnostic.New(diagnostic.Error, code, tok, format, args...))
+}
+
+// collect records how every name is declared and assigned. Variables are tracked
+// by name across the whole program, so a name is only given a static type when
+// it has a single declaration site and cannot change type afterwards.
+func (c *Checker) collect(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			c.collect(s)
+		}
+	case *ast.BlockStatement:
+		if node == nil {
+			return
+		}
+		for _, s := range node.Statements {
+			c.collect(s)
+		}
+	case *ast.VariableDeclaration:
+		if node.Name == nil {
+			c.collect(node.Value)
+			return
+		}
+		if !node.IsAssignment() {
+			c.declarations[node.Name.Value]++
+			if node.Type != nil {
+				c.annotations[node.Name.Value] = Type(node.Type.Value)
+			}
+		} else {
+			c.reassigned[node.Name.Value] = true
+		}
+		c.collect(node.Value)
+	case *ast.PrintStatement:
+		c.collect(node.Value)
+	case *ast.ExpressionStatement:
+		c.collect(node.Expression)
+	case *ast.ReturnStatement:
+		c.collect(node.ReturnValue)
+	case *ast.IfExpression:
+		c.collect(node.Condition)
+		c.collect(node.Consequence)
+		c.collect(node.Alternative)
+	case *ast.WhileStatement:
+		c.collect(node.Condition)
+		c.collect(node.Body)
+	case *ast.ForStatement:
+		c.collect(node.Init)
+		c.collect(node.Condition)
+		c.collect(node.Post)
+		c.collect(node.Body)
+	case *ast.IndexAssignment:
+		if node.Target != nil {
+			c.collect(node.Target)
+		}
+		c.collect(node.Value)
+	case *ast.FunctionLiteral:
+		for _, param := range node.Parameters {
+			c.declarations[param.Value]++
+		}
+		c.collect(node.Body)
+	case *ast.CallExpression:
+		c.collect(node.Function)
+		for _, arg := range node.Arguments {
+			c.collect(arg)
+		}
+	case *ast.PrefixExpression:
+		c.collect(node.Right)
+	case *ast.InfixExpression:
+		c.collect(node.Left)
+		c.collect(node.Right)
+	case *ast.LogicalExpression:
+		c.collect(node.Left)
+		c.collect(node.Right)
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			c.collect(el)
+		}
+	case *ast.HashLiteral:
+		for i := range node.Keys {
+			c.collect(node.Keys[i])
+			c.collect(node.Values[i])
+		}
+	case *ast.IndexExpression:
+		c.collect(node.Left)
+		c.collect(node.Index)
+	case *ast.SliceExpression:
+		c.collect(node.Left)
+		c.collect(node.Low)
+		c.collect(node.High)
+	}
+}
+
+// check walks statements in order, inferring expression types as it goes
+func (c *Checker) check(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			c.check(s)
+		}
+	case *ast.BlockStatement:
+		if node == nil {
+			return
+		}
+		for _, s := range node.Statements {
+			c.check(s)
+		}
+	case *ast.VariableDeclaration:
+		c.checkVariableDeclaration(node)
+	case *ast.PrintStatement:
+		c.infer(node.Value)
+	case *ast.ExpressionStatement:
+		c.infer(node.Expression)
+	case *ast.ReturnStatement:
+		c.infer(node.ReturnValue)
+	case *ast.IfExpression:
+		c.infer(node.Condition)
+		c.check(node.Consequence)
+		c.check(node.Alternative)
+	case *ast.WhileStatement:
+		c.infer(node.Condition)
+		c.check(node.Body)
+	case *ast.ForStatement:
+		if node.Init != nil {
+			c.check(node.Init)
+		}
+		c.infer(node.Condition)
+		if node.Post != nil {
+			c.check(node.Post)
+		}
+		c.check(node.Body)
+	case *ast.IndexAssignment:
+		if node.Target != nil {
+			c.checkIndex(c.infer(node.Target.Left), c.infer(node.Target.Index), node.Target.Token)
+		}
+		c.infer(node.Value)
+	case *ast.DeleteStatement:
+		if node.Target != nil {
+			c.infer(node.Target.Left)
+			c.infer(node.Target.Index)
+		}
+	}
+}
+
+func (c *Checker) checkVariableDeclaration(node *ast.VariableDeclaration) {
+	if node.Name == nil {
+		c.infer(node.Value)
+		return
+	}
+	name := node.Name.Value
+	valueType := c.infer(node.Value)
+
+	var declared Type
+	if !node.IsAssignment() {
+		if node.Type != nil {
+			declared = Type(node.Type.Value)
+		}
+	} else if c.declarations[name] == 1 {
+		declared = c.annotations[name]
+	}
+
+	if declared != "" && !assignable(declared, valueType) {
+		c.addError(TYPE_MISMATCH, node.Name.Token, "type mismatch: cannot assign %s to %s variable %s",
+			valueType, declared, name)
+	}
+
+	if !node.IsAssignment() && declared == "" {
+		c.inferred[name] = valueType
+	}
+}
+
+// infer returns the type of an expression and reports errors found inside it
+func (c *Checker) infer(expr ast.Expression) Type {
+	if expr == nil {
+		return UNKNOWN
+	}
+	typ := c.inferExpression(expr)
+	c.types[expr] = typ
+	return typ
+}
+
+func (c *Checker) inferExpression(expr ast.Expression) Type {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral:
+		return INT
+	case *ast.FloatLiteral:
+		return FLOAT
+	case *ast.StringLiteral:
+		return STRING
+	case *ast.BooleanLiteral:
+		return BOOL
+	case *ast.Identifier:
+		return c.variableType(expr.Value)
+	case *ast.ArrayLiteral:
+		for _, el := range expr.Elements {
+			c.infer(el)
+		}
+		return ARRAY
+	case *ast.HashLiteral:
+		for i, key := range expr.Keys {
+			if keyType := c.infer(key); !hashable(keyType) {
+				c.addError(UNHASHABLE_KEY, expr.Token, "unusable as hash key: %s", keyType)
+			}
+			c.infer(expr.Values[i])
+		}
+		return HASH
+	case *ast.FunctionLiteral:
+		c.check(expr.Body)
+		return FUNCTION
+	case *ast.CallExpression:
+		fnType := c.infer(expr.Function)
+		for _, arg := range expr.Arguments {
+			c.infer(arg)
+		}
+		if fnType != UNKNOWN && fnType != FUNCTION {
+			c.addError(NOT_A_FUNCTION, expr.Token, "not a function: %s", fnType)
+		}
+		return UNKNOWN
+	case *ast.IndexExpression:
+		c.checkIndex(c.infer(expr.Left), c.infer(expr.Index), expr.Token)
+		return UNKNOWN
+	case *ast.SliceExpression:
+		left := c.infer(expr.Left)
+		for _, bound := range []ast.Expression{expr.Low, expr.High} {
+			if boundType := c.infer(bound); boundType != UNKNOWN && boundType != INT {
+				c.addError(INVALID_SLICE, expr.Token, "slice bound must be int, got %s", boundType)
+			}
+		}
+		if left != UNKNOWN && left != ARRAY {
+			c.addError(INVALID_SLICE, expr.Token, "slice operator not supported: %s", left)
+			return UNKNOWN
+		}
+		return left
+	case *ast.PrefixExpression:
+		return c.inferPrefix(expr)
+	case *ast.InfixExpression:
+		return c.inferInfix(expr)
+	case *ast.LogicalExpression:
+		c.infer(expr.Left)
+		c.infer(expr.Right)
+		return BOOL
+	}
+	return UNKNOWN
+}
+
+// type of a variable reference, only stable names have a known type
+func (c *Checker) variableType(name string) Type {
+	if c.declarations[name] != 1 {
+		return UNKNOWN
+	}
+	if declared, ok := c.annotations[name]; ok {
+		return declared
+	}
+	if c.reassigned[name] {
+		return UNKNOWN
+	}
+	if typ, ok := c.inferred[name]; ok {
+		return typ
+	}
+	return UNKNOWN
+}
+
+func (c *Checker) checkIndex(left, index Type, tok token.Token) {
+	switch left {
+	case UNKNOWN:
+	case ARRAY:
+		if index != UNKNOWN && index != INT {
+			c.addError(INVALID_INDEX, tok, "array index must be int, got %s", index)
+		}
+	case HASH:
+		if !hashable(index) {
+			c.addError(UNHASHABLE_KEY, tok, "unusable as hash key: %s", index)
+		}
+	default:
+		c.addError(INVALID_INDEX, tok, "index operator not supported: %s", left)
+	}
+}
+
+func (c *Checker) inferPrefix(expr *ast.PrefixExpression) Type {
+	right := c.infer(expr.Right)
+
+	switch expr.Operator {
+	case "!":
+		return BOOL
+	case "-":
+		if right == UNKNOWN || isNumeric(right) {
+			return right
+		}
+		c.addError(UNKNOWN_OPERATOR, expr.Token, "unknown operator: -%s", right)
+	}
+	return UNKNOWN
+}
+
+func (c *Checker) inferInfix(expr *ast.InfixExpression) Type {
+	left := c.infer(expr.Left)
+	right := c.infer(expr.Right)
+	op := expr.Operator
+
+	switch op {
+	case "==", "!=":
+		if left != UNKNOWN && right != UNKNOWN && left != NULL && right != NULL &&
+			left != right && !(isNumeric(left) && isNumeric(right)) {
+			c.addError(TYPE_MISMATCH, expr.Token, "type mismatch: %s %s %s", left, op, right)
+			return UNKNOWN
+		}
+		return BOOL
+	}
+
+	if left == UNKNOWN || right == UNKNOWN {
+		// string concatenation accepts any operand
+		if op == "+" && (left == STRING || right == STRING) {
+			return STRING
+		}
+		return UNKNOWN
+	}
+
+	switch {
+	case isNumeric(left) && isNumeric(right):
+		if op == "%" && (left == FLOAT || right == FLOAT) {
+			c.addError(UNKNOWN_OPERATOR, expr.Token, "unknown operator: %s %s %s", left, op, right)
+			return UNKNOWN
+		}
+		switch op {
+		case "<", ">", "<=", ">=":
+			return BOOL
+		}
+		if left == FLOAT || right == FLOAT {
+			return FLOAT
+		}
+		return INT
+	case left == STRING && right == STRING:
+		switch op {
+		case "+":
+			return STRING
+		case "<", ">", "<=", ">=":
+			return BOOL
+		}
+		c.addError(UNKNOWN_OPERATOR, expr.Token, "unknown operator: %s %s %s", left, op, right)
+	case op == "+" && (left == STRING || right == STRING):
+		return STRING
+	case left != right:
+		c.addError(TYPE_MISMATCH, expr.Token, "type mismatch: %s %s %s", left, op, right)
+	default:
+		c.addError(UNKNOWN_OPERATOR, expr.Token, "unknown operator: %s %s %s", left, op, right)
+	}
+	return UNKNOWN
+}
+
+// helper: reports whether a value of type from can be stored in a declared variable
+func assignable(declared, from Type) bool {
+	if from == UNKNOWN || declared == from {
+		return true
+	}
+	return declared == FLOAT && from == INT
+}
+
+func isNumeric(t Type) bool {
+	return t == INT || t == FLOAT
+}
+
+func hashable(t Type) bool {
+	switch t {
+	case UNKNOWN, INT, STRING, BOOL:
+		return true
+	}
+	return false
+}
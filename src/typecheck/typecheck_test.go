@@ -0,0 +1,103 @@
+package typecheck
+
+import (
+	"lexicon/src/ast"
+	"lexicon/src/lexer"
+	"lexicon/src/parser"
+	"testing"
+)
+
+func TestTypeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"5 + true;", []string{"[Line 1:3] type mismatch: int + bool"}},
+		{"true + false;", []string{"[Line 1:6] unknown operator: bool + bool"}},
+		{`"a" == 1;`, []string{"[Line 1:5] type mismatch: string == int"}},
+		{`"a" - "b";`, []string{"[Line 1:5] unknown operator: string - string"}},
+		{"-true;", []string{"[Line 1:1] unknown operator: -bool"}},
+		{"5.5 % 2;", []string{"[Line 1:5] unknown operator: float % int"}},
+		{"sprout x int = 1.5;", []string{"[Line 1:8] type mismatch: cannot assign float to int variable x"}},
+		{"sprout x int = 1;\nx = \"s\";", []string{"[Line 2:1] type mismatch: cannot assign string to int variable x"}},
+		{"sprout s = \"text\";\nsprout n = 3;\nif (s < n) { }", []string{"[Line 3:7] type mismatch: string < int"}},
+		{"sprout x = 5;\nx(1);", []string{"[Line 2:2] not a function: int"}},
+		{"[1, 2][\"a\"];", []string{"[Line 1:7] array index must be int, got string"}},
+		{"sprout m = {[1]: 2};", []string{"[Line 1:12] unusable as hash key: array"}},
+		{
+			"sprout a = 1 + true;\nsprout b = fn() { return \"x\" * 2; };\necho -\"y\";",
+			[]string{
+				"[Line 1:14] type mismatch: int + bool",
+				"[Line 2:30] type mismatch: string * int",
+				"[Line 3:6] unknown operator: -string",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		errors := Check(parse(t, tt.input))
+
+		if len(errors) != len(tt.expected) {
+			t.Errorf("%q: expected %d errors, got=%v", tt.input, len(tt.expected), errors)
+			continue
+		}
+		for i, err := range errors {
+			if err != tt.expected[i] {
+				t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, tt.expected[i], err)
+			}
+		}
+	}
+}
+
+func TestWellTypedPrograms(t *testing.T) {
+	tests := []string{
+		"5 + 2.5;",
+		`"total: " + 5;`,
+		`"a" + true;`,
+		"sprout x float = 1; x = 2;",
+		"1 == 1.0;",
+		`"a" < "b";`,
+		`"a" == "b";`,
+		"true && 5;",
+		"!5;",
+		// a reassigned untyped variable can hold anything
+		`sprout x = 1; x = "s"; x + 1;`,
+		// redeclared names are not tracked
+		`sprout y = 1; sprout y = "s"; y - 1;`,
+		// parameters are unknown
+		`sprout f = fn(a) { a + 1; }; f("s");`,
+		`sprout a = [1, 2]; a[0] + true;`,
+		`sprout m = {"k": 1}; m["k"] * 2;`,
+	}
+
+	for _, input := range tests {
+		if errors := Check(parse(t, input)); len(errors) != 0 {
+			t.Errorf("%q: expected no errors, got=%v", input, errors)
+		}
+	}
+}
+
+func TestTypeOf(t *testing.T) {
+	program := parse(t, `sprout a = 1; sprout b = 2.5; sprout c = a + b; sprout d = "n" + a; sprout e = a < b;`)
+
+	checker := New()
+	checker.Check(program)
+
+	expected := []Type{INT, FLOAT, FLOAT, STRING, BOOL}
+	for i, stmt := range program.Statements {
+		decl := stmt.(*ast.VariableDeclaration)
+		if typ := checker.TypeOf(decl.Value); typ != expected[i] {
+			t.Errorf("statement %d: expected type %s, got=%s", i, expected[i], typ)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
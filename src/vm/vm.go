@@ -0,0 +1,457 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"lexicon/src/compiler"
+	"lexicon/src/evaluator"
+	"lexicon/src/token"
+	"strings"
+)
+
+const initialStackSize = 256
+
+// runtime function value, a compiled body closed over the scope it was created in
+type Closure struct {
+	Fn  *compiler.CompiledFunction
+	Env *evaluator.Environment
+}
+
+func (c *Closure) Type() evaluator.ObjectType { return evaluator.FUNCTION_OBJ }
+func (c *Closure) Inspect() string {
+	params := make([]string, 0, len(c.Fn.Literal.Parameters))
+	for _, p := range c.Fn.Literal.Parameters {
+		params = append(params, p.String())
+	}
+	return "fn(" + strings.Join(params, ", ") + ") " + c.Fn.Literal.Body.String()
+}
+
+// call in progress
+type frame struct {
+	fn        *compiler.CompiledFunction
+	ip        int
+	base      int                    // stack slot of the called function
+	callerEnv *evaluator.Environment // scope to restore on return
+}
+
+// stack machine running bytecode against evaluator environments, so
+// variables, builtins, output and limits behave as they do in Eval
+type VM struct {
+	stack []evaluator.Object
+	sp    int // next free slot
+
+	frames []*frame
+	env    *evaluator.Environment
+	exec   *evaluator.ExecContext
+}
+
+func New(bytecode *compiler.Bytecode, env *evaluator.Environment) *VM {
+	return &VM{
+		stack:  make([]evaluator.Object, initialStackSize),
+		frames: []*frame{{fn: bytecode.Main, callerEnv: env}},
+		env:    env,
+		exec:   env.ExecContext(),
+	}
+}
+
+// runs the program and returns the value of its last statement, or the *evaluator.Error that stopped it
+func (vm *VM) Run() evaluator.Object {
+	vm.exec.Reset()
+	return vm.run()
+}
+
+// runs the program, stopping with a CANCELLED error once ctx is done
+func (vm *VM) RunContext(ctx context.Context) evaluator.Object {
+	prev := vm.exec.SetContext(ctx)
+	defer vm.exec.SetContext(prev)
+	return vm.Run()
+}
+
+func (vm *VM) run() evaluator.Object {
+	f := vm.frames[len(vm.frames)-1]
+	ins := f.fn.Instructions
+	constants, names := f.fn.Bytecode.Constants, f.fn.Bytecode.Names
+
+	for {
+		if err := vm.exec.Step(); err != nil {
+			return err
+		}
+
+		pos := f.ip
+		op := compiler.Opcode(ins[pos])
+		f.ip++
+
+		switch op {
+		case compiler.OpConstant:
+			idx := vm.operand16(f)
+			if err := vm.pushTracked(constants[idx]); err != nil {
+				return err
+			}
+
+		case compiler.OpNull:
+			vm.push(evaluator.NULL)
+
+		case compiler.OpTrue:
+			vm.push(evaluator.TRUE)
+
+		case compiler.OpFalse:
+			vm.push(evaluator.FALSE)
+
+		case compiler.OpPop:
+			vm.pop()
+
+		case compiler.OpAdd, compiler.OpSub, compiler.OpMul, compiler.OpDiv, compiler.OpMod,
+			compiler.OpPow, compiler.OpEqual, compiler.OpNotEqual, compiler.OpLess,
+			compiler.OpGreater, compiler.OpLessEqual, compiler.OpGreaterEqual:
+			right := vm.pop()
+			left := vm.pop()
+			result := vm.binary(op, left, right, f, pos)
+			if isError(result) {
+				return result
+			}
+			if err := vm.pushTracked(result); err != nil {
+				return err
+			}
+
+		case compiler.OpInfix:
+			operator := names[vm.operand16(f)]
+			right := vm.pop()
+			left := vm.pop()
+			result := evaluator.InfixOperation(operator, left, right, vm.token(f, pos))
+			if isError(result) {
+				return result
+			}
+			if err := vm.pushTracked(result); err != nil {
+				return err
+			}
+
+		case compiler.OpMinus, compiler.OpBang, compiler.OpPrefix:
+			operator := "-"
+			if op == compiler.OpBang {
+				operator = "!"
+			} else if op == compiler.OpPrefix {
+				operator = names[vm.operand16(f)]
+			}
+			result := evaluator.PrefixOperation(operator, vm.pop())
+			if isError(result) {
+				return result
+			}
+			if err := vm.pushTracked(result); err != nil {
+				return err
+			}
+
+		case compiler.OpToBool:
+			vm.stack[vm.sp-1] = evaluator.NativeBool(evaluator.IsTruthy(vm.stack[vm.sp-1]))
+
+		case compiler.OpJump:
+			f.ip = vm.operand16(f)
+
+		case compiler.OpJumpIfFalse:
+			target := vm.operand16(f)
+			if !evaluator.IsTruthy(vm.pop()) {
+				f.ip = target
+			}
+
+		case compiler.OpGetName:
+			name := names[vm.operand16(f)]
+			val := evaluator.Lookup(vm.env, name, vm.token(f, pos))
+			if isError(val) {
+				return val
+			}
+			vm.push(val)
+
+		case compiler.OpGetSlot:
+			name := names[vm.operand16(f)]
+			depth := vm.operand16(f)
+			index := vm.operand16(f)
+			val, ok := vm.env.GetSlot(depth, index, name)
+			if !ok {
+				val = evaluator.Lookup(vm.env, name, vm.token(f, pos))
+				if isError(val) {
+					return val
+				}
+			}
+			vm.push(val)
+
+		case compiler.OpCheckBinding:
+			name := names[vm.operand16(f)]
+			assignment := vm.operand8(f) == 1
+			if err := evaluator.CheckBinding(vm.env, name, assignment, vm.token(f, pos)); err != nil {
+				return err
+			}
+
+		case compiler.OpDeclare:
+			name := names[vm.operand16(f)]
+			typ := ""
+			if idx := vm.operand16(f); idx != compiler.NoType {
+				typ = names[idx]
+			}
+			constant := vm.operand8(f) == 1
+			val := evaluator.Bind(vm.env, name, vm.pop(), typ, false, constant, vm.token(f, pos))
+			if isError(val) {
+				return val
+			}
+			vm.push(val)
+
+		case compiler.OpAssign:
+			name := names[vm.operand16(f)]
+			val := evaluator.Bind(vm.env, name, vm.pop(), "", true, false, vm.token(f, pos))
+			if isError(val) {
+				return val
+			}
+			vm.push(val)
+
+		case compiler.OpPushScope:
+			vm.env = evaluator.NewEnclosedEnvironment(vm.env)
+
+		case compiler.OpPopScope:
+			vm.env = vm.env.Outer()
+
+		case compiler.OpPrint:
+			fmt.Fprintln(vm.exec.Out, vm.stack[vm.sp-1].Inspect())
+
+		case compiler.OpArray:
+			n := vm.operand16(f)
+			elements := make([]evaluator.Object, n)
+			copy(elements, vm.stack[vm.sp-n:vm.sp])
+			vm.sp -= n
+			if err := vm.pushTracked(&evaluator.Array{Elements: elements}); err != nil {
+				return err
+			}
+
+		case compiler.OpHash:
+			n := vm.operand16(f)
+			hash := evaluator.NewHash()
+			for i := vm.sp - 2*n; i < vm.sp; i += 2 {
+				hash.Set(vm.stack[i], vm.stack[i+1])
+			}
+			vm.sp -= 2 * n
+			if err := vm.pushTracked(hash); err != nil {
+				return err
+			}
+
+		case compiler.OpCheckHashKey:
+			if err := evaluator.CheckHashKey(vm.stack[vm.sp-1], vm.token(f, pos)); err != nil {
+				return err
+			}
+
+		case compiler.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			result := evaluator.IndexOperation(left, index, vm.token(f, pos))
+			if isError(result) {
+				return result
+			}
+			vm.push(result)
+
+		case compiler.OpSetIndex:
+			val := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+			result := evaluator.SetIndex(left, index, val, vm.token(f, pos))
+			if isError(result) {
+				return result
+			}
+			vm.push(result)
+
+		case compiler.OpDelete:
+			index := vm.pop()
+			left := vm.pop()
+			result := evaluator.DeleteKey(left, index, vm.token(f, pos))
+			if isError(result) {
+				return result
+			}
+			vm.push(result)
+
+		case compiler.OpSliceable:
+			if err := evaluator.CheckSliceable(vm.stack[vm.sp-1], vm.token(f, pos)); err != nil {
+				return err
+			}
+
+		case compiler.OpSliceBound:
+			if err := evaluator.CheckSliceBound(vm.stack[vm.sp-1], vm.token(f, pos)); err != nil {
+				return err
+			}
+
+		case compiler.OpSlice:
+			high, _ := vm.pop().(*evaluator.Integer)
+			low, _ := vm.pop().(*evaluator.Integer)
+			array := vm.pop().(*evaluator.Array)
+			result := evaluator.SliceArray(array, low, high, vm.token(f, pos))
+			if isError(result) {
+				return result
+			}
+			if err := vm.pushTracked(result); err != nil {
+				return err
+			}
+
+		case compiler.OpClosure:
+			fn := constants[vm.operand16(f)].(*compiler.CompiledFunction)
+			if err := vm.pushTracked(&Closure{Fn: fn, Env: vm.env}); err != nil {
+				return err
+			}
+
+		case compiler.OpCall:
+			numArgs := vm.operand8(f)
+			if err := vm.call(numArgs, vm.token(f, pos)); err != nil {
+				return err
+			}
+			f = vm.frames[len(vm.frames)-1]
+			ins = f.fn.Instructions
+			constants, names = f.fn.Bytecode.Constants, f.fn.Bytecode.Names
+
+		case compiler.OpReturnValue:
+			val := vm.pop()
+			if len(vm.frames) == 1 {
+				// return at the top level ends the program
+				return val
+			}
+
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			vm.exec.Leave()
+			vm.env = f.callerEnv
+			vm.sp = f.base
+			vm.push(val)
+
+			f = vm.frames[len(vm.frames)-1]
+			ins = f.fn.Instructions
+			constants, names = f.fn.Bytecode.Constants, f.fn.Bytecode.Names
+
+		default:
+			return &evaluator.Error{Message: fmt.Sprintf("unknown opcode %d", op)}
+		}
+	}
+}
+
+// calls the function below the top numArgs values, compiled functions get a
+// new frame, builtins and evaluator functions are called directly
+func (vm *VM) call(numArgs int, tok token.Token) evaluator.Object {
+	base := vm.sp - numArgs - 1
+	callee := vm.stack[base]
+
+	closure, ok := callee.(*Closure)
+	if !ok {
+		args := make([]evaluator.Object, numArgs)
+		copy(args, vm.stack[base+1:vm.sp])
+		result := evaluator.ApplyFunction(callee, args, tok)
+		if isError(result) {
+			return result
+		}
+		vm.sp = base
+		vm.push(result)
+		return nil
+	}
+
+	params := closure.Fn.Parameters
+	if numArgs != len(params) {
+		return &evaluator.Error{
+			Message: fmt.Sprintf("wrong number of arguments: want=%d, got=%d", len(params), numArgs),
+			Line:    tok.Line,
+			Column:  tok.Column,
+		}
+	}
+	if err := vm.exec.Enter(tok); err != nil {
+		return err
+	}
+
+	env := evaluator.NewEnclosedEnvironment(closure.Env)
+	for i, param := range params {
+		env.Set(param, vm.stack[base+1+i])
+	}
+
+	vm.frames = append(vm.frames, &frame{fn: closure.Fn, base: base, callerEnv: vm.env})
+	vm.env = env
+	return nil
+}
+
+// arithmetic and comparison, integers take a fast path and everything else
+// goes through the evaluator's operators
+func (vm *VM) binary(op compiler.Opcode, left, right evaluator.Object, f *frame, pos int) evaluator.Object {
+	if l, ok := left.(*evaluator.Integer); ok {
+		if r, ok := right.(*evaluator.Integer); ok {
+			switch op {
+			case compiler.OpAdd:
+				return &evaluator.Integer{Value: l.Value + r.Value}
+			case compiler.OpSub:
+				return &evaluator.Integer{Value: l.Value - r.Value}
+			case compiler.OpMul:
+				return &evaluator.Integer{Value: l.Value * r.Value}
+			case compiler.OpLess:
+				return evaluator.NativeBool(l.Value < r.Value)
+			case compiler.OpGreater:
+				return evaluator.NativeBool(l.Value > r.Value)
+			case compiler.OpLessEqual:
+				return evaluator.NativeBool(l.Value <= r.Value)
+			case compiler.OpGreaterEqual:
+				return evaluator.NativeBool(l.Value >= r.Value)
+			case compiler.OpEqual:
+				return evaluator.NativeBool(l.Value == r.Value)
+			case compiler.OpNotEqual:
+				return evaluator.NativeBool(l.Value != r.Value)
+			}
+		}
+	}
+	return evaluator.InfixOperation(binaryOperators[op], left, right, vm.token(f, pos))
+}
+
+var binaryOperators = map[compiler.Opcode]string{
+	compiler.OpAdd:          "+",
+	compiler.OpSub:          "-",
+	compiler.OpMul:          "*",
+	compiler.OpDiv:          "/",
+	compiler.OpMod:          "%",
+	compiler.OpPow:          "**",
+	compiler.OpEqual:        "==",
+	compiler.OpNotEqual:     "!=",
+	compiler.OpLess:         "<",
+	compiler.OpGreater:      ">",
+	compiler.OpLessEqual:    "<=",
+	compiler.OpGreaterEqual: ">=",
+}
+
+func (vm *VM) push(obj evaluator.Object) {
+	if vm.sp >= len(vm.stack) {
+		vm.stack = append(vm.stack, make([]evaluator.Object, len(vm.stack))...)
+	}
+	vm.stack[vm.sp] = obj
+	vm.sp++
+}
+
+// pushes a newly allocated value, counting it against the object limit
+func (vm *VM) pushTracked(obj evaluator.Object) evaluator.Object {
+	obj = vm.exec.Track(obj)
+	if isError(obj) {
+		return obj
+	}
+	vm.push(obj)
+	return nil
+}
+
+func (vm *VM) pop() evaluator.Object {
+	vm.sp--
+	obj := vm.stack[vm.sp]
+	vm.stack[vm.sp] = nil
+	return obj
+}
+
+func (vm *VM) operand16(f *frame) int {
+	v := int(compiler.ReadUint16(f.fn.Instructions[f.ip:]))
+	f.ip += 2
+	return v
+}
+
+func (vm *VM) operand8(f *frame) int {
+	v := int(f.fn.Instructions[f.ip])
+	f.ip++
+	return v
+}
+
+// source position of the instruction at pos
+func (vm *VM) token(f *frame, pos int) token.Token {
+	return f.fn.Tokens[pos]
+}
+
+func isError(obj evaluator.Object) bool {
+	_, ok := obj.(*evaluator.Error)
+	return ok
+}
@@ -0,0 +1,243 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"lexicon/src/ast"
+	"lexicon/src/compiler"
+	"lexicon/src/evaluator"
+	"lexicon/src/lexer"
+	"lexicon/src/parser"
+	"lexicon/src/resolver"
+	"testing"
+)
+
+// programs run through both engines, which must agree on the value, the
+// echo output and any error including its position
+var parityPrograms = []string{
+	// literals and operators
+	"5 + 5 * 2 - 3 / 1;",
+	"7 % 3; 2 ** 10;",
+	"2.5 * 4; 1 + 0.5; 10 / 4.0;",
+	`"a" + "b"; "n: " + 5; 5 + "x"; "s" + 1.5; true + "!";`,
+	"-5; -2.5; !true; !!5; !null;",
+	"1 < 2; 2 >= 2; 1 == 1.0; 1 != 2;",
+	`"apple" < "banana"; "b" >= "a";`,
+	"[1, [2]] == [1, [2]];",
+	`({"a": 1} == {"a": 1});`,
+	"true && 0; false || 1; (1 > 2) && (1 / 0);",
+	// variables, scopes and types
+	"sprout x = 10; x = x + 1; x;",
+	"sprout x int = 1; { sprout x = 2; x = 3; } x;",
+	"sprout f float = 1; f;",
+	"const c = 5; c * 2;",
+	"sprout x = 1; if (x > 0) { sprout y = 2; x = x + y; } x;",
+	"if (false) { 1 }",
+	"if (1 > 2) { 10 } else { 20 }",
+	// loops
+	"sprout i = 0; while (i < 10) { i = i + 1; } i;",
+	"sprout s = 0; for (sprout i = 0; i < 10; i = i + 1) { if (i % 2 == 0) { continue; } if (i > 7) { break; } s = s + i; } s;",
+	"sprout n = 0; while (true) { n = n + 1; if (n == 5) { break; } } n;",
+	"for (sprout i = 0; i < 3; i = i + 1) { echo i; }",
+	"sprout i = 0; for (;;) { i = i + 1; if (i > 3) { break; } } i;",
+	// functions and closures
+	"sprout add = fn(a, b) { a + b }; add(2, 3);",
+	"sprout fib = fn(n) { if (n < 2) { return n; } return fib(n - 1) + fib(n - 2); }; fib(15);",
+	"sprout counter = fn() { sprout c = 0; fn() { c = c + 1; c } }; sprout next = counter(); next(); next(); next();",
+	"sprout f = fn(x) { while (true) { if (x > 3) { return x; } x = x + 1; } }; f(0);",
+	"sprout f = fn() { }; f();",
+	"sprout f = fn(a) { a }; f;",
+	"return 5; 10;",
+	"for (sprout i = 0; i < 5; i = i + 1) { if (i == 2) { return i * 100; } }",
+	// collections
+	"sprout a = [1, 2, 3]; a[0] + a[-1];",
+	"sprout a = [1, 2, 3, 4]; a[1:3]; a[:2]; a[-2:]; a[:];",
+	"sprout a = [1, 2]; a[0] = 9; a;",
+	`sprout m = {"k": 1, 2: "two"}; m["k"] = m["k"] + 1; m["missing"]; m;`,
+	`sprout m = {"a": 1, "b": 2}; delete m["a"]; m;`,
+	`echo [1, "a", 2.5]; echo {"k": [1]};`,
+	// errors
+	"5 + true;",
+	"-true;",
+	"foobar;",
+	"1 / 0;",
+	"sprout x = 1;\nx = y;",
+	"sprout x int = 1;\nx = \"s\";",
+	"undeclared = 5;",
+	"sprout f = fn(a) { a };\nf(1, 2);",
+	"5(1);",
+	"[1, 2][5];",
+	`[1][ "a" ];`,
+	"{}[[1]];",
+	"sprout m = {[1]: 2};",
+	"5[0];",
+	"[1, 2, 3][2:1];",
+	`[1][ "a" :];`,
+	"5[1:];",
+	"sprout a = 5;\na[0] = 1;",
+	"sprout a = [1];\ndelete a[0];",
+	`"a" - "b";`,
+	"sprout f = fn() { echo \"before\"; 1 + true; echo \"after\"; }; f();",
+}
+
+func TestParityWithEvaluator(t *testing.T) {
+	for _, input := range parityPrograms {
+		wantOut, want := runEvaluator(t, input)
+		gotOut, got := runVM(t, input)
+
+		if want.Inspect() != got.Inspect() {
+			t.Errorf("%q: result mismatch. evaluator=%s vm=%s", input, want.Inspect(), got.Inspect())
+		}
+		if wantOut != gotOut {
+			t.Errorf("%q: output mismatch. evaluator=%q vm=%q", input, wantOut, gotOut)
+		}
+	}
+}
+
+// slot reads must not change what a program does, on either backend
+func TestParityWithResolvedSlots(t *testing.T) {
+	for _, input := range parityPrograms {
+		wantOut, want := runEvaluator(t, input)
+
+		program := parse(t, input)
+		resolver.Resolve(program, nil)
+		bytecode, err := compiler.Compile(program)
+		if err != nil {
+			t.Fatalf("%q: compiler error: %s", input, err)
+		}
+
+		var out bytes.Buffer
+		env := evaluator.NewEnvironment()
+		env.SetExecContext(evaluator.NewExecContext(&out, io.Discard))
+		got := New(bytecode, env).Run()
+
+		if want.Inspect() != got.Inspect() {
+			t.Errorf("%q: result mismatch. evaluator=%s vm=%s", input, want.Inspect(), got.Inspect())
+		}
+		if wantOut != out.String() {
+			t.Errorf("%q: output mismatch. evaluator=%q vm=%q", input, wantOut, out.String())
+		}
+	}
+}
+
+func TestGlobalsPersistAcrossRuns(t *testing.T) {
+	env := evaluator.NewEnvironment()
+	env.SetExecContext(evaluator.NewExecContext(io.Discard, io.Discard))
+
+	for _, input := range []string{"sprout total = 1;", "sprout inc = fn(n) { total = total + n; };", "inc(41);"} {
+		if result := runWithEnv(t, input, env); isError(result) {
+			t.Fatalf("%q: unexpected error %s", input, result.Inspect())
+		}
+	}
+
+	total, _ := env.Get("total")
+	if total.Inspect() != "42" {
+		t.Errorf("expected total=42, got=%s", total.Inspect())
+	}
+}
+
+func TestBuiltinsAndEvaluatorFunctions(t *testing.T) {
+	env := evaluator.NewEnvironment()
+	registry := evaluator.NewRegistry()
+	registry.Register("twice", func(args ...evaluator.Object) evaluator.Object {
+		return &evaluator.Integer{Value: args[0].(*evaluator.Integer).Value * 2}
+	})
+	registry.Register("fail", func(args ...evaluator.Object) evaluator.Object {
+		return &evaluator.Error{Message: "failed"}
+	})
+	env.SetBuiltins(registry)
+
+	// a function created by the evaluator can be called from bytecode
+	evaluator.Eval(parse(t, "sprout inc = fn(x) { x + 1 };"), env)
+
+	if result := runWithEnv(t, "inc(twice(20));", env); result.Inspect() != "41" {
+		t.Errorf("expected 41, got=%s", result.Inspect())
+	}
+	if result := runWithEnv(t, "sprout x = 1;\nfail();", env); result.Inspect() != "ERROR [Line 2:5]: failed" {
+		t.Errorf("wrong builtin error, got=%s", result.Inspect())
+	}
+}
+
+func TestLimitsAndCancellation(t *testing.T) {
+	tests := []struct {
+		input  string
+		limits evaluator.Limits
+		code   evaluator.ErrorCode
+	}{
+		{"while (true) { }", evaluator.Limits{MaxSteps: 1000}, evaluator.STEP_LIMIT_EXCEEDED},
+		{"sprout f = fn(n) { f(n + 1) }; f(0);", evaluator.Limits{MaxDepth: 100}, evaluator.DEPTH_LIMIT_EXCEEDED},
+		{"sprout a = []; while (true) { a = [a]; }", evaluator.Limits{MaxObjects: 100}, evaluator.OBJECT_LIMIT_EXCEEDED},
+	}
+
+	for _, tt := range tests {
+		env := evaluator.NewEnvironment()
+		env.ExecContext().Limits = tt.limits
+		result := runWithEnv(t, tt.input, env)
+		if errObj, ok := result.(*evaluator.Error); !ok || errObj.Code != tt.code {
+			t.Errorf("%q: expected %s, got=%s", tt.input, tt.code, result.Inspect())
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	bytecode := compile(t, "while (true) { }")
+	result := New(bytecode, evaluator.NewEnvironment()).RunContext(ctx)
+	if errObj, ok := result.(*evaluator.Error); !ok || errObj.Code != evaluator.CANCELLED {
+		t.Errorf("expected CANCELLED, got=%s", result.Inspect())
+	}
+}
+
+// runaway recursion ends with the default depth limit on both engines
+func TestRunawayRecursion(t *testing.T) {
+	input := "sprout f = fn(n) { return f(n + 1); }; f(0);"
+	for name, run := range map[string]func(*testing.T, string) (string, evaluator.Object){"evaluator": runEvaluator, "vm": runVM} {
+		_, result := run(t, input)
+		errObj, ok := result.(*evaluator.Error)
+		if !ok || errObj.Code != evaluator.DEPTH_LIMIT_EXCEEDED || errObj.Message != "recursion depth limit exceeded: 10000" {
+			t.Errorf("%s: expected the default depth limit, got=%s", name, result.Inspect())
+		}
+	}
+}
+
+func runEvaluator(t *testing.T, input string) (string, evaluator.Object) {
+	t.Helper()
+	var out bytes.Buffer
+	env := evaluator.NewEnvironment()
+	env.SetExecContext(evaluator.NewExecContext(&out, io.Discard))
+	result := evaluator.Eval(parse(t, input), env)
+	return out.String(), result
+}
+
+func runVM(t *testing.T, input string) (string, evaluator.Object) {
+	t.Helper()
+	var out bytes.Buffer
+	env := evaluator.NewEnvironment()
+	env.SetExecContext(evaluator.NewExecContext(&out, io.Discard))
+	result := runWithEnv(t, input, env)
+	return out.String(), result
+}
+
+func runWithEnv(t *testing.T, input string, env *evaluator.Environment) evaluator.Object {
+	t.Helper()
+	return New(compile(t, input), env).Run()
+}
+
+func compile(t *testing.T, input string) *compiler.Bytecode {
+	t.Helper()
+	bytecode, err := compiler.Compile(parse(t, input))
+	if err != nil {
+		t.Fatalf("%q: compiler error: %s", input, err)
+	}
+	return bytecode
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("%q: parser errors: %v", input, p.Errors())
+	}
+	return program
+}